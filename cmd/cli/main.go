@@ -1,22 +1,36 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"html"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"insight/src/ai"
 	"insight/src/db"
+	"insight/src/models"
 	"insight/src/usecase"
 
 	"github.com/urfave/cli/v3"
+	"gorm.io/gorm"
 )
 
 func main() {
 	app := &cli.Command{
 		Name:  "insight",
 		Usage: "A tool for managing fragments and documents",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "user",
+				Usage:   "Username recorded as the author of changes (default: a user named $USER if one exists)",
+				Sources: cli.EnvVars("INSIGHT_USER"),
+			},
+		},
 		Commands: []*cli.Command{
 			{
 				Name:  "fragment",
@@ -36,8 +50,18 @@ func main() {
 						Action: createFragment,
 					},
 					{
-						Name:   "list",
-						Usage:  "List all fragments",
+						Name:  "list",
+						Usage: "List all fragments",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "tag",
+								Usage: "Only fragments with this tag (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "author",
+								Usage: "Only fragments created by this username",
+							},
+						},
 						Action: listFragments,
 					},
 					{
@@ -52,6 +76,92 @@ func main() {
 						},
 						Action: deleteFragment,
 					},
+					{
+						Name:  "edit",
+						Usage: "Edit a fragment (opens $EDITOR unless --content is given)",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Fragment ID to edit",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "content",
+								Aliases: []string{"c"},
+								Usage:   "New content of the fragment",
+							},
+						},
+						Action: editFragment,
+					},
+					{
+						Name:  "history",
+						Usage: "Show the revision history of a fragment",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Fragment ID",
+								Required: true,
+							},
+						},
+						Action: fragmentHistory,
+					},
+					{
+						Name:  "restore",
+						Usage: "Restore a fragment to the content of a past revision",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Fragment ID",
+								Required: true,
+							},
+							&cli.IntFlag{
+								Name:     "revision",
+								Usage:    "Revision ID to restore",
+								Required: true,
+							},
+						},
+						Action: restoreFragment,
+					},
+					{
+						Name:  "tag",
+						Usage: "Manage the tags of a fragment",
+						Commands: []*cli.Command{
+							{
+								Name:  "add",
+								Usage: "Add tags to a fragment (creates tags that do not exist)",
+								Flags: []cli.Flag{
+									&cli.IntFlag{
+										Name:     "id",
+										Usage:    "Fragment ID",
+										Required: true,
+									},
+									&cli.StringSliceFlag{
+										Name:     "tag",
+										Usage:    "Tag name (can be repeated)",
+										Required: true,
+									},
+								},
+								Action: tagFragment,
+							},
+							{
+								Name:  "remove",
+								Usage: "Remove tags from a fragment",
+								Flags: []cli.Flag{
+									&cli.IntFlag{
+										Name:     "id",
+										Usage:    "Fragment ID",
+										Required: true,
+									},
+									&cli.StringSliceFlag{
+										Name:     "tag",
+										Usage:    "Tag name (can be repeated)",
+										Required: true,
+									},
+								},
+								Action: tagFragment,
+							},
+						},
+					},
 				},
 			},
 			{
@@ -75,34 +185,2054 @@ func main() {
 						},
 						Action: showDocument,
 					},
+					{
+						Name:  "create",
+						Usage: "Write a new document by hand (opens $EDITOR unless --content is given)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "title",
+								Usage:    "Title of the document",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "summary",
+								Usage:    "Summary of the document",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "content",
+								Aliases: []string{"c"},
+								Usage:   "Markdown content of the document",
+							},
+							&cli.StringSliceFlag{
+								Name:  "tag",
+								Usage: "Tag name (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "author",
+								Usage: "Author name recorded with the revision (default: the --user username, or $USER)",
+							},
+						},
+						Action: createDocument,
+					},
+					{
+						Name:  "edit",
+						Usage: "Edit a document (opens $EDITOR for the content unless another field is given)",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID to edit",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "title",
+								Usage: "New title",
+							},
+							&cli.StringFlag{
+								Name:  "summary",
+								Usage: "New summary",
+							},
+							&cli.StringFlag{
+								Name:    "content",
+								Aliases: []string{"c"},
+								Usage:   "New Markdown content",
+							},
+							&cli.StringSliceFlag{
+								Name:  "tag",
+								Usage: "Replace tags with these names (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "author",
+								Usage: "Author name recorded with the revision (default: the --user username, or $USER)",
+							},
+						},
+						Action: editDocument,
+					},
+					{
+						Name:  "delete",
+						Usage: "Delete a document",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID to delete",
+								Required: true,
+							},
+						},
+						Action: deleteDocument,
+					},
+					{
+						Name:  "history",
+						Usage: "Show the revision history of a document",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID",
+								Required: true,
+							},
+						},
+						Action: documentHistory,
+					},
+					{
+						Name:  "lock",
+						Usage: "Lock a document so that regeneration carries it over unchanged",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID to lock",
+								Required: true,
+							},
+						},
+						Action: lockDocument,
+					},
+					{
+						Name:  "unlock",
+						Usage: "Unlock a document so that regeneration may rewrite it",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID to unlock",
+								Required: true,
+							},
+						},
+						Action: lockDocument,
+					},
 				},
 			},
 			{
-				Name:  "ai",
-				Usage: "AI operations",
+				Name:      "search",
+				Usage:     "Search documents and fragments",
+				ArgsUsage: "<query>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "semantic",
+						Usage: "Search by meaning using the vector index",
+					},
+					&cli.BoolFlag{
+						Name:  "fragments",
+						Usage: "Search fragments instead of documents",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "Filter by tag (can be repeated)",
+					},
+					&cli.StringFlag{
+						Name:  "version",
+						Usage: "Filter documents by version timestamp",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Only items created on or after this date (YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "Only items created on or before this date (YYYY-MM-DD)",
+					},
+					&cli.IntFlag{
+						Name:  "page",
+						Usage: "Page number",
+						Value: 1,
+					},
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "Maximum number of results",
+						Value: 10,
+					},
+				},
+				Action: search,
+			},
+			{
+				Name:      "ask",
+				Usage:     "Ask a question about your documents",
+				ArgsUsage: "<question>",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "document-id",
+						Usage: "Document ID to ask about (default: multiple documents)",
+					},
+					&cli.BoolFlag{
+						Name:  "fragments",
+						Usage: "Answer from fragments, including ones not yet turned into documents",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "With --fragments: only fragments created on or after this date (YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "With --fragments: only fragments created on or before this date (YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "version",
+						Usage: "Ask over a specific document version (default: latest)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "Only documents with this tag (can be repeated)",
+					},
+					&cli.IntSliceFlag{
+						Name:  "ids",
+						Usage: "Only these document IDs, regardless of version (can be repeated)",
+					},
+					&cli.BoolFlag{
+						Name:  "web-search",
+						Usage: "Enable web search for additional context",
+					},
+					&cli.BoolFlag{
+						Name:  "agent",
+						Usage: "Let the AI search documents and fragments with tools and show the tool trace",
+					},
+					&cli.IntFlag{
+						Name:  "max-steps",
+						Usage: "With --agent: maximum number of model calls (default 6, max 10)",
+					},
+				},
+				Action: ask,
+			},
+			{
+				Name:  "chat",
+				Usage: "Start an interactive conversation about your documents",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "document-id",
+						Usage: "Document ID to talk about (default: latest version of all documents)",
+					},
+					&cli.IntFlag{
+						Name:  "conversation-id",
+						Usage: "Resume an existing conversation",
+					},
+					&cli.StringFlag{
+						Name:  "version",
+						Usage: "Ask over a specific document version (default: latest)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "Only documents with this tag (can be repeated)",
+					},
+					&cli.IntSliceFlag{
+						Name:  "ids",
+						Usage: "Only these document IDs, regardless of version (can be repeated)",
+					},
+					&cli.BoolFlag{
+						Name:  "web-search",
+						Usage: "Enable web search for additional context",
+					},
+					&cli.BoolFlag{
+						Name:  "agent",
+						Usage: "Let the AI search documents and fragments with tools",
+					},
+				},
+				Action: chat,
+			},
+			{
+				Name:  "qa",
+				Usage: "Q&A history operations",
 				Commands: []*cli.Command{
 					{
-						Name:   "create",
-						Usage:  "Create documents from fragments using AI",
-						Action: createDocuments,
+						Name:  "history",
+						Usage: "List recorded Q&A exchanges",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "scope",
+								Usage: "Filter by scope (document, global, fragments or agent)",
+							},
+							&cli.IntFlag{
+								Name:  "document-id",
+								Usage: "Filter by document ID",
+							},
+							&cli.StringFlag{
+								Name:  "feedback",
+								Usage: "Filter by feedback (up, down or none)",
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: "Maximum number of exchanges",
+								Value: 20,
+							},
+						},
+						Action: listQAHistory,
 					},
 					{
-						Name:   "compress",
-						Usage:  "Compress fragments by merging similar ones and removing low-value ones",
-						Action: compressFragments,
+						Name:  "feedback",
+						Usage: "Rate a Q&A exchange",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Exchange ID",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "rating",
+								Usage:    "Rating (up, down or none)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "comment",
+								Usage: "Optional comment",
+							},
+						},
+						Action: setQAFeedback,
+					},
+					{
+						Name:  "save",
+						Usage: "Save an answer as a new fragment",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Exchange ID",
+								Required: true,
+							},
+						},
+						Action: saveQAAsFragment,
 					},
 				},
 			},
-		},
+			{
+				Name:  "conversation",
+				Usage: "Conversation operations",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List all conversations",
+						Action: listConversations,
+					},
+					{
+						Name:  "show",
+						Usage: "Show a conversation with its messages",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Conversation ID",
+								Required: true,
+							},
+						},
+						Action: showConversation,
+					},
+					{
+						Name:  "delete",
+						Usage: "Delete a conversation",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Conversation ID",
+								Required: true,
+							},
+						},
+						Action: deleteConversation,
+					},
+				},
+			},
+			{
+				Name:  "tag",
+				Usage: "Tag management",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List tags with usage counts and synonyms",
+						Action: listTags,
+					},
+					{
+						Name:   "tree",
+						Usage:  "Show tags as a tree with counts including child tags",
+						Action: showTagTree,
+					},
+					{
+						Name:  "parent",
+						Usage: "Set the parent of a tag (omit --parent to make it a top-level tag)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "Tag name",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "parent",
+								Usage: "Parent tag name",
+							},
+						},
+						Action: setTagParent,
+					},
+					{
+						Name:  "rename",
+						Usage: "Rename a tag",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "Current tag name",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "New tag name",
+								Required: true,
+							},
+						},
+						Action: renameTag,
+					},
+					{
+						Name:  "merge",
+						Usage: "Merge tags into one (merged names become synonyms)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "into",
+								Usage:    "Tag to keep (created if it does not exist)",
+								Required: true,
+							},
+							&cli.StringSliceFlag{
+								Name:     "tag",
+								Usage:    "Tag to merge (can be repeated)",
+								Required: true,
+							},
+						},
+						Action: mergeTags,
+					},
+					{
+						Name:  "color",
+						Usage: "Set the color of a tag",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "Tag name",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "color",
+								Usage:    "Color in #RRGGBB format",
+								Required: true,
+							},
+						},
+						Action: setTagColor,
+					},
+					{
+						Name:  "delete",
+						Usage: "Delete a tag that is not used by any document or fragment",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "Tag name",
+								Required: true,
+							},
+						},
+						Action: deleteTag,
+					},
+					{
+						Name:   "prune",
+						Usage:  "Delete all tags that are not used by any document or fragment",
+						Action: pruneTags,
+					},
+					{
+						Name:  "synonym",
+						Usage: "Manage synonyms that are resolved to a tag when tags are created",
+						Commands: []*cli.Command{
+							{
+								Name:  "add",
+								Usage: "Add a synonym to a tag",
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "name",
+										Usage:    "Tag name",
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "synonym",
+										Usage:    "Synonym (e.g. golang)",
+										Required: true,
+									},
+								},
+								Action: addTagSynonym,
+							},
+							{
+								Name:  "remove",
+								Usage: "Remove a synonym",
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "synonym",
+										Usage:    "Synonym to remove",
+										Required: true,
+									},
+								},
+								Action: removeTagSynonym,
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "user",
+				Usage: "Manage user accounts",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List users",
+						Action: listUsers,
+					},
+					{
+						Name:  "create",
+						Usage: "Create a user",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "username",
+								Usage:    "Username (letters, digits, '.', '_' or '-')",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "role",
+								Usage: "Role: viewer, editor or admin",
+								Value: models.UserRoleEditor,
+							},
+						},
+						Action: createUser,
+					},
+					{
+						Name:  "role",
+						Usage: "Change the role of a user",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "username",
+								Usage:    "Username",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "role",
+								Usage:    "Role: viewer, editor or admin",
+								Required: true,
+							},
+						},
+						Action: setUserRole,
+					},
+					{
+						Name:  "delete",
+						Usage: "Delete a user and revoke their API tokens (their fragments and edits are kept)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "username",
+								Usage:    "Username",
+								Required: true,
+							},
+						},
+						Action: deleteUser,
+					},
+				},
+			},
+			{
+				Name:  "token",
+				Usage: "Manage API tokens for the web server",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List API tokens",
+						Action: listAPITokens,
+					},
+					{
+						Name:  "create",
+						Usage: "Create an API token for the --user user (the token is shown only once)",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "Name to identify the token",
+								Required: true,
+							},
+							&cli.StringSliceFlag{
+								Name:     "scope",
+								Usage:    "Scope: read, write or ai (can be repeated)",
+								Required: true,
+							},
+							&cli.IntFlag{
+								Name:  "expires-in",
+								Usage: "Days until the token expires (0 for no expiry)",
+							},
+						},
+						Action: createAPIToken,
+					},
+					{
+						Name:  "revoke",
+						Usage: "Revoke an API token and log out its browser sessions",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Token ID to revoke",
+								Required: true,
+							},
+						},
+						Action: revokeAPIToken,
+					},
+				},
+			},
+			{
+				Name:  "ai",
+				Usage: "AI operations",
+				Commands: []*cli.Command{
+					{
+						Name:  "create",
+						Usage: "Create documents from fragments using AI",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "tag",
+								Usage: "Only fragments with this tag (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "since",
+								Usage: "Only fragments created on or after this date (YYYY-MM-DD)",
+							},
+							&cli.StringFlag{
+								Name:  "until",
+								Usage: "Only fragments created on or before this date (YYYY-MM-DD)",
+							},
+							&cli.IntSliceFlag{
+								Name:  "ids",
+								Usage: "Only these fragment IDs (e.g. --ids 3,5,8)",
+							},
+							&cli.StringFlag{
+								Name:    "instructions",
+								Aliases: []string{"i"},
+								Usage:   "Additional instructions for the AI",
+							},
+							&cli.StringFlag{
+								Name:  "audience",
+								Usage: "Target audience (e.g. \"new backend engineers\")",
+							},
+							&cli.StringFlag{
+								Name:  "style",
+								Usage: "Document style: " + strings.Join(usecase.GenerationStyles, ", "),
+							},
+							&cli.StringFlag{
+								Name:  "granularity",
+								Usage: "Document granularity: " + strings.Join(usecase.GenerationGranularities, ", "),
+							},
+							&cli.IntFlag{
+								Name:  "documents",
+								Usage: "Desired number of documents (default: decided by the AI)",
+							},
+						},
+						Action: createDocuments,
+					},
+					{
+						Name:   "compress",
+						Usage:  "Compress fragments by merging similar ones and removing low-value ones",
+						Action: compressFragments,
+					},
+					{
+						Name:  "suggest",
+						Usage: "Generate suggested questions for documents whose content changed",
+						Flags: []cli.Flag{
+							&cli.IntSliceFlag{
+								Name:  "id",
+								Usage: "Document ID (can be repeated, default: latest version)",
+							},
+						},
+						Action: suggestQuestions,
+					},
+					{
+						Name:  "regenerate",
+						Usage: "Regenerate a single document from its linked fragments",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "id",
+								Usage:    "Document ID to regenerate",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:    "instructions",
+								Aliases: []string{"i"},
+								Usage:   "Extra instructions for the AI (e.g. \"add a troubleshooting section\")",
+							},
+						},
+						Action: regenerateDocument,
+					},
+					{
+						Name:  "tag",
+						Usage: "Tag fragments automatically, reusing existing tags where possible",
+						Flags: []cli.Flag{
+							&cli.IntSliceFlag{
+								Name:  "id",
+								Usage: "Fragment ID (can be repeated, default: untagged fragments)",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "Tag all fragments, including ones that already have tags",
+							},
+						},
+						Action: autoTagFragments,
+					},
+					{
+						Name:  "tags",
+						Usage: "AI operations on the tag vocabulary",
+						Commands: []*cli.Command{
+							{
+								Name:  "consolidate",
+								Usage: "Propose merging near-duplicate tags and apply the accepted ones",
+								Flags: []cli.Flag{
+									&cli.BoolFlag{
+										Name:  "yes",
+										Usage: "Apply all proposals without asking",
+									},
+									&cli.BoolFlag{
+										Name:  "dry-run",
+										Usage: "Only show the proposals",
+									},
+								},
+								Action: consolidateTags,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := app.Run(context.Background(), os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func createFragment(ctx context.Context, c *cli.Command) error {
+	content := c.String("content")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+
+	// ユースケース初期化
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+
+	// Fragment作成
+	input := usecase.CreateFragmentInput{
+		Content: content,
+		UserID:  userIDOf(user),
+	}
+
+	fragment, err := fragmentUsecase.CreateFragment(input)
+	if err != nil {
+		return fmt.Errorf("failed to create fragment: %w", err)
+	}
+
+	fmt.Printf("Fragment created successfully!\n")
+	fmt.Printf("ID: %d\n", fragment.ID)
+	fmt.Printf("Content: %s\n", fragment.Content)
+	fmt.Printf("Created at: %s\n", fragment.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	return nil
+}
+
+func listTags(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	summaries, err := usecase.NewTagUsecase(database).GetTagSummaries()
+	if err != nil {
+		return fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	if len(summaries) == 0 {
+		fmt.Println("No tags found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d tags:\n\n", len(summaries))
+	for _, summary := range summaries {
+		fmt.Printf("%s %s (documents: %d, fragments: %d)", summary.Color, summary.Name, summary.DocumentCount, summary.FragmentCount)
+		if len(summary.Synonyms) > 0 {
+			fmt.Printf(" synonyms: %s", strings.Join(summary.Synonyms, ", "))
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func showTagTree(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	roots, err := usecase.NewTagUsecase(database).GetTagTree()
+	if err != nil {
+		return fmt.Errorf("failed to get tag tree: %w", err)
+	}
+
+	if len(roots) == 0 {
+		fmt.Println("No tags found.")
+		return nil
+	}
+
+	for _, root := range roots {
+		printTagNode(root, 0)
+	}
+
+	return nil
+}
+
+// printTagNode はタグとその子タグを深さに応じて字下げして表示する
+func printTagNode(node *usecase.TagNode, depth int) {
+	fmt.Printf("%s%s (documents: %d, fragments: %d)\n", strings.Repeat("  ", depth), node.Name, node.TotalDocumentCount, node.TotalFragmentCount)
+	for _, child := range node.Children {
+		printTagNode(child, depth+1)
+	}
+}
+
+func setTagParent(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	tag, err := usecase.NewTagUsecase(database).SetTagParent(c.String("name"), c.String("parent"))
+	if err != nil {
+		return fmt.Errorf("failed to set tag parent: %w", err)
+	}
+
+	if c.String("parent") == "" {
+		fmt.Printf("Tag %s is now a top-level tag\n", tag.Name)
+	} else {
+		fmt.Printf("Tag %s is now a child of %s\n", tag.Name, c.String("parent"))
+	}
+	return nil
+}
+
+func renameTag(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	tag, err := usecase.NewTagUsecase(database).RenameTag(c.String("name"), c.String("to"))
+	if err != nil {
+		return fmt.Errorf("failed to rename tag: %w", err)
+	}
+
+	fmt.Printf("Tag renamed: %s -> %s\n", c.String("name"), tag.Name)
+	return nil
+}
+
+func mergeTags(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	tag, err := usecase.NewTagUsecase(database).MergeTags(c.String("into"), c.StringSlice("tag"))
+	if err != nil {
+		return fmt.Errorf("failed to merge tags: %w", err)
+	}
+
+	fmt.Printf("Tags merged into %s: %s\n", tag.Name, strings.Join(c.StringSlice("tag"), ", "))
+	fmt.Println("The merged names are kept as synonyms and resolved to this tag from now on.")
+	return nil
+}
+
+func setTagColor(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	tag, err := usecase.NewTagUsecase(database).SetTagColor(c.String("name"), c.String("color"))
+	if err != nil {
+		return fmt.Errorf("failed to set tag color: %w", err)
+	}
+
+	fmt.Printf("Tag color updated: %s %s\n", tag.Name, tag.Color)
+	return nil
+}
+
+func deleteTag(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	if err := usecase.NewTagUsecase(database).DeleteTag(c.String("name")); err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	fmt.Printf("Tag deleted: %s\n", c.String("name"))
+	return nil
+}
+
+func pruneTags(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	deleted, err := usecase.NewTagUsecase(database).DeleteUnusedTags()
+	if err != nil {
+		return fmt.Errorf("failed to delete unused tags: %w", err)
+	}
+
+	if len(deleted) == 0 {
+		fmt.Println("No unused tags found.")
+		return nil
+	}
+	fmt.Printf("Deleted %d unused tags: %s\n", len(deleted), strings.Join(deleted, ", "))
+	return nil
+}
+
+func addTagSynonym(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	synonym, err := usecase.NewTagUsecase(database).AddTagSynonym(c.String("name"), c.String("synonym"))
+	if err != nil {
+		return fmt.Errorf("failed to add synonym: %w", err)
+	}
+
+	fmt.Printf("Synonym added: %s -> %s\n", synonym.Name, c.String("name"))
+	return nil
+}
+
+func removeTagSynonym(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	if err := usecase.NewTagUsecase(database).RemoveTagSynonym(c.String("synonym")); err != nil {
+		return fmt.Errorf("failed to remove synonym: %w", err)
+	}
+
+	fmt.Printf("Synonym removed: %s\n", c.String("synonym"))
+	return nil
+}
+
+func listDocuments(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// ユースケース初期化
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	// 全ドキュメント取得
+	documents, err := documentUsecase.GetAllDocuments()
+	if err != nil {
+		return fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	if len(documents) == 0 {
+		fmt.Println("No documents found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d documents:\n\n", len(documents))
+	for _, doc := range documents {
+		fmt.Printf("ID: %d\n", doc.ID)
+		fmt.Printf("Title: %s\n", doc.Title)
+		fmt.Printf("Summary: %s\n", doc.Summary)
+		fmt.Printf("Created: %s\n", doc.CreatedAt.Format("2006-01-02 15:04:05"))
+		if doc.Locked {
+			fmt.Println("Locked: yes")
+		}
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+func showDocument(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// ユースケース初期化
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	// ドキュメント取得
+	document, err := documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+
+	// 詳細表示
+	fmt.Printf("=== Document ID: %d ===\n", document.ID)
+	fmt.Printf("Title: %s\n", document.Title)
+	fmt.Printf("Summary: %s\n", document.Summary)
+	fmt.Printf("Created: %s\n", document.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Updated: %s\n", document.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if document.EditedByHuman && document.HumanEditedAt != nil {
+		fmt.Printf("Edited by human: %s\n", document.HumanEditedAt.Format("2006-01-02 15:04:05"))
+	}
+	if document.Locked {
+		fmt.Println("Locked: yes (carried over unchanged on regeneration)")
+	}
+	fmt.Println("\n=== Content ===")
+	fmt.Println(document.Content)
+
+	return nil
+}
+
+func createDocument(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// --content がなければエディタで執筆
+	content := c.String("content")
+	if !c.IsSet("content") {
+		content, err = editInEditor(fmt.Sprintf("# %s\n\n", c.String("title")))
+		if err != nil {
+			return err
+		}
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return fmt.Errorf("content must not be empty")
+	}
+
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+
+	tagIDs, err := usecase.NewTagUsecase(database).GetOrCreateTags(c.StringSlice("tag"))
+	if err != nil {
+		return fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	// 人が作成したドキュメントは最新バージョンに追加
+	version, err := documentUsecase.CurrentVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get versions: %w", err)
+	}
+
+	document, err := documentUsecase.CreateDocument(usecase.CreateDocumentInput{
+		Title:            c.String("title"),
+		Summary:          c.String("summary"),
+		Content:          content,
+		VersionCreatedAt: version,
+		TagIDs:           tagIDs,
+		Author:           authorFromFlags(c, user),
+		UserID:           userIDOf(user),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create document: %w", err)
+	}
+
+	fmt.Printf("Document created successfully!\n")
+	fmt.Printf("ID: %d\n", document.ID)
+	fmt.Printf("Title: %s\n", document.Title)
+	fmt.Printf("Version: %s\n", document.VersionCreatedAt.Format("2006-01-02 15:04:05"))
+
+	refreshSuggestedQuestions(ctx, database, document.ID)
+	return nil
+}
+
+func editDocument(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	if id <= 0 {
+		return fmt.Errorf("invalid document ID: %d", id)
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	document, err := documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		return fmt.Errorf("document with ID %d not found", id)
+	}
+
+	input := usecase.UpdateDocumentInput{
+		ID:      document.ID,
+		Title:   document.Title,
+		Summary: document.Summary,
+		Content: document.Content,
+		Author:  authorFromFlags(c, user),
+		UserID:  userIDOf(user),
+	}
+	if c.IsSet("title") {
+		input.Title = strings.TrimSpace(c.String("title"))
+	}
+	if c.IsSet("summary") {
+		input.Summary = strings.TrimSpace(c.String("summary"))
+	}
+	if c.IsSet("tag") {
+		input.TagIDs, err = usecase.NewTagUsecase(database).GetOrCreateTags(c.StringSlice("tag"))
+		if err != nil {
+			return fmt.Errorf("failed to get tags: %w", err)
+		}
+		if input.TagIDs == nil {
+			input.TagIDs = []uint{}
+		}
+	}
+
+	// 他の項目も --content も指定されていなければ本文をエディタで編集
+	switch {
+	case c.IsSet("content"):
+		input.Content = c.String("content")
+	case !c.IsSet("title") && !c.IsSet("summary") && !c.IsSet("tag"):
+		input.Content, err = editInEditor(document.Content)
+		if err != nil {
+			return err
+		}
+	}
+	input.Content = strings.TrimSpace(input.Content)
+	if input.Title == "" || input.Summary == "" || input.Content == "" {
+		return fmt.Errorf("title, summary and content must not be empty")
+	}
+	if input.Title == document.Title && input.Summary == document.Summary && input.Content == document.Content && input.TagIDs == nil {
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	document, err = documentUsecase.UpdateDocument(input)
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	fmt.Printf("Document updated successfully!\n")
+	fmt.Printf("ID: %d\n", document.ID)
+	fmt.Printf("Title: %s\n", document.Title)
+	fmt.Printf("Edited by: %s\n", input.Author)
+
+	refreshSuggestedQuestions(ctx, database, document.ID)
+	return nil
+}
+
+func deleteDocument(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	if id <= 0 {
+		return fmt.Errorf("invalid document ID: %d", id)
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	// ドキュメントが存在するかチェック
+	document, err := documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		return fmt.Errorf("document with ID %d not found", id)
+	}
+
+	if err := documentUsecase.DeleteDocument(document.ID); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	fmt.Printf("Document deleted successfully!\n")
+	fmt.Printf("ID: %d\n", document.ID)
+	fmt.Printf("Title: %s\n", document.Title)
+
+	return nil
+}
+
+func documentHistory(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	documentUsecase := usecase.NewDocumentUsecase(database)
+
+	document, err := documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		return fmt.Errorf("document with ID %d not found", id)
+	}
+
+	revisions, err := documentUsecase.GetDocumentRevisions(document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	fmt.Printf("=== Document #%d: %s ===\n\n", document.ID, document.Title)
+	if len(revisions) == 0 {
+		fmt.Println("No revisions. This document has not been edited by hand.")
+		return nil
+	}
+
+	fmt.Printf("Found %d revisions:\n\n", len(revisions))
+	for _, revision := range revisions {
+		fmt.Printf("Revision: %d by %s (%s)\n", revision.ID, revision.Author, revision.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Title: %s\n", revision.Title)
+		fmt.Printf("Content: %s\n", truncate(revision.Content, 200))
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+// lockDocument は lock / unlock コマンドに応じてドキュメントの固定状態を切り替える
+func lockDocument(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	locked := c.Name == "lock"
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	document, err := usecase.NewDocumentUsecase(database).SetLocked(uint(id), locked)
+	if err != nil {
+		return fmt.Errorf("document with ID %d not found", id)
+	}
+
+	if document.Locked {
+		fmt.Printf("Document locked: %d (%s)\n", document.ID, document.Title)
+		fmt.Println("It will be carried over unchanged when documents are regenerated.")
+	} else {
+		fmt.Printf("Document unlocked: %d (%s)\n", document.ID, document.Title)
+	}
+
+	return nil
+}
+
+// authorFromFlags は --author、なければ --user のユーザー名、$USER の順に編集者名として返す
+func authorFromFlags(c *cli.Command, user *models.User) string {
+	if author := strings.TrimSpace(c.String("author")); author != "" {
+		return author
+	}
+	if user != nil {
+		return user.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "cli"
+}
+
+// cliUser は --user（環境変数 INSIGHT_USER）で指定したユーザーを返す
+// 指定がない場合は $USER と同じ名前のユーザーがいればそのユーザー、いなければ nil（作成者を記録しない）
+func cliUser(c *cli.Command, database *gorm.DB) (*models.User, error) {
+	userUsecase := usecase.NewUserUsecase(database)
+	if username := strings.TrimSpace(c.String("user")); username != "" {
+		user, err := userUsecase.GetUserByUsername(username)
+		if err != nil {
+			return nil, fmt.Errorf("user '%s' not found (create it with: insight user create --username %s)", username, username)
+		}
+		return user, nil
+	}
+	if name := os.Getenv("USER"); name != "" {
+		if user, err := userUsecase.GetUserByUsername(name); err == nil {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+// userIDOf は記録用にユーザーのIDを返す（ユーザーがいない場合はnil）
+func userIDOf(user *models.User) *uint {
+	if user == nil {
+		return nil
+	}
+	return &user.ID
+}
+
+// refreshSuggestedQuestions は編集したドキュメントの質問候補を再生成する（失敗しても編集は完了している）
+func refreshSuggestedQuestions(ctx context.Context, database *gorm.DB, documentID uint) {
+	aiService, err := ai.NewService(database)
+	if err == nil {
+		err = aiService.RefreshSuggestedQuestions(ctx, []uint{documentID})
+	}
+	if err != nil {
+		fmt.Printf("Suggested questions were not updated: %v\n", err)
+	}
+}
+
+func createDocuments(ctx context.Context, c *cli.Command) error {
+	fmt.Printf("Creating documents from fragments using AI...\n\n")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	// 対象範囲を指定した場合はスコープ付きのバージョンとして作成
+	scope, err := generationScopeFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	// 生成パラメータ（指示・想定読者・スタイル・粒度・ドキュメント数）
+	options := usecase.GenerationOptions{
+		Instructions:    strings.TrimSpace(c.String("instructions")),
+		Audience:        strings.TrimSpace(c.String("audience")),
+		Style:           c.String("style"),
+		Granularity:     c.String("granularity"),
+		TargetDocuments: c.Int("documents"),
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	// ドキュメント作成
+	err = aiService.CreateDocuments(ctx, scope, options)
+	if err != nil {
+		return fmt.Errorf("failed to create documents: %w", err)
+	}
+
+	return nil
+}
+
+func suggestQuestions(ctx context.Context, c *cli.Command) error {
+	var documentIDs []uint
+	for _, id := range c.IntSlice("id") {
+		documentIDs = append(documentIDs, uint(id))
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	// 本文が変わったドキュメントのみ再生成
+	if err := aiService.RefreshSuggestedQuestions(ctx, documentIDs); err != nil {
+		return fmt.Errorf("failed to suggest questions: %w", err)
+	}
+
+	return nil
+}
+
+func autoTagFragments(ctx context.Context, c *cli.Command) error {
+	var fragmentIDs []uint
+	for _, id := range c.IntSlice("id") {
+		fragmentIDs = append(fragmentIDs, uint(id))
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	results, err := aiService.AutoTagFragments(ctx, fragmentIDs, c.Bool("all"))
+	if err != nil {
+		return fmt.Errorf("failed to tag fragments: %w", err)
+	}
+
+	var newTags []string
+	for _, result := range results {
+		fmt.Printf("✓ Fragment %d: %s\n", result.FragmentID, strings.Join(result.Tags, ", "))
+		newTags = append(newTags, result.NewTags...)
+	}
+	fmt.Printf("\nTagged %d fragments", len(results))
+	if len(newTags) > 0 {
+		fmt.Printf(" (new tags: %s)", strings.Join(newTags, ", "))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func regenerateDocument(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	document, err := aiService.RegenerateDocument(ctx, uint(id), c.String("instructions"))
+	if err != nil {
+		return fmt.Errorf("failed to regenerate document: %w", err)
+	}
+
+	fmt.Printf("\nDocument regenerated successfully!\n")
+	fmt.Printf("ID: %d\n", document.ID)
+	fmt.Printf("Title: %s\n", document.Title)
+	fmt.Printf("Summary: %s\n", document.Summary)
+	fmt.Printf("The previous content is kept in the revision history (insight document history --id %d).\n", document.ID)
+
+	return nil
+}
+
+func compressFragments(ctx context.Context, c *cli.Command) error {
+	fmt.Printf("Compressing fragments using AI...\n\n")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	// フラグメント圧縮（実行したユーザーを適用の承認者として記録する）
+	err = aiService.CompressFragments(ctx, userIDOf(user))
+	if err != nil {
+		return fmt.Errorf("failed to compress fragments: %w", err)
+	}
+
+	return nil
+}
+
+func consolidateTags(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create AI service: %w", err)
+	}
+
+	proposals, err := aiService.ProposeTagMerges(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to propose tag merges: %w", err)
+	}
+	if len(proposals) == 0 {
+		fmt.Println("No tags to consolidate.")
+		return nil
+	}
+
+	fmt.Printf("Found %d proposals:\n\n", len(proposals))
+	tagUsecase := usecase.NewTagUsecase(database)
+	scanner := bufio.NewScanner(os.Stdin)
+	var applied int
+	for i, proposal := range proposals {
+		fmt.Printf("%d. %s <- %s\n   %s\n", i+1, proposal.Canonical, strings.Join(proposal.Tags, ", "), proposal.Reason)
+		if c.Bool("dry-run") {
+			continue
+		}
+
+		// 1件ずつ確認してから適用する（--yes の場合は確認しない）
+		if !c.Bool("yes") {
+			fmt.Print("   Apply? [y/N/q] ")
+			if !scanner.Scan() {
+				break
+			}
+			answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if answer == "q" {
+				break
+			}
+			if answer != "y" && answer != "yes" {
+				continue
+			}
+		}
+
+		if _, err := tagUsecase.MergeTags(proposal.Canonical, proposal.Tags); err != nil {
+			fmt.Printf("   Failed to merge: %v\n", err)
+			continue
+		}
+		fmt.Printf("   ✓ Merged into %s\n", proposal.Canonical)
+		applied++
+	}
+
+	if !c.Bool("dry-run") {
+		fmt.Printf("\nApplied %d of %d proposals. Merged names are kept as synonyms.\n", applied, len(proposals))
+	}
+	return nil
+}
+
+func listFragments(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// --author で作成したユーザーに絞り込む
+	var authorID uint
+	if author := strings.TrimSpace(c.String("author")); author != "" {
+		user, err := usecase.NewUserUsecase(database).GetUserByUsername(author)
+		if err != nil {
+			return fmt.Errorf("user '%s' not found", author)
+		}
+		authorID = user.ID
+	}
+
+	// フラグメント取得
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+	fragments, err := fragmentUsecase.GetFragmentsByTags(c.StringSlice("tag"), authorID)
+	if err != nil {
+		return fmt.Errorf("failed to get fragments: %w", err)
+	}
+
+	if len(fragments) == 0 {
+		fmt.Println("No fragments found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d fragments:\n\n", len(fragments))
+	for _, fragment := range fragments {
+		fmt.Printf("ID: %d\n", fragment.ID)
+		fmt.Printf("Content: %s\n", fragment.Content)
+		if len(fragment.Tags) > 0 {
+			fmt.Printf("Tags: %s\n", strings.Join(tagNames(fragment.Tags), ", "))
+		}
+		if fragment.User != nil {
+			fmt.Printf("Author: %s\n", fragment.User.Username)
+		}
+		fmt.Printf("Created: %s\n", fragment.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+// tagFragment は add / remove コマンドに応じてフラグメントのタグを付け外しする
+func tagFragment(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+	var fragment *models.Fragment
+	if c.Name == "add" {
+		fragment, err = fragmentUsecase.AddFragmentTags(uint(id), c.StringSlice("tag"))
+	} else {
+		fragment, err = fragmentUsecase.RemoveFragmentTags(uint(id), c.StringSlice("tag"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update tags of fragment %d: %w", id, err)
+	}
+
+	fmt.Printf("Fragment %d tags: %s\n", fragment.ID, strings.Join(tagNames(fragment.Tags), ", "))
+	return nil
+}
+
+// tagNames はタグ名の一覧を返す
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+func deleteFragment(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	if id <= 0 {
+		return fmt.Errorf("invalid fragment ID: %d", id)
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+
+	// フラグメントが存在するかチェック
+	fragment, err := fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		return fmt.Errorf("fragment with ID %d not found", id)
+	}
+
+	// 削除実行
+	err = fragmentUsecase.DeleteFragment(uint(id))
+	if err != nil {
+		return fmt.Errorf("failed to delete fragment: %w", err)
+	}
+
+	fmt.Printf("Fragment deleted successfully!\n")
+	fmt.Printf("ID: %d\n", fragment.ID)
+	fmt.Printf("Content: %s\n", fragment.Content)
+
+	return nil
+}
+
+func editFragment(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	if id <= 0 {
+		return fmt.Errorf("invalid fragment ID: %d", id)
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+
+	fragment, err := fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		return fmt.Errorf("fragment with ID %d not found", id)
+	}
+
+	// --content がなければエディタで編集
+	content := c.String("content")
+	if !c.IsSet("content") {
+		content, err = editInEditor(fragment.Content)
+		if err != nil {
+			return err
+		}
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return fmt.Errorf("content must not be empty")
+	}
+	if content == fragment.Content {
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	fragment, err = fragmentUsecase.UpdateFragment(usecase.UpdateFragmentInput{
+		ID:      uint(id),
+		Content: content,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update fragment: %w", err)
+	}
+
+	fmt.Printf("Fragment updated successfully!\n")
+	fmt.Printf("ID: %d\n", fragment.ID)
+	fmt.Printf("Content: %s\n", fragment.Content)
+
+	return nil
+}
+
+// editInEditor は $EDITOR（未設定の場合は vi）で一時ファイルを編集し、編集後の内容を返す
+func editInEditor(initial string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "insight-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(initial); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	file.Close()
+
+	// EDITOR に引数が含まれる場合（例: "code --wait"）に対応
+	args := append(strings.Fields(editor), file.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor exited with error: %w", err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read temp file: %w", err)
+	}
+	return string(content), nil
+}
+
+func fragmentHistory(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	fragmentUsecase := usecase.NewFragmentUsecase(database)
+
+	fragment, err := fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		return fmt.Errorf("fragment with ID %d not found", id)
+	}
+
+	revisions, err := fragmentUsecase.GetFragmentRevisions(fragment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	fmt.Printf("=== Fragment #%d (current, updated %s) ===\n", fragment.ID, fragment.UpdatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("%s\n\n", fragment.Content)
+
+	if len(revisions) == 0 {
+		fmt.Println("No revisions.")
+		return nil
+	}
+
+	fmt.Printf("Found %d revisions:\n\n", len(revisions))
+	for _, revision := range revisions {
+		fmt.Printf("Revision: %d (replaced %s)\n", revision.ID, revision.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Content: %s\n", revision.Content)
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+func restoreFragment(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+	revisionID := c.Int("revision")
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	fragment, err := usecase.NewFragmentUsecase(database).RestoreFragmentRevision(uint(id), uint(revisionID))
+	if err != nil {
+		return fmt.Errorf("failed to restore fragment: %w", err)
+	}
+
+	fmt.Printf("Fragment restored from revision %d!\n", revisionID)
+	fmt.Printf("ID: %d\n", fragment.ID)
+	fmt.Printf("Content: %s\n", fragment.Content)
+
+	return nil
+}
+
+func search(ctx context.Context, c *cli.Command) error {
+	query := strings.TrimSpace(strings.Join(c.Args().Slice(), " "))
+	if query == "" {
+		return fmt.Errorf("search query is required")
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	if c.Bool("semantic") {
+		// セマンティック検索
+		aiService, err := ai.NewService(database)
+		if err != nil {
+			return fmt.Errorf("failed to create AI service: %w", err)
+		}
+
+		// CLIには常駐プロセスがないため、検索前に変更分をインデックスへ反映する
+		if err := aiService.RefreshSemanticIndex(ctx); err != nil {
+			return fmt.Errorf("failed to refresh semantic index: %w", err)
+		}
+
+		hits, err := aiService.SemanticSearch(ctx, query, ai.SemanticSearchOptions{Limit: c.Int("limit")})
+		if err != nil {
+			return fmt.Errorf("failed to search: %w", err)
+		}
+
+		if len(hits) == 0 {
+			fmt.Println("No results found.")
+			return nil
+		}
+
+		fmt.Printf("Found %d results for %q:\n\n", len(hits), query)
+		for _, hit := range hits {
+			fmt.Printf("[%s] ID: %d  Score: %.4f\n", hit.Type, hit.ID, hit.Score)
+			fmt.Printf("Title: %s\n", hit.Title)
+			fmt.Printf("Snippet: %s\n", hit.Snippet)
+			fmt.Println("---")
+		}
+		return nil
+	}
+
+	// キーワード検索（全文検索インデックス）
+	searchUsecase := usecase.NewSearchUsecase(database)
+
+	var since, until *time.Time
+	if value := c.String("since"); value != "" {
+		t, err := usecase.ParseDate(value)
+		if err != nil {
+			return err
+		}
+		since = &t
+	}
+	if value := c.String("until"); value != "" {
+		t, err := usecase.ParseDateUntil(value)
+		if err != nil {
+			return err
+		}
+		until = &t
+	}
+
+	if c.Bool("fragments") {
+		result, err := searchUsecase.SearchFragments(usecase.SearchFragmentsInput{
+			Query:   query,
+			Tags:    c.StringSlice("tag"),
+			Since:   since,
+			Until:   until,
+			Page:    c.Int("page"),
+			PerPage: c.Int("limit"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to search fragments: %w", err)
+		}
+
+		if len(result.Hits) == 0 {
+			fmt.Println("No results found.")
+			return nil
+		}
+
+		fmt.Printf("Found %d fragments for %q (page %d):\n\n", result.Total, query, result.Page)
+		for _, hit := range result.Hits {
+			fmt.Printf("ID: %d  Score: %.4f\n", hit.ID, hit.Score)
+			fmt.Printf("Snippet: %s\n", plainSnippet(hit.Snippet))
+			fmt.Printf("Created: %s\n", hit.CreatedAt.Format("2006-01-02 15:04:05"))
+			fmt.Println("---")
+		}
+		return nil
+	}
+
+	input := usecase.SearchDocumentsInput{
+		Query:   query,
+		Tags:    c.StringSlice("tag"),
+		Since:   since,
+		Until:   until,
+		Page:    c.Int("page"),
+		PerPage: c.Int("limit"),
+	}
+	if value := c.String("version"); value != "" {
+		version, err := usecase.ParseVersion(value)
+		if err != nil {
+			return err
+		}
+		input.Version = &version
+	}
+
+	result, err := searchUsecase.SearchDocuments(input)
+	if err != nil {
+		return fmt.Errorf("failed to search documents: %w", err)
+	}
+
+	if len(result.Hits) == 0 {
+		fmt.Println("No results found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d documents for %q (page %d):\n\n", result.Total, query, result.Page)
+	for _, hit := range result.Hits {
+		fmt.Printf("ID: %d  Score: %.4f\n", hit.ID, hit.Score)
+		fmt.Printf("Title: %s\n", hit.Title)
+		fmt.Printf("Snippet: %s\n", plainSnippet(hit.Snippet))
+		fmt.Printf("Version: %s\n", hit.VersionCreatedAt.Format("2006-01-02 15:04:05.999999-07:00"))
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+// plainSnippet はHTMLスニペットを端末表示用に変換する（ハイライトは[]で表示）
+func chat(ctx context.Context, c *cli.Command) error {
+	documentID := uint(c.Int("document-id"))
+	conversationID := uint(c.Int("conversation-id"))
+	useWebSearch := c.Bool("web-search")
+	useAgent := c.Bool("agent")
+
+	scope, err := globalScopeFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	defer db.Close(database)
 
-	if err := app.Run(context.Background(), os.Args); err != nil {
-		log.Fatal(err)
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+	userID := userIDOf(user)
+
+	// QAサービス初期化
+	qaService, err := ai.NewQAService(database)
+	if err != nil {
+		return fmt.Errorf("failed to create QA service: %w", err)
+	}
+
+	// 既存の会話を再開する場合は履歴を表示
+	if conversationID != 0 {
+		conversation, err := usecase.NewConversationUsecase(database).GetConversation(conversationID)
+		if err != nil {
+			return fmt.Errorf("failed to get conversation: %w", err)
+		}
+		fmt.Printf("=== Conversation #%d: %s ===\n", conversation.ID, conversation.Title)
+		printMessages(conversation.Messages)
+	}
+
+	fmt.Println("Type your question. Commands: /new (start a new thread), /exit (quit)")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		question := strings.TrimSpace(scanner.Text())
+		switch question {
+		case "":
+			continue
+		case "/exit", "/quit":
+			return nil
+		case "/new":
+			conversationID = 0
+			fmt.Println("Started a new conversation.")
+			continue
+		}
+
+		// 会話の続きかどうかで呼び出しを切り替える
+		var response *ai.QAResponse
+		switch {
+		case conversationID != 0:
+			response, err = qaService.ContinueConversation(ctx, ai.ConversationRequest{
+				ConversationID: conversationID,
+				Question:       question,
+				UseWebSearch:   useWebSearch,
+				UserID:         userID,
+			})
+		case useAgent:
+			response, err = qaService.AskWithTools(ctx, ai.AgentQARequest{
+				Question: question,
+				UserID:   userID,
+			})
+		case documentID != 0:
+			response, err = qaService.AskQuestion(ctx, ai.QARequest{
+				DocumentID:   documentID,
+				Question:     question,
+				UseWebSearch: useWebSearch,
+				UserID:       userID,
+			})
+		default:
+			globalReq := scope
+			globalReq.Question = question
+			globalReq.UseWebSearch = useWebSearch
+			globalReq.UserID = userID
+			response, err = qaService.AskGlobalQuestion(ctx, globalReq)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+
+		if response.ConversationID != 0 {
+			conversationID = response.ConversationID
+		}
+
+		fmt.Println()
+		printAnswer(response)
 	}
+
+	return scanner.Err()
 }
 
-func createFragment(ctx context.Context, c *cli.Command) error {
-	content := c.String("content")
+func ask(ctx context.Context, c *cli.Command) error {
+	question := strings.TrimSpace(strings.Join(c.Args().Slice(), " "))
+	if question == "" {
+		return fmt.Errorf("question is required")
+	}
 
 	// データベース初期化
 	database, err := db.Init(nil)
@@ -111,28 +2241,166 @@ func createFragment(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// ユースケース初期化
-	fragmentUsecase := usecase.NewFragmentUsecase(database)
-
-	// Fragment作成
-	input := usecase.CreateFragmentInput{
-		Content: content,
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
 	}
+	userID := userIDOf(user)
 
-	fragment, err := fragmentUsecase.CreateFragment(input)
+	// QAサービス初期化
+	qaService, err := ai.NewQAService(database)
 	if err != nil {
-		return fmt.Errorf("failed to create fragment: %w", err)
+		return fmt.Errorf("failed to create QA service: %w", err)
 	}
 
-	fmt.Printf("Fragment created successfully!\n")
-	fmt.Printf("ID: %d\n", fragment.ID)
-	fmt.Printf("Content: %s\n", fragment.Content)
-	fmt.Printf("Created at: %s\n", fragment.CreatedAt.Format("2006-01-02 15:04:05"))
+	var response *ai.QAResponse
+	if c.Bool("agent") {
+		response, err = qaService.AskWithTools(ctx, ai.AgentQARequest{
+			Question: question,
+			MaxSteps: c.Int("max-steps"),
+			UserID:   userID,
+		})
+	} else if c.Bool("fragments") {
+		req, scopeErr := fragmentScopeFromFlags(c)
+		if scopeErr != nil {
+			return scopeErr
+		}
+		req.Question = question
+		req.UseWebSearch = c.Bool("web-search")
+		req.UserID = userID
+		response, err = qaService.AskFragmentQuestion(ctx, req)
+	} else if documentID := c.Int("document-id"); documentID != 0 {
+		response, err = qaService.AskQuestion(ctx, ai.QARequest{
+			DocumentID:   uint(documentID),
+			Question:     question,
+			UseWebSearch: c.Bool("web-search"),
+			UserID:       userID,
+		})
+	} else {
+		req, scopeErr := globalScopeFromFlags(c)
+		if scopeErr != nil {
+			return scopeErr
+		}
+		req.Question = question
+		req.UseWebSearch = c.Bool("web-search")
+		req.UserID = userID
+		response, err = qaService.AskGlobalQuestion(ctx, req)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to answer question: %w", err)
+	}
 
+	printAnswer(response)
 	return nil
 }
 
-func listDocuments(ctx context.Context, c *cli.Command) error {
+// globalScopeFromFlags は --version / --tag / --ids から質問の対象範囲を組み立てる
+func globalScopeFromFlags(c *cli.Command) (ai.GlobalQARequest, error) {
+	req := ai.GlobalQARequest{
+		Tags: c.StringSlice("tag"),
+	}
+	if value := c.String("version"); value != "" {
+		version, err := usecase.ParseVersion(value)
+		if err != nil {
+			return req, err
+		}
+		req.Version = &version
+	}
+	for _, id := range c.IntSlice("ids") {
+		req.DocumentIDs = append(req.DocumentIDs, uint(id))
+	}
+	return req, nil
+}
+
+// fragmentScopeFromFlags は --since / --until / --tag からフラグメント質問の対象範囲を組み立てる
+func fragmentScopeFromFlags(c *cli.Command) (ai.FragmentQARequest, error) {
+	req := ai.FragmentQARequest{
+		Tags: c.StringSlice("tag"),
+	}
+	if value := c.String("since"); value != "" {
+		since, err := usecase.ParseDate(value)
+		if err != nil {
+			return req, fmt.Errorf("invalid since: %w", err)
+		}
+		req.Since = &since
+	}
+	if value := c.String("until"); value != "" {
+		until, err := usecase.ParseDateUntil(value)
+		if err != nil {
+			return req, fmt.Errorf("invalid until: %w", err)
+		}
+		req.Until = &until
+	}
+	return req, nil
+}
+
+// generationScopeFromFlags は --tag / --since / --until / --ids からドキュメント生成の対象範囲を組み立てる
+func generationScopeFromFlags(c *cli.Command) (usecase.GenerationScope, error) {
+	scope := usecase.GenerationScope{
+		Tags: c.StringSlice("tag"),
+	}
+	if value := c.String("since"); value != "" {
+		since, err := usecase.ParseDate(value)
+		if err != nil {
+			return scope, fmt.Errorf("invalid since: %w", err)
+		}
+		scope.Since = &since
+	}
+	if value := c.String("until"); value != "" {
+		until, err := usecase.ParseDateUntil(value)
+		if err != nil {
+			return scope, fmt.Errorf("invalid until: %w", err)
+		}
+		scope.Until = &until
+	}
+	for _, id := range c.IntSlice("ids") {
+		scope.FragmentIDs = append(scope.FragmentIDs, uint(id))
+	}
+	return scope, nil
+}
+
+// printAnswer は回答と引用、対象範囲を表示する
+func printAnswer(response *ai.QAResponse) {
+	if len(response.ToolTrace) > 0 {
+		fmt.Println("Tool trace:")
+		for _, call := range response.ToolTrace {
+			result := call.Result
+			if call.Error != "" {
+				result = "error: " + call.Error
+			}
+			fmt.Printf("  %d. %s %v -> %s\n", call.Step, call.Name, call.Args, result)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%s\n\n", response.Answer)
+	for _, citation := range response.Citations {
+		label := citation.DocumentTitle
+		if label == "" {
+			label = fmt.Sprintf("Fragment #%d", citation.FragmentID)
+		}
+		fmt.Printf("  [%d] %s (%s)\n", citation.Marker, label, citation.URL)
+	}
+	for _, source := range response.WebSources {
+		fmt.Printf("  ↗ %s (%s)\n", source.Title, source.URL)
+	}
+	if len(response.Citations) > 0 || len(response.WebSources) > 0 {
+		fmt.Println()
+	}
+	if response.Scope != nil {
+		if response.Scope.Type == models.QAScopeFragments {
+			fmt.Printf("Scope: %s (%d fragments)\n", response.Scope.Description, response.Scope.FragmentCount)
+		} else {
+			fmt.Printf("Scope: %s (%d documents)\n", response.Scope.Description, response.Scope.DocumentCount)
+		}
+	}
+	fmt.Printf("Confidence: %s", response.Confidence)
+	if response.ExchangeID != 0 {
+		fmt.Printf(" | Exchange ID: %d", response.ExchangeID)
+	}
+	fmt.Printf("\n\n")
+}
+
+func listConversations(ctx context.Context, c *cli.Command) error {
 	// データベース初期化
 	database, err := db.Init(nil)
 	if err != nil {
@@ -140,33 +2408,37 @@ func listDocuments(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// ユースケース初期化
-	documentUsecase := usecase.NewDocumentUsecase(database)
-
-	// 全ドキュメント取得
-	documents, err := documentUsecase.GetAllDocuments()
+	conversations, err := usecase.NewConversationUsecase(database).GetAllConversations()
 	if err != nil {
-		return fmt.Errorf("failed to get documents: %w", err)
+		return fmt.Errorf("failed to get conversations: %w", err)
 	}
 
-	if len(documents) == 0 {
-		fmt.Println("No documents found.")
+	if len(conversations) == 0 {
+		fmt.Println("No conversations found")
 		return nil
 	}
 
-	fmt.Printf("Found %d documents:\n\n", len(documents))
-	for _, doc := range documents {
-		fmt.Printf("ID: %d\n", doc.ID)
-		fmt.Printf("Title: %s\n", doc.Title)
-		fmt.Printf("Summary: %s\n", doc.Summary)
-		fmt.Printf("Created: %s\n", doc.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Found %d conversations:\n\n", len(conversations))
+	for _, conversation := range conversations {
+		scope := "documents"
+		if conversation.DocumentID != nil {
+			scope = fmt.Sprintf("document #%d", *conversation.DocumentID)
+		} else if conversation.Scope == models.QAScopeFragments {
+			scope = "fragments"
+		} else if conversation.Scope == models.QAScopeAgent {
+			scope = "tool use"
+		}
+		fmt.Printf("ID: %d\n", conversation.ID)
+		fmt.Printf("Title: %s\n", conversation.Title)
+		fmt.Printf("Scope: %s\n", scope)
+		fmt.Printf("Updated: %s\n", conversation.UpdatedAt.Format("2006-01-02 15:04:05"))
 		fmt.Println("---")
 	}
 
 	return nil
 }
 
-func showDocument(ctx context.Context, c *cli.Command) error {
+func showConversation(ctx context.Context, c *cli.Command) error {
 	id := c.Int("id")
 
 	// データベース初期化
@@ -176,29 +2448,55 @@ func showDocument(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// ユースケース初期化
-	documentUsecase := usecase.NewDocumentUsecase(database)
+	conversation, err := usecase.NewConversationUsecase(database).GetConversation(uint(id))
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
 
-	// ドキュメント取得
-	document, err := documentUsecase.GetDocument(uint(id))
+	fmt.Printf("=== Conversation ID: %d ===\n", conversation.ID)
+	fmt.Printf("Title: %s\n", conversation.Title)
+	fmt.Printf("Created: %s\n", conversation.CreatedAt.Format("2006-01-02 15:04:05"))
+	printMessages(conversation.Messages)
+
+	return nil
+}
+
+func deleteConversation(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
+
+	// データベース初期化
+	database, err := db.Init(nil)
 	if err != nil {
-		return fmt.Errorf("failed to get document: %w", err)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	defer db.Close(database)
 
-	// 詳細表示
-	fmt.Printf("=== Document ID: %d ===\n", document.ID)
-	fmt.Printf("Title: %s\n", document.Title)
-	fmt.Printf("Summary: %s\n", document.Summary)
-	fmt.Printf("Created: %s\n", document.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("Updated: %s\n", document.UpdatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Println("\n=== Content ===")
-	fmt.Println(document.Content)
+	conversationUsecase := usecase.NewConversationUsecase(database)
+	if _, err := conversationUsecase.GetConversation(uint(id)); err != nil {
+		return fmt.Errorf("conversation with ID %d not found: %w", id, err)
+	}
+
+	if err := conversationUsecase.DeleteConversation(uint(id)); err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
 
+	fmt.Printf("Conversation deleted successfully: ID=%d\n", id)
 	return nil
 }
 
-func createDocuments(ctx context.Context, c *cli.Command) error {
-	fmt.Printf("Creating documents from fragments using AI...\n\n")
+func listQAHistory(ctx context.Context, c *cli.Command) error {
+	input := usecase.QAHistoryInput{
+		Scope:      c.String("scope"),
+		DocumentID: uint(c.Int("document-id")),
+		Limit:      c.Int("limit"),
+	}
+	if value := c.String("feedback"); value != "" {
+		rating, err := parseRating(value)
+		if err != nil {
+			return err
+		}
+		input.Feedback = &rating
+	}
 
 	// データベース初期化
 	database, err := db.Init(nil)
@@ -207,23 +2505,69 @@ func createDocuments(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// AIサービス初期化
-	aiService, err := ai.NewService(database)
+	exchanges, err := usecase.NewQAExchangeUsecase(database).GetHistory(input)
 	if err != nil {
-		return fmt.Errorf("failed to create AI service: %w", err)
+		return fmt.Errorf("failed to get QA history: %w", err)
 	}
 
-	// ドキュメント作成
-	err = aiService.CreateDocuments(ctx)
+	if len(exchanges) == 0 {
+		fmt.Println("No Q&A exchanges found")
+		return nil
+	}
+
+	fmt.Printf("Found %d exchanges:\n\n", len(exchanges))
+	for _, exchange := range exchanges {
+		scope := "documents"
+		if exchange.DocumentID != nil {
+			scope = fmt.Sprintf("document #%d", *exchange.DocumentID)
+		} else if exchange.Scope == models.QAScopeFragments {
+			scope = "fragments"
+		} else if exchange.Scope == models.QAScopeAgent {
+			scope = "tool use"
+		}
+		fmt.Printf("ID: %d (%s, %s)\n", exchange.ID, scope, exchange.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Q: %s\n", exchange.Question)
+		fmt.Printf("A: %s\n", truncate(exchange.Answer, 200))
+		if exchange.Feedback != 0 {
+			fmt.Printf("Feedback: %s %s\n", ratingLabel(exchange.Feedback), exchange.FeedbackComment)
+		}
+		if exchange.FragmentID != nil {
+			fmt.Printf("Saved as fragment: #%d\n", *exchange.FragmentID)
+		}
+		fmt.Println("---")
+	}
+
+	return nil
+}
+
+func setQAFeedback(ctx context.Context, c *cli.Command) error {
+	rating, err := parseRating(c.String("rating"))
 	if err != nil {
-		return fmt.Errorf("failed to create documents: %w", err)
+		return err
+	}
+
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	exchange, err := usecase.NewQAExchangeUsecase(database).SetFeedback(usecase.SetFeedbackInput{
+		ExchangeID: uint(c.Int("id")),
+		Rating:     rating,
+		Comment:    c.String("comment"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save feedback: %w", err)
 	}
 
+	fmt.Printf("Feedback saved: ID=%d %s\n", exchange.ID, ratingLabel(exchange.Feedback))
 	return nil
 }
 
-func compressFragments(ctx context.Context, c *cli.Command) error {
-	fmt.Printf("Compressing fragments using AI...\n\n")
+func saveQAAsFragment(ctx context.Context, c *cli.Command) error {
+	id := c.Int("id")
 
 	// データベース初期化
 	database, err := db.Init(nil)
@@ -232,22 +2576,73 @@ func compressFragments(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// AIサービス初期化
-	aiService, err := ai.NewService(database)
+	user, err := cliUser(c, database)
 	if err != nil {
-		return fmt.Errorf("failed to create AI service: %w", err)
+		return err
 	}
 
-	// フラグメント圧縮
-	err = aiService.CompressFragments(ctx)
+	fragment, err := usecase.NewQAExchangeUsecase(database).SaveAsFragment(uint(id), userIDOf(user))
 	if err != nil {
-		return fmt.Errorf("failed to compress fragments: %w", err)
+		return fmt.Errorf("failed to save answer as fragment: %w", err)
 	}
 
+	fmt.Printf("Answer saved as fragment!\n")
+	fmt.Printf("Fragment ID: %d\n", fragment.ID)
+	fmt.Printf("Content: %s\n", truncate(fragment.Content, 200))
+
 	return nil
 }
 
-func listFragments(ctx context.Context, c *cli.Command) error {
+// parseRating はup/down/noneを評価値に変換する
+func parseRating(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "up", "1", "+1":
+		return models.FeedbackUp, nil
+	case "down", "-1":
+		return models.FeedbackDown, nil
+	case "none", "0":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid rating %q (use up, down or none)", value)
+}
+
+func ratingLabel(rating int) string {
+	switch rating {
+	case models.FeedbackUp:
+		return "👍"
+	case models.FeedbackDown:
+		return "👎"
+	}
+	return "-"
+}
+
+// truncate は長いテキストを指定文字数で切り詰める
+func truncate(text string, limit int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "..."
+}
+
+// printMessages は会話のメッセージを時系列順に表示する
+func printMessages(messages []models.Message) {
+	for _, message := range messages {
+		label := "You"
+		if message.Role == models.MessageRoleAssistant {
+			label = "Insight"
+		}
+		fmt.Printf("\n[%s] %s\n%s\n", message.CreatedAt.Format("15:04:05"), label, message.Content)
+	}
+	fmt.Println()
+}
+
+func plainSnippet(snippet string) string {
+	replacer := strings.NewReplacer("<mark>", "[", "</mark>", "]")
+	return html.UnescapeString(replacer.Replace(snippet))
+}
+
+func listAPITokens(ctx context.Context, c *cli.Command) error {
 	// データベース初期化
 	database, err := db.Init(nil)
 	if err != nil {
@@ -255,35 +2650,94 @@ func listFragments(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	// フラグメント取得
-	fragmentUsecase := usecase.NewFragmentUsecase(database)
-	fragments, err := fragmentUsecase.GetAllFragments()
+	tokens, err := usecase.NewAuthUsecase(database).GetAllAPITokens()
 	if err != nil {
-		return fmt.Errorf("failed to get fragments: %w", err)
+		return fmt.Errorf("failed to get tokens: %w", err)
 	}
 
-	if len(fragments) == 0 {
-		fmt.Println("No fragments found.")
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens found. Create one with: insight token create --user <username> --name <name> --scope read")
 		return nil
 	}
 
-	fmt.Printf("Found %d fragments:\n\n", len(fragments))
-	for _, fragment := range fragments {
-		fmt.Printf("ID: %d\n", fragment.ID)
-		fmt.Printf("Content: %s\n", fragment.Content)
-		fmt.Printf("Created: %s\n", fragment.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Found %d API tokens:\n\n", len(tokens))
+	for _, token := range tokens {
+		fmt.Printf("ID: %d\n", token.ID)
+		fmt.Printf("Name: %s\n", token.Name)
+		if token.User != nil {
+			fmt.Printf("User: %s (%s)\n", token.User.Username, token.User.Role)
+		} else {
+			fmt.Println("User: none (unusable; create a new token with --user)")
+		}
+		fmt.Printf("Token: %s...\n", token.Prefix)
+		fmt.Printf("Scopes: %s\n", strings.Join(token.Scopes, ", "))
+		fmt.Printf("Created: %s\n", token.CreatedAt.Format("2006-01-02 15:04:05"))
+		if token.ExpiresAt != nil {
+			status := ""
+			if !token.ExpiresAt.After(time.Now()) {
+				status = " (expired)"
+			}
+			fmt.Printf("Expires: %s%s\n", token.ExpiresAt.Format("2006-01-02 15:04:05"), status)
+		}
+		if token.LastUsedAt != nil {
+			fmt.Printf("Last used: %s\n", token.LastUsedAt.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Println("Last used: never")
+		}
 		fmt.Println("---")
 	}
 
 	return nil
 }
 
-func deleteFragment(ctx context.Context, c *cli.Command) error {
-	id := c.Int("id")
-	if id <= 0 {
-		return fmt.Errorf("invalid fragment ID: %d", id)
+func createAPIToken(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	// トークンは --user で指定したユーザーのものとして作成する
+	user, err := cliUser(c, database)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("specify the owner of the token with --user")
+	}
+
+	input := usecase.CreateAPITokenInput{
+		Name:   c.String("name"),
+		UserID: user.ID,
+		Scopes: c.StringSlice("scope"),
+	}
+	if days := c.Int("expires-in"); days < 0 {
+		return fmt.Errorf("--expires-in must not be negative")
+	} else if days > 0 {
+		expiresAt := time.Now().AddDate(0, 0, int(days))
+		input.ExpiresAt = &expiresAt
+	}
+
+	token, raw, err := usecase.NewAuthUsecase(database).CreateAPIToken(input)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	fmt.Printf("API token created: %s (ID: %d, user: %s, scopes: %s)\n", token.Name, token.ID, user.Username, strings.Join(token.Scopes, ", "))
+	if token.ExpiresAt != nil {
+		fmt.Printf("Expires: %s\n", token.ExpiresAt.Format("2006-01-02 15:04:05"))
 	}
+	fmt.Println()
+	fmt.Println(raw)
+	fmt.Println()
+	fmt.Println("Store this token now; it cannot be shown again.")
+	fmt.Println("Use it as \"Authorization: Bearer <token>\" or log in to the web UI with it.")
+
+	return nil
+}
 
+func revokeAPIToken(ctx context.Context, c *cli.Command) error {
 	// データベース初期化
 	database, err := db.Init(nil)
 	if err != nil {
@@ -291,23 +2745,101 @@ func deleteFragment(ctx context.Context, c *cli.Command) error {
 	}
 	defer db.Close(database)
 
-	fragmentUsecase := usecase.NewFragmentUsecase(database)
+	token, err := usecase.NewAuthUsecase(database).RevokeAPIToken(uint(c.Int("id")))
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
 
-	// フラグメントが存在するかチェック
-	fragment, err := fragmentUsecase.GetFragment(uint(id))
+	fmt.Printf("API token revoked: %s (ID: %d)\n", token.Name, token.ID)
+	return nil
+}
+
+func listUsers(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
 	if err != nil {
-		return fmt.Errorf("fragment with ID %d not found", id)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
+	defer db.Close(database)
 
-	// 削除実行
-	err = fragmentUsecase.DeleteFragment(uint(id))
+	users, err := usecase.NewUserUsecase(database).GetAllUsers()
 	if err != nil {
-		return fmt.Errorf("failed to delete fragment: %w", err)
+		return fmt.Errorf("failed to get users: %w", err)
 	}
 
-	fmt.Printf("Fragment deleted successfully!\n")
-	fmt.Printf("ID: %d\n", fragment.ID)
-	fmt.Printf("Content: %s\n", fragment.Content)
+	if len(users) == 0 {
+		fmt.Println("No users found. Create one with: insight user create --username <name> --role admin")
+		return nil
+	}
+
+	counts, err := usecase.NewFragmentUsecase(database).CountFragmentsByUser()
+	if err != nil {
+		return fmt.Errorf("failed to count fragments: %w", err)
+	}
+
+	fmt.Printf("Found %d users:\n\n", len(users))
+	for _, user := range users {
+		fmt.Printf("%s (%s) - %d fragments, created %s\n", user.Username, user.Role, counts[user.ID], user.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+func createUser(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := usecase.NewUserUsecase(database).CreateUser(usecase.CreateUserInput{
+		Username: c.String("username"),
+		Role:     c.String("role"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	scopes := strings.Join(usecase.Scopes, ",")
+	if !user.AllowsScope(models.ScopeWrite) {
+		scopes = models.ScopeRead
+	}
+	fmt.Printf("User created: %s (%s)\n", user.Username, user.Role)
+	fmt.Printf("Create a token to log in with: insight token create --user %s --name <name> --scope %s\n", user.Username, scopes)
+	return nil
+}
+
+func setUserRole(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := usecase.NewUserUsecase(database).SetUserRole(c.String("username"), c.String("role"))
+	if err != nil {
+		return fmt.Errorf("failed to change role: %w", err)
+	}
+
+	fmt.Printf("Role of %s changed to %s\n", user.Username, user.Role)
+	return nil
+}
+
+func deleteUser(ctx context.Context, c *cli.Command) error {
+	// データベース初期化
+	database, err := db.Init(nil)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close(database)
+
+	user, err := usecase.NewUserUsecase(database).DeleteUser(c.String("username"))
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
 
+	fmt.Printf("User deleted: %s (their API tokens were revoked)\n", user.Username)
 	return nil
 }
@@ -0,0 +1,873 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// /api/v1 はスクリプトなどから使うJSON API
+// リクエストはJSONで受け付け、レスポンスは成功時 {"data": ...}（一覧は "pagination" を含む）、
+// 失敗時 {"error": {"code": ..., "message": ...}} の形式で返す
+// 単体のリソースには ETag を付け、If-None-Match（GET）と If-Match（PUT/DELETE）に対応する
+
+// APIのエラーコード
+const (
+	apiErrorInvalidRequest     = "invalid_request"
+	apiErrorUnauthorized       = "unauthorized"
+	apiErrorForbidden          = "forbidden"
+	apiErrorNotFound           = "not_found"
+	apiErrorConflict           = "conflict"
+	apiErrorPreconditionFailed = "precondition_failed"
+	apiErrorInternal           = "internal_error"
+)
+
+// registerAPIV1Routes は /api/v1 のルートを登録する
+func (s *Server) registerAPIV1Routes(r *mux.Router) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/fragments", s.handleAPIListFragments).Methods("GET")
+	api.HandleFunc("/fragments", s.handleAPICreateFragment).Methods("POST")
+	api.HandleFunc("/fragments/{id:[0-9]+}", s.handleAPIGetFragment).Methods("GET")
+	api.HandleFunc("/fragments/{id:[0-9]+}", s.handleAPIUpdateFragment).Methods("PUT")
+	api.HandleFunc("/fragments/{id:[0-9]+}", s.handleAPIDeleteFragment).Methods("DELETE")
+	api.HandleFunc("/documents", s.handleAPIListDocuments).Methods("GET")
+	api.HandleFunc("/documents", s.handleAPICreateDocument).Methods("POST")
+	api.HandleFunc("/documents/{id:[0-9]+}", s.handleAPIGetDocument).Methods("GET")
+	api.HandleFunc("/documents/{id:[0-9]+}", s.handleAPIUpdateDocument).Methods("PUT")
+	api.HandleFunc("/documents/{id:[0-9]+}", s.handleAPIDeleteDocument).Methods("DELETE")
+	api.HandleFunc("/tags", s.handleAPIListTags).Methods("GET")
+	api.HandleFunc("/tags", s.handleAPICreateTag).Methods("POST")
+	api.HandleFunc("/tags/{id:[0-9]+}", s.handleAPIGetTag).Methods("GET")
+	api.HandleFunc("/tags/{id:[0-9]+}", s.handleAPIUpdateTag).Methods("PUT")
+	api.HandleFunc("/tags/{id:[0-9]+}", s.handleAPIDeleteTag).Methods("DELETE")
+	api.HandleFunc("/versions", s.handleAPIListVersions).Methods("GET")
+}
+
+// apiResponse は成功時のレスポンス
+type apiResponse struct {
+	Data       interface{}    `json:"data"`
+	Pagination *apiPagination `json:"pagination,omitempty"`
+}
+
+// apiPagination は一覧のページ情報
+type apiPagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// apiErrorResponse は失敗時のレスポンス
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiFragment はAPIで返すFragment
+type apiFragment struct {
+	ID        uint      `json:"id"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	Author    *string   `json:"author"` // 作成したユーザーの名前（ユーザー導入前のものは null）
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// apiDocument はAPIで返すDocument
+type apiDocument struct {
+	ID               uint       `json:"id"`
+	Title            string     `json:"title"`
+	Summary          string     `json:"summary"`
+	Content          string     `json:"content"`
+	Tags             []string   `json:"tags"`
+	FragmentIDs      []uint     `json:"fragment_ids"`
+	VersionCreatedAt time.Time  `json:"version_created_at"`
+	EditedByHuman    bool       `json:"edited_by_human"`
+	HumanEditedAt    *time.Time `json:"human_edited_at"`
+	Locked           bool       `json:"locked"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// apiVersion はAPIで返すドキュメントのバージョン
+type apiVersion struct {
+	Version       time.Time `json:"version"`
+	DocumentCount int64     `json:"document_count"`
+	Latest        bool      `json:"latest"` // 全フラグメントから生成した最新バージョン
+	Scoped        bool      `json:"scoped"` // 対象を絞り込んだ生成のバージョン
+	Scope         string    `json:"scope,omitempty"`
+	Options       string    `json:"options,omitempty"`
+}
+
+// apiFragmentRequest はFragmentの作成・更新のリクエスト
+type apiFragmentRequest struct {
+	Content string    `json:"content"`
+	Tags    *[]string `json:"tags"` // 指定した場合はタグを置き換える
+}
+
+// apiDocumentRequest はDocumentの作成・更新のリクエスト（編集者は認証したユーザー）
+type apiDocumentRequest struct {
+	Title   string    `json:"title"`
+	Summary string    `json:"summary"`
+	Content string    `json:"content"`
+	Tags    *[]string `json:"tags"` // 更新時は指定した場合のみタグを置き換える
+}
+
+// apiTagRequest はタグの作成・更新のリクエスト（指定した項目のみ変更する）
+type apiTagRequest struct {
+	Name   *string `json:"name"`
+	Color  *string `json:"color"`
+	Parent *string `json:"parent"` // 親タグの名前（空文字で最上位）
+}
+
+func toAPIFragment(fragment *models.Fragment) apiFragment {
+	var author *string
+	if fragment.User != nil {
+		author = &fragment.User.Username
+	}
+	return apiFragment{
+		ID:        fragment.ID,
+		Content:   fragment.Content,
+		Tags:      tagNames(fragment.Tags),
+		Author:    author,
+		CreatedAt: fragment.CreatedAt,
+		UpdatedAt: fragment.UpdatedAt,
+	}
+}
+
+func toAPIDocument(document *models.Document) apiDocument {
+	fragmentIDs := make([]uint, len(document.Fragments))
+	for i, fragment := range document.Fragments {
+		fragmentIDs[i] = fragment.ID
+	}
+	return apiDocument{
+		ID:               document.ID,
+		Title:            document.Title,
+		Summary:          document.Summary,
+		Content:          document.Content,
+		Tags:             tagNames(document.Tags),
+		FragmentIDs:      fragmentIDs,
+		VersionCreatedAt: document.VersionCreatedAt,
+		EditedByHuman:    document.EditedByHuman,
+		HumanEditedAt:    document.HumanEditedAt,
+		Locked:           document.Locked,
+		CreatedAt:        document.CreatedAt,
+		UpdatedAt:        document.UpdatedAt,
+	}
+}
+
+// tagNames はタグ名の一覧を返す（タグがない場合も空の配列）
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// writeAPIData は成功時のレスポンスを ETag 付きで書き込む
+// GET で If-None-Match が一致する場合は本文を返さず 304 にする
+func writeAPIData(w http.ResponseWriter, r *http.Request, status int, response apiResponse) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to encode response")
+		return
+	}
+
+	etag := apiETag(body)
+	w.Header().Set("ETag", etag)
+	if r.Method == http.MethodGet && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeAPIError は失敗時のレスポンスを書き込む
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErrorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+// apiETag はレスポンス本文から ETag を作る
+func apiETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches は If-None-Match / If-Match ヘッダーが ETag に一致するか判定する（弱い比較）
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAPIPrecondition は If-Match が指定された場合に現在のリソースの ETag と比較する
+// 一致しない場合は 412 を書き込んで false を返す
+func checkAPIPrecondition(w http.ResponseWriter, r *http.Request, current interface{}) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	body, err := json.Marshal(apiResponse{Data: current})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to encode resource")
+		return false
+	}
+	if !etagMatches(ifMatch, apiETag(body)) {
+		writeAPIError(w, http.StatusPreconditionFailed, apiErrorPreconditionFailed, "The resource has been modified")
+		return false
+	}
+	return true
+}
+
+// decodeAPIRequest はJSONのリクエスト本文を読み込む（未知のフィールドはエラー）
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, fmt.Sprintf("Invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+// apiID はパスの {id} を読み込む
+func apiID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, "Invalid ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeAPILookupError は取得時のエラーを、見つからない場合は 404、それ以外は 500 として書き込む
+func writeAPILookupError(w http.ResponseWriter, err error, resource string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, resource+" not found")
+		return
+	}
+	writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch "+strings.ToLower(resource))
+}
+
+func newAPIPagination(page, perPage int, total int64) *apiPagination {
+	totalPages := int((total + int64(perPage) - 1) / int64(perPage))
+	return &apiPagination{Page: page, PerPage: perPage, Total: total, TotalPages: totalPages}
+}
+
+// paginate はメモリ上の一覧を1ページ分に切り出す
+func paginate[T any](items []T, page, perPage int) ([]T, *apiPagination) {
+	page, perPage = usecase.NormalizePaging(page, perPage)
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	return items[start:end], newAPIPagination(page, perPage, int64(len(items)))
+}
+
+// parseAPIPaging は page / per_page を読み込む
+func parseAPIPaging(r *http.Request) (int, int, error) {
+	var tags []string
+	var since, until *time.Time
+	var page, perPage int
+	err := parseSearchParams(r, &tags, &since, &until, &page, &perPage)
+	return page, perPage, err
+}
+
+func (s *Server) handleAPIListFragments(w http.ResponseWriter, r *http.Request) {
+	var input usecase.ListFragmentsInput
+	if err := parseSearchParams(r, &input.Tags, &input.Since, &input.Until, &input.Page, &input.PerPage); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+	if username := strings.TrimSpace(r.URL.Query().Get("user")); username != "" {
+		user, err := usecase.NewUserUsecase(s.db).GetUserByUsername(username)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, "Unknown user: "+username)
+			return
+		}
+		input.UserID = user.ID
+	}
+
+	list, err := s.fragmentUsecase.ListFragments(input)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch fragments")
+		return
+	}
+
+	fragments := make([]apiFragment, len(list.Fragments))
+	for i := range list.Fragments {
+		fragments[i] = toAPIFragment(&list.Fragments[i])
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: fragments, Pagination: newAPIPagination(list.Page, list.PerPage, list.Total)})
+}
+
+func (s *Server) handleAPICreateFragment(w http.ResponseWriter, r *http.Request) {
+	var request apiFragmentRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+	content := strings.TrimSpace(request.Content)
+	if content == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, "content is required")
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.CreateFragment(usecase.CreateFragmentInput{Content: content, UserID: currentUserID(r)})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to create fragment")
+		return
+	}
+	s.refreshSemanticIndex(r)
+	fragment.User = currentUser(r)
+	if request.Tags != nil {
+		if fragment, err = s.fragmentUsecase.SetFragmentTags(fragment.ID, *request.Tags); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to tag fragment")
+			return
+		}
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/fragments/%d", fragment.ID))
+	writeAPIData(w, r, http.StatusCreated, apiResponse{Data: toAPIFragment(fragment)})
+}
+
+func (s *Server) handleAPIGetFragment(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.GetFragment(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Fragment")
+		return
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: toAPIFragment(fragment)})
+}
+
+func (s *Server) handleAPIUpdateFragment(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	var request apiFragmentRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+	content := strings.TrimSpace(request.Content)
+	if content == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, "content is required")
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.GetFragment(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Fragment")
+		return
+	}
+	if !currentUser(r).CanModifyFragment(fragment) {
+		writeAPIError(w, http.StatusForbidden, apiErrorForbidden, "Only the author or an admin can edit this fragment")
+		return
+	}
+	if !checkAPIPrecondition(w, r, toAPIFragment(fragment)) {
+		return
+	}
+
+	if _, err := s.fragmentUsecase.UpdateFragment(usecase.UpdateFragmentInput{ID: id, Content: content}); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to update fragment")
+		return
+	}
+	s.refreshSemanticIndex(r)
+	if request.Tags != nil {
+		if _, err := s.fragmentUsecase.SetFragmentTags(id, *request.Tags); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to tag fragment")
+			return
+		}
+	}
+
+	if fragment, err = s.fragmentUsecase.GetFragment(id); err != nil {
+		writeAPILookupError(w, err, "Fragment")
+		return
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: toAPIFragment(fragment)})
+}
+
+func (s *Server) handleAPIDeleteFragment(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.GetFragment(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Fragment")
+		return
+	}
+	if !currentUser(r).CanModifyFragment(fragment) {
+		writeAPIError(w, http.StatusForbidden, apiErrorForbidden, "Only the author or an admin can delete this fragment")
+		return
+	}
+	if !checkAPIPrecondition(w, r, toAPIFragment(fragment)) {
+		return
+	}
+
+	if err := s.fragmentUsecase.DeleteFragment(id); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to delete fragment")
+		return
+	}
+	s.refreshSemanticIndex(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPIListDocuments はドキュメントの一覧を返す
+// version を指定しない場合はすべてのバージョン、"latest" の場合は最新バージョンのドキュメントを返す
+func (s *Server) handleAPIListDocuments(w http.ResponseWriter, r *http.Request) {
+	var input usecase.ListDocumentsInput
+	if err := parseSearchParams(r, &input.Tags, &input.Since, &input.Until, &input.Page, &input.PerPage); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+
+	switch versionParam := r.URL.Query().Get("version"); versionParam {
+	case "":
+	case "latest":
+		version, err := s.documentUsecase.GetLatestVersion()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch versions")
+			return
+		}
+		input.Version = &version
+	default:
+		version, err := usecase.ParseVersion(versionParam)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+			return
+		}
+		input.Version = &version
+	}
+
+	list, err := s.documentUsecase.ListDocuments(input)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch documents")
+		return
+	}
+
+	documents := make([]apiDocument, len(list.Documents))
+	for i := range list.Documents {
+		documents[i] = toAPIDocument(&list.Documents[i])
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: documents, Pagination: newAPIPagination(list.Page, list.PerPage, list.Total)})
+}
+
+// validateAPIDocumentRequest は必須項目を確認し、前後の空白を取り除く
+func validateAPIDocumentRequest(request *apiDocumentRequest) error {
+	request.Title = strings.TrimSpace(request.Title)
+	request.Summary = strings.TrimSpace(request.Summary)
+	request.Content = strings.TrimSpace(request.Content)
+	if request.Title == "" || request.Summary == "" || request.Content == "" {
+		return fmt.Errorf("title, summary and content are required")
+	}
+	return nil
+}
+
+func (s *Server) handleAPICreateDocument(w http.ResponseWriter, r *http.Request) {
+	var request apiDocumentRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+	if err := validateAPIDocumentRequest(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+
+	var tags []string
+	if request.Tags != nil {
+		tags = *request.Tags
+	}
+	tagIDs, err := usecase.NewTagUsecase(s.db).GetOrCreateTags(tags)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to create tags")
+		return
+	}
+
+	// 人が作成したドキュメントは最新バージョンに追加
+	version, err := s.documentUsecase.CurrentVersion()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch versions")
+		return
+	}
+
+	document, err := s.documentUsecase.CreateDocument(usecase.CreateDocumentInput{
+		Title:            request.Title,
+		Summary:          request.Summary,
+		Content:          request.Content,
+		VersionCreatedAt: version,
+		TagIDs:           tagIDs,
+		Author:           currentUser(r).Username,
+		UserID:           currentUserID(r),
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to create document")
+		return
+	}
+	s.refreshSemanticIndex(r)
+
+	s.refreshSuggestedQuestions(r, document.ID)
+
+	if document, err = s.documentUsecase.GetDocument(document.ID); err != nil {
+		writeAPILookupError(w, err, "Document")
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/documents/%d", document.ID))
+	writeAPIData(w, r, http.StatusCreated, apiResponse{Data: toAPIDocument(document)})
+}
+
+func (s *Server) handleAPIGetDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	document, err := s.documentUsecase.GetDocument(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Document")
+		return
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: toAPIDocument(document)})
+}
+
+func (s *Server) handleAPIUpdateDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	var request apiDocumentRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+	if err := validateAPIDocumentRequest(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+
+	document, err := s.documentUsecase.GetDocument(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Document")
+		return
+	}
+	if !checkAPIPrecondition(w, r, toAPIDocument(document)) {
+		return
+	}
+
+	// tags を省略した場合はタグを変更しない
+	var tagIDs []uint
+	if request.Tags != nil {
+		if tagIDs, err = usecase.NewTagUsecase(s.db).GetOrCreateTags(*request.Tags); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to create tags")
+			return
+		}
+		if tagIDs == nil {
+			tagIDs = []uint{}
+		}
+	}
+
+	document, err = s.documentUsecase.UpdateDocument(usecase.UpdateDocumentInput{
+		ID:      id,
+		Title:   request.Title,
+		Summary: request.Summary,
+		Content: request.Content,
+		TagIDs:  tagIDs,
+		Author:  currentUser(r).Username,
+		UserID:  currentUserID(r),
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to update document")
+		return
+	}
+	s.refreshSemanticIndex(r)
+
+	s.refreshSuggestedQuestions(r, document.ID)
+
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: toAPIDocument(document)})
+}
+
+func (s *Server) handleAPIDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	document, err := s.documentUsecase.GetDocument(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Document")
+		return
+	}
+	if !checkAPIPrecondition(w, r, toAPIDocument(document)) {
+		return
+	}
+
+	if err := s.documentUsecase.DeleteDocument(id); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to delete document")
+		return
+	}
+	s.refreshSemanticIndex(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIListTags(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := parseAPIPaging(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+
+	summaries, err := usecase.NewTagUsecase(s.db).GetTagSummaries()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch tags")
+		return
+	}
+	for i := range summaries {
+		if summaries[i].Synonyms == nil {
+			summaries[i].Synonyms = []string{}
+		}
+	}
+
+	tags, pagination := paginate(summaries, page, perPage)
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: tags, Pagination: pagination})
+}
+
+// apiTagSummary は利用件数と同義語を含むタグを返す
+func (s *Server) apiTagSummary(id uint) (*usecase.TagSummary, error) {
+	summaries, err := usecase.NewTagUsecase(s.db).GetTagSummaries()
+	if err != nil {
+		return nil, err
+	}
+	for _, summary := range summaries {
+		if summary.ID == id {
+			if summary.Synonyms == nil {
+				summary.Synonyms = []string{}
+			}
+			return &summary, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// applyAPITagRequest はリクエストで指定された色と親タグをタグに設定する
+func applyAPITagRequest(tagUsecase *usecase.TagUsecase, tag *models.Tag, request apiTagRequest) error {
+	if request.Color != nil && *request.Color != tag.Color {
+		if _, err := tagUsecase.SetTagColor(tag.Name, *request.Color); err != nil {
+			return err
+		}
+	}
+	if request.Parent != nil {
+		if _, err := tagUsecase.SetTagParent(tag.Name, *request.Parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleAPICreateTag(w http.ResponseWriter, r *http.Request) {
+	var request apiTagRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+	if request.Name == nil || strings.TrimSpace(*request.Name) == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, "name is required")
+		return
+	}
+
+	// 色や親タグが不正な場合はタグも作成しない
+	var tag *models.Tag
+	status, code := http.StatusConflict, apiErrorConflict
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		tagUsecase := usecase.NewTagUsecase(tx)
+		created, err := tagUsecase.CreateTag(*request.Name)
+		if err != nil {
+			return err
+		}
+		tag = created
+		status, code = http.StatusBadRequest, apiErrorInvalidRequest
+		return applyAPITagRequest(tagUsecase, tag, request)
+	})
+	if err != nil {
+		writeAPIError(w, status, code, err.Error())
+		return
+	}
+
+	summary, err := s.apiTagSummary(tag.ID)
+	if err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/tags/%d", tag.ID))
+	writeAPIData(w, r, http.StatusCreated, apiResponse{Data: summary})
+}
+
+func (s *Server) handleAPIGetTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	summary, err := s.apiTagSummary(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: summary})
+}
+
+func (s *Server) handleAPIUpdateTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	var request apiTagRequest
+	if !decodeAPIRequest(w, r, &request) {
+		return
+	}
+
+	summary, err := s.apiTagSummary(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+	if !checkAPIPrecondition(w, r, summary) {
+		return
+	}
+
+	tag, err := usecase.NewTagUsecase(s.db).GetTag(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+
+	// 名前・色・親タグの変更はまとめて適用し、いずれかが不正な場合はどれも変更しない
+	status, code := http.StatusConflict, apiErrorConflict
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		tagUsecase := usecase.NewTagUsecase(tx)
+		if request.Name != nil && strings.TrimSpace(*request.Name) != tag.Name {
+			// 既存のタグと同じ名前への変更は統合になるため、ここでは受け付けない
+			renamed, err := tagUsecase.RenameTag(tag.Name, *request.Name)
+			if err != nil {
+				return err
+			}
+			tag = renamed
+		}
+		status, code = http.StatusBadRequest, apiErrorInvalidRequest
+		return applyAPITagRequest(tagUsecase, tag, request)
+	})
+	if err != nil {
+		writeAPIError(w, status, code, err.Error())
+		return
+	}
+
+	if summary, err = s.apiTagSummary(id); err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: summary})
+}
+
+func (s *Server) handleAPIDeleteTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	summary, err := s.apiTagSummary(id)
+	if err != nil {
+		writeAPILookupError(w, err, "Tag")
+		return
+	}
+	if !checkAPIPrecondition(w, r, summary) {
+		return
+	}
+
+	// 使われているタグは削除できない
+	if err := usecase.NewTagUsecase(s.db).DeleteTag(summary.Name); err != nil {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPIListVersions はドキュメントのバージョンを新しい順に返す
+func (s *Server) handleAPIListVersions(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := parseAPIPaging(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidRequest, err.Error())
+		return
+	}
+
+	counts, err := s.documentUsecase.CountDocumentsByVersion()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch versions")
+		return
+	}
+	latest, err := s.documentUsecase.GetLatestVersion()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch versions")
+		return
+	}
+	runs, err := usecase.NewGenerationRunUsecase(s.db).GetGenerationRuns()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "Failed to fetch generation runs")
+		return
+	}
+	runsByVersion := make(map[int64]*models.GenerationRun, len(runs))
+	for i := range runs {
+		runsByVersion[runs[i].VersionCreatedAt.UnixNano()] = &runs[i]
+	}
+
+	versions := make([]apiVersion, len(counts))
+	for i, count := range counts {
+		version := apiVersion{
+			Version:       count.VersionCreatedAt,
+			DocumentCount: count.Count,
+			Latest:        count.VersionCreatedAt.Equal(latest),
+		}
+		if run, ok := runsByVersion[count.VersionCreatedAt.UnixNano()]; ok {
+			version.Scoped = run.Scoped
+			if run.Scoped {
+				version.Scope = usecase.ScopeOf(run).Describe()
+			}
+			if options := usecase.OptionsOf(run); options != (usecase.GenerationOptions{}) {
+				version.Options = options.Describe()
+			}
+		}
+		versions[i] = version
+	}
+
+	data, pagination := paginate(versions, page, perPage)
+	writeAPIData(w, r, http.StatusOK, apiResponse{Data: data, Pagination: pagination})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"insight/src/models"
+
+	"github.com/gorilla/mux"
+)
+
+// 認証
+// スクリプトなどは "Authorization: Bearer <APIトークン>" で、ブラウザはAPIトークンでログインしたセッションのCookieで認証する
+// 必要な権限はルートごとに決まり（requiredScope）、トークンが持たない場合や持ち主の役割で使えない場合は 403 を返す
+// タグの管理やフラグメント圧縮など一部のルートは管理者のみ使える（adminRoutes）
+
+// sessionCookieName はログインセッションのCookie名
+const sessionCookieName = "insight_session"
+
+// publicRoutes は認証なしでアクセスできるルート（パステンプレート）
+var publicRoutes = map[string]bool{
+	"/login":   true,
+	"/logout":  true,
+	"/static/": true,
+}
+
+// aiRoutes はAIを呼び出すため ai 権限が必要なルート
+var aiRoutes = map[string]bool{
+	"/api/ai/create":                   true,
+	"/api/ai/compress":                 true,
+	"/api/ai/tag":                      true,
+	"/api/ai/tags/consolidate":         true,
+	"/api/documents/{id}/regenerate":   true,
+	"/api/documents/{id}/ask":          true,
+	"/api/documents/ask":               true,
+	"/api/fragments/ask":               true,
+	"/api/qa/agent":                    true,
+	"/api/conversations/{id}/messages": true,
+}
+
+// adminRoutes は管理者のみが使えるルート（"METHOD パステンプレート"）
+var adminRoutes = map[string]bool{
+	"GET /admin/tags":                true,
+	"POST /api/tags/merge":           true,
+	"POST /api/tags/prune":           true,
+	"PUT /api/tags/{id}":             true,
+	"DELETE /api/tags/{id}":          true,
+	"POST /api/tags/{id}/synonyms":   true,
+	"DELETE /api/tags/{id}/synonyms": true,
+	"POST /api/ai/compress":          true,
+	"PUT /api/v1/tags/{id}":          true,
+	"DELETE /api/v1/tags/{id}":       true,
+}
+
+// requiredScope はルートに必要な権限を返す（認証が不要な場合は空文字列）
+// AIを呼び出すルートは ai、参照は read、それ以外の変更は write とする
+func requiredScope(method, path string, query url.Values) string {
+	switch {
+	case publicRoutes[path]:
+		return ""
+	case aiRoutes[path]:
+		return models.ScopeAI
+	case path == "/api/documents/search" && query.Get("mode") == "semantic":
+		// セマンティック検索は質問文の埋め込みにAIを使う
+		return models.ScopeAI
+	case method == http.MethodGet || method == http.MethodHead:
+		return models.ScopeRead
+	default:
+		return models.ScopeWrite
+	}
+}
+
+type apiTokenContextKey struct{}
+
+// currentAPIToken は認証に使われたAPIトークンを返す（認証が不要なルートではnil）
+func currentAPIToken(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(apiTokenContextKey{}).(*models.APIToken)
+	return token
+}
+
+// currentUser は認証に使われたAPIトークンの持ち主を返す（認証が不要なルートではnil）
+func currentUser(r *http.Request) *models.User {
+	if token := currentAPIToken(r); token != nil {
+		return token.User
+	}
+	return nil
+}
+
+// canUseAI は現在のトークンとユーザーの役割で ai 権限の操作ができるかを返す
+// write 権限のルートから付随してAIを呼び出す場合に確認する
+func canUseAI(r *http.Request) bool {
+	token := currentAPIToken(r)
+	return token != nil && token.HasScope(models.ScopeAI) && token.User.AllowsScope(models.ScopeAI)
+}
+
+// currentUserID は記録用に現在のユーザーのIDを返す
+func currentUserID(r *http.Request) *uint {
+	if user := currentUser(r); user != nil {
+		return &user.ID
+	}
+	return nil
+}
+
+// authMiddleware はルートに必要な権限を持つAPIトークンまたはセッションで認証されているかを確認する
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				path = openAPIPath(template)
+			}
+		}
+
+		scope := requiredScope(r.Method, path, r.URL.Query())
+		if scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := s.authenticate(r)
+		if err != nil {
+			s.writeUnauthorized(w, r, err.Error())
+			return
+		}
+		user := token.User
+		switch {
+		case !token.HasScope(scope):
+			writeForbidden(w, r, "Token does not have the '"+scope+"' scope")
+			return
+		case !user.AllowsScope(scope):
+			writeForbidden(w, r, "User '"+user.Username+"' ("+user.Role+") cannot use the '"+scope+"' scope")
+			return
+		case adminRoutes[r.Method+" "+path] && !user.IsAdmin():
+			writeForbidden(w, r, "Only admins can do this")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenContextKey{}, token)))
+	})
+}
+
+// authenticate は Authorization ヘッダーまたはセッションのCookieからAPIトークンを取得する
+func (s *Server) authenticate(r *http.Request) (*models.APIToken, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		raw, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, fmt.Errorf("unsupported Authorization header: use \"Bearer <token>\"")
+		}
+		return s.authUsecase.AuthenticateAPIToken(strings.TrimSpace(raw))
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, fmt.Errorf("authentication required: use \"Authorization: Bearer <token>\" or log in")
+	}
+	return s.authUsecase.AuthenticateSession(cookie.Value)
+}
+
+// writeUnauthorized は認証されていない場合のレスポンスを返す
+// ブラウザでページを開いた場合はログインページに移動する
+func (s *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.Header.Get("Authorization") == "" {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="insight"`)
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		writeAPIError(w, http.StatusUnauthorized, apiErrorUnauthorized, message)
+		return
+	}
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// writeForbidden は権限が足りない場合のレスポンスを返す
+func writeForbidden(w http.ResponseWriter, r *http.Request, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		writeAPIError(w, http.StatusForbidden, apiErrorForbidden, message)
+		return
+	}
+	http.Error(w, message, http.StatusForbidden)
+}
+
+// safeRedirect はログイン後の移動先として同じサイト内のパスだけを許可する
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.renderLoginPage(w, r.URL.Query().Get("next"), "", http.StatusOK)
+}
+
+func (s *Server) renderLoginPage(w http.ResponseWriter, next, message string, status int) {
+	count, err := s.authUsecase.CountAPITokens()
+	if err != nil {
+		http.Error(w, "Failed to fetch tokens", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Next     string
+		Error    string
+		NoTokens bool
+	}{
+		Next:     safeRedirect(next),
+		Error:    message,
+		NoTokens: count == 0,
+	}
+
+	w.WriteHeader(status)
+	if err := s.executeTemplateWithLogging(w, "login_page.go.tmpl", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	next := r.FormValue("next")
+
+	raw, expiresAt, err := s.authUsecase.CreateSession(strings.TrimSpace(r.FormValue("token")))
+	if err != nil {
+		log.Printf("Login failed from %s: %v", r.RemoteAddr, err)
+		s.renderLoginPage(w, next, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    raw,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, safeRedirect(next), http.StatusSeeOther)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := s.authUsecase.DeleteSession(cookie.Value); err != nil {
+			log.Printf("Failed to delete session: %v", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"insight/src/db"
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"github.com/gorilla/mux"
+)
+
+// TestRequiredScope はルートごとに必要な権限を確認する
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		query  string
+		want   string
+	}{
+		// 認証が不要なルート
+		{"GET", "/login", "", ""},
+		{"POST", "/login", "", ""},
+		{"GET", "/logout", "", ""},
+		{"GET", "/static/", "", ""},
+
+		// AIを呼び出すルートはメソッドに関わらず ai
+		{"POST", "/api/ai/create", "", models.ScopeAI},
+		{"POST", "/api/ai/compress", "", models.ScopeAI},
+		{"POST", "/api/documents/{id}/ask", "", models.ScopeAI},
+		{"POST", "/api/documents/{id}/regenerate", "", models.ScopeAI},
+		{"POST", "/api/fragments/ask", "", models.ScopeAI},
+		{"POST", "/api/qa/agent", "", models.ScopeAI},
+		{"POST", "/api/conversations/{id}/messages", "", models.ScopeAI},
+
+		// セマンティック検索は質問文の埋め込みにAIを使う
+		{"GET", "/api/documents/search", "q=go&mode=semantic", models.ScopeAI},
+		{"GET", "/api/documents/search", "q=go", models.ScopeRead},
+		{"GET", "/api/documents/search", "q=go&mode=keyword", models.ScopeRead},
+
+		// 参照は read、それ以外の変更は write
+		{"GET", "/fragments", "", models.ScopeRead},
+		{"HEAD", "/fragments", "", models.ScopeRead},
+		{"GET", "/api/v1/fragments", "", models.ScopeRead},
+		{"GET", "/admin/tags", "", models.ScopeRead},
+		{"POST", "/fragments", "", models.ScopeWrite},
+		{"PUT", "/fragments/{id}", "", models.ScopeWrite},
+		{"DELETE", "/fragments/{id}", "", models.ScopeWrite},
+		{"POST", "/api/fragments/{id}/tags", "", models.ScopeWrite},
+		{"POST", "/api/v1/fragments", "", models.ScopeWrite},
+		{"PUT", "/api/v1/tags/{id}", "", models.ScopeWrite},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("invalid query %q: %v", tt.query, err)
+		}
+		if got := requiredScope(tt.method, tt.path, query); got != tt.want {
+			t.Errorf("requiredScope(%s %s?%s) = %q, want %q", tt.method, tt.path, tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestAuthRoutesExist は権限の設定に使うルートがルーターに存在することを確認する
+// ルートの名前を変えたときに、権限の設定だけが古いまま残らないようにする
+func TestAuthRoutesExist(t *testing.T) {
+	routed := make(map[string]bool)
+	paths := make(map[string]bool)
+	err := newRouter(&Server{}).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routed[method+" "+openAPIPath(template)] = true
+			paths[openAPIPath(template)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk routes: %v", err)
+	}
+
+	for key := range adminRoutes {
+		if !routed[key] {
+			t.Errorf("admin route %s has no route", key)
+		}
+	}
+	for path := range aiRoutes {
+		if !paths[path] {
+			t.Errorf("ai route %s has no route", path)
+		}
+	}
+}
+
+// TestAuthMiddleware はトークン・セッションの有無と権限・役割に応じた応答を確認する
+func TestAuthMiddleware(t *testing.T) {
+	database, err := db.Init(&db.Config{DatabasePath: filepath.Join(t.TempDir(), "insight.db")})
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close(database)
+
+	userUsecase := usecase.NewUserUsecase(database)
+	authUsecase := usecase.NewAuthUsecase(database)
+	newToken := func(username, role string, scopes ...string) string {
+		t.Helper()
+		user, err := userUsecase.CreateUser(usecase.CreateUserInput{Username: username, Role: role})
+		if err != nil {
+			t.Fatalf("failed to create user %s: %v", username, err)
+		}
+		_, raw, err := authUsecase.CreateAPIToken(usecase.CreateAPITokenInput{Name: username, UserID: user.ID, Scopes: scopes})
+		if err != nil {
+			t.Fatalf("failed to create token for %s: %v", username, err)
+		}
+		return raw
+	}
+
+	admin := newToken("alice", models.UserRoleAdmin, models.ScopeRead, models.ScopeWrite, models.ScopeAI)
+	editor := newToken("bob", models.UserRoleEditor, models.ScopeRead, models.ScopeWrite, models.ScopeAI)
+	writer := newToken("carol", models.UserRoleEditor, models.ScopeRead, models.ScopeWrite)
+	reader := newToken("dave", models.UserRoleEditor, models.ScopeRead)
+	viewer := newToken("vic", models.UserRoleViewer, models.ScopeRead)
+
+	// 役割を下げたユーザーのトークンは、持っている権限でも役割の範囲でしか使えない
+	demoted := newToken("erin", models.UserRoleEditor, models.ScopeRead, models.ScopeWrite)
+	if _, err := userUsecase.SetUserRole("erin", models.UserRoleViewer); err != nil {
+		t.Fatalf("failed to change role: %v", err)
+	}
+
+	session, _, err := authUsecase.CreateSession(reader)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	// 実際のルートと同じパステンプレートで、認証を通過したことだけを返すルーター
+	s := &Server{authUsecase: authUsecase}
+	r := mux.NewRouter()
+	r.Use(s.authMiddleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if currentUser(r) == nil && !strings.HasPrefix(r.URL.Path, "/login") {
+			t.Errorf("%s %s: no user in context", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	r.HandleFunc("/login", ok).Methods("GET")
+	r.HandleFunc("/fragments", ok).Methods("GET", "POST")
+	r.HandleFunc("/api/documents/search", ok).Methods("GET")
+	r.HandleFunc("/api/documents/ask", ok).Methods("POST")
+	r.HandleFunc("/api/tags/merge", ok).Methods("POST")
+	r.HandleFunc("/api/v1/fragments", ok).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/tags/{id:[0-9]+}", ok).Methods("PUT")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		cookie string
+		want   int
+	}{
+		// 認証が不要なルート
+		{"public route without token", "GET", "/login", "", "", http.StatusNoContent},
+
+		// トークンがない・無効な場合
+		{"page without token redirects to login", "GET", "/fragments", "", "", http.StatusSeeOther},
+		{"write without token", "POST", "/fragments", "", "", http.StatusUnauthorized},
+		{"api without token", "GET", "/api/v1/fragments", "", "", http.StatusUnauthorized},
+		{"invalid token", "GET", "/api/v1/fragments", "insight_invalid", "", http.StatusUnauthorized},
+		{"invalid session", "GET", "/api/v1/fragments", "", "invalid", http.StatusUnauthorized},
+
+		// 参照と変更
+		{"read with read scope", "GET", "/fragments", reader, "", http.StatusNoContent},
+		{"read with session", "GET", "/fragments", "", session, http.StatusNoContent},
+		{"viewer can read", "GET", "/api/v1/fragments", viewer, "", http.StatusNoContent},
+		{"write without write scope", "POST", "/fragments", reader, "", http.StatusForbidden},
+		{"v1 write without write scope", "POST", "/api/v1/fragments", reader, "", http.StatusForbidden},
+		{"write with write scope", "POST", "/api/v1/fragments", writer, "", http.StatusNoContent},
+		{"write by demoted user", "POST", "/api/v1/fragments", demoted, "", http.StatusForbidden},
+
+		// AIを呼び出すルート
+		{"ai without ai scope", "POST", "/api/documents/ask", writer, "", http.StatusForbidden},
+		{"ai with ai scope", "POST", "/api/documents/ask", editor, "", http.StatusNoContent},
+		{"semantic search without ai scope", "GET", "/api/documents/search?q=go&mode=semantic", writer, "", http.StatusForbidden},
+		{"semantic search with ai scope", "GET", "/api/documents/search?q=go&mode=semantic", editor, "", http.StatusNoContent},
+		{"keyword search with read scope", "GET", "/api/documents/search?q=go", reader, "", http.StatusNoContent},
+
+		// 管理者のみのルート
+		{"admin route by editor", "POST", "/api/tags/merge", editor, "", http.StatusForbidden},
+		{"v1 admin route by editor", "PUT", "/api/v1/tags/1", editor, "", http.StatusForbidden},
+		{"admin route by admin", "POST", "/api/tags/merge", admin, "", http.StatusNoContent},
+		{"v1 admin route by admin", "PUT", "/api/v1/tags/1", admin, "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d (%s)", tt.method, tt.target, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+			if tt.want == http.StatusSeeOther {
+				if location := rec.Header().Get("Location"); !strings.HasPrefix(location, "/login?next=") {
+					t.Errorf("redirected to %q, want the login page", location)
+				}
+			}
+		})
+	}
+}
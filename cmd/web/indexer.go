@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"insight/src/ai"
+
+	"gorm.io/gorm"
+)
+
+// semanticIndexer はベクトルインデックスの更新をリクエストの外で行うバックグラウンドジョブ
+// 書き込みのたびに Trigger し、溜まった要求は1回の Refresh にまとめて処理する
+type semanticIndexer struct {
+	db      *gorm.DB
+	pending chan struct{}
+}
+
+// newSemanticIndexer は新しいsemanticIndexerを作成
+func newSemanticIndexer(db *gorm.DB) *semanticIndexer {
+	return &semanticIndexer{
+		db:      db,
+		pending: make(chan struct{}, 1),
+	}
+}
+
+// Trigger はインデックスの更新を予約する（更新中の場合は完了後にもう一度実行される）
+func (x *semanticIndexer) Trigger() {
+	if x == nil {
+		return
+	}
+	select {
+	case x.pending <- struct{}{}:
+	default:
+	}
+}
+
+// Run は起動時と Trigger のたびにインデックスを更新する（ctx が終了するまで戻らない）
+func (x *semanticIndexer) Run(ctx context.Context) {
+	x.Trigger()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-x.pending:
+			if err := ai.NewSemanticIndex(x.db).Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh semantic index: %v", err)
+			}
+		}
+	}
+}
+
+// refreshSemanticIndex は書き込み後にベクトルインデックスの更新を予約する
+// 埋め込みAPIを呼び出す可能性があるため ai 権限が必要（ない場合は次に ai 権限で書き込んだときや再起動時に反映される）
+func (s *Server) refreshSemanticIndex(r *http.Request) {
+	if !canUseAI(r) {
+		return
+	}
+	s.indexer.Trigger()
+}
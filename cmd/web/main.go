@@ -8,6 +8,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -26,11 +27,16 @@ import (
 )
 
 type Server struct {
-	documentUsecase *usecase.DocumentUsecase
-	fragmentUsecase *usecase.FragmentUsecase
-	markdown        goldmark.Markdown
-	templates       *template.Template
-	db              *gorm.DB // データベース接続を保持
+	documentUsecase     *usecase.DocumentUsecase
+	fragmentUsecase     *usecase.FragmentUsecase
+	searchUsecase       *usecase.SearchUsecase
+	conversationUsecase *usecase.ConversationUsecase
+	qaExchangeUsecase   *usecase.QAExchangeUsecase
+	authUsecase         *usecase.AuthUsecase
+	markdown            goldmark.Markdown
+	templates           *template.Template
+	db                  *gorm.DB // データベース接続を保持
+	indexer             *semanticIndexer
 }
 
 func main() {
@@ -61,29 +67,37 @@ func main() {
 
 	// サーバー初期化
 	server := &Server{
-		documentUsecase: usecase.NewDocumentUsecase(database),
-		fragmentUsecase: usecase.NewFragmentUsecase(database),
-		markdown:        md,
-		templates:       templates,
-		db:              database,
+		documentUsecase:     usecase.NewDocumentUsecase(database),
+		fragmentUsecase:     usecase.NewFragmentUsecase(database),
+		searchUsecase:       usecase.NewSearchUsecase(database),
+		conversationUsecase: usecase.NewConversationUsecase(database),
+		qaExchangeUsecase:   usecase.NewQAExchangeUsecase(database),
+		authUsecase:         usecase.NewAuthUsecase(database),
+		markdown:            md,
+		templates:           templates,
+		db:                  database,
+		indexer:             newSemanticIndexer(database),
 	}
 
-	// ルーター設定
-	r := mux.NewRouter()
-	r.HandleFunc("/", server.handleHome).Methods("GET")
-	r.HandleFunc("/documents", server.handleDocuments).Methods("GET")
-	r.HandleFunc("/documents/{id}", server.handleDocumentDetail).Methods("GET")
-	r.HandleFunc("/fragments", server.handleFragments).Methods("GET")
-	r.HandleFunc("/fragments", server.handleCreateFragment).Methods("POST")
-	r.HandleFunc("/fragments/{id}", server.handleDeleteFragment).Methods("DELETE")
-	r.HandleFunc("/api/ai/create", server.handleAICreate).Methods("POST")
-	r.HandleFunc("/api/ai/compress", server.handleAICompress).Methods("POST")
-	r.HandleFunc("/api/documents/search", server.handleDocumentSearch).Methods("GET")
-	r.HandleFunc("/api/documents/{id}/ask", server.handleDocumentAsk).Methods("POST")
-	r.HandleFunc("/api/documents/ask", server.handleGlobalDocumentAsk).Methods("POST")
+	// 認証の準備（トークンがない場合はログインできないため、作成方法を表示する）
+	if deleted, err := server.authUsecase.DeleteExpiredSessions(); err != nil {
+		log.Printf("Failed to delete expired sessions: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Deleted %d expired sessions", deleted)
+	}
+	if count, err := server.authUsecase.CountAPITokens(); err != nil {
+		log.Fatal("Failed to count API tokens:", err)
+	} else if count == 0 {
+		fmt.Println("No API tokens exist yet. Create a user and a token to log in:")
+		fmt.Println("  insight user create --username <name> --role admin")
+		fmt.Println("  insight token create --user <name> --name <token name> --scope read,write,ai")
+	}
 
-	// 静的ファイルの配信
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
+	// ベクトルインデックスはリクエストの外で更新する
+	go server.indexer.Run(context.Background())
+
+	// ルーター設定
+	r := newRouter(server)
 
 	// サーバー起動
 	port := "8084"
@@ -92,6 +106,74 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, r))
 }
 
+// newRouter はすべてのルートを登録したルーターを作成する
+// ルートを追加した場合は openapi.go の openAPIOperations にも記載する
+// 必要な権限は auth.go の requiredScope でルートごとに決まる
+func newRouter(s *Server) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(s.authMiddleware)
+	r.HandleFunc("/login", s.handleLoginPage).Methods("GET")
+	r.HandleFunc("/login", s.handleLogin).Methods("POST")
+	r.HandleFunc("/logout", s.handleLogout).Methods("POST")
+	r.HandleFunc("/", s.handleHome).Methods("GET")
+	r.HandleFunc("/documents", s.handleDocuments).Methods("GET")
+	r.HandleFunc("/documents", s.handleCreateDocument).Methods("POST")
+	r.HandleFunc("/documents/new", s.handleNewDocument).Methods("GET")
+	r.HandleFunc("/documents/{id}", s.handleDocumentDetail).Methods("GET")
+	r.HandleFunc("/documents/{id}", s.handleUpdateDocument).Methods("PUT")
+	r.HandleFunc("/documents/{id}", s.handleDeleteDocument).Methods("DELETE")
+	r.HandleFunc("/documents/{id}/edit", s.handleEditDocument).Methods("GET")
+	r.HandleFunc("/fragments", s.handleFragments).Methods("GET")
+	r.HandleFunc("/fragments", s.handleCreateFragment).Methods("POST")
+	r.HandleFunc("/fragments/{id}", s.handleUpdateFragment).Methods("PUT")
+	r.HandleFunc("/fragments/{id}", s.handleDeleteFragment).Methods("DELETE")
+	r.HandleFunc("/api/fragments/{id}/revisions", s.handleFragmentRevisions).Methods("GET")
+	r.HandleFunc("/api/fragments/{id}/revisions/{revisionId}/restore", s.handleRestoreFragmentRevision).Methods("POST")
+	r.HandleFunc("/api/fragments/{id}/tags", s.handleFragmentTags).Methods("POST", "DELETE")
+	r.HandleFunc("/tags", s.handleTagTree).Methods("GET")
+	r.HandleFunc("/tags/{name:.+}", s.handleTagDetail).Methods("GET")
+	r.HandleFunc("/admin/tags", s.handleTagAdmin).Methods("GET")
+	r.HandleFunc("/api/tags", s.handleListTags).Methods("GET")
+	r.HandleFunc("/api/tags/merge", s.handleMergeTags).Methods("POST")
+	r.HandleFunc("/api/tags/prune", s.handlePruneTags).Methods("POST")
+	r.HandleFunc("/api/tags/{id}", s.handleUpdateTag).Methods("PUT")
+	r.HandleFunc("/api/tags/{id}", s.handleDeleteTag).Methods("DELETE")
+	r.HandleFunc("/api/tags/{id}/synonyms", s.handleTagSynonyms).Methods("POST", "DELETE")
+	r.HandleFunc("/api/ai/create", s.handleAICreate).Methods("POST")
+	r.HandleFunc("/api/ai/compress", s.handleAICompress).Methods("POST")
+	r.HandleFunc("/api/ai/tag", s.handleAITag).Methods("POST")
+	r.HandleFunc("/api/ai/tags/consolidate", s.handleAIConsolidateTags).Methods("POST")
+	r.HandleFunc("/api/documents/search", s.handleDocumentSearch).Methods("GET")
+	r.HandleFunc("/api/documents/preview", s.handleDocumentPreview).Methods("POST")
+	r.HandleFunc("/api/documents/{id}/revisions", s.handleDocumentRevisions).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/lock", s.handleLockDocument).Methods("POST", "DELETE")
+	r.HandleFunc("/api/documents/{id}/regenerate", s.handleRegenerateDocument).Methods("POST")
+	r.HandleFunc("/api/fragments/search", s.handleFragmentSearch).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/ask", s.handleDocumentAsk).Methods("POST")
+	r.HandleFunc("/api/documents/ask", s.handleGlobalDocumentAsk).Methods("POST")
+	r.HandleFunc("/api/fragments/ask", s.handleFragmentAsk).Methods("POST")
+	r.HandleFunc("/api/qa/agent", s.handleAgentAsk).Methods("POST")
+	r.HandleFunc("/qa", s.handleQAHistoryPage).Methods("GET")
+	r.HandleFunc("/api/qa/history", s.handleQAHistory).Methods("GET")
+	r.HandleFunc("/api/qa/{id}/feedback", s.handleQAFeedback).Methods("POST")
+	r.HandleFunc("/api/qa/{id}/fragment", s.handleQASaveFragment).Methods("POST")
+	r.HandleFunc("/conversations", s.handleConversations).Methods("GET")
+	r.HandleFunc("/api/conversations", s.handleListConversations).Methods("GET")
+	r.HandleFunc("/api/conversations/{id}", s.handleGetConversation).Methods("GET")
+	r.HandleFunc("/api/conversations/{id}", s.handleDeleteConversation).Methods("DELETE")
+	r.HandleFunc("/api/conversations/{id}/messages", s.handleConversationMessage).Methods("POST")
+	r.HandleFunc("/api/openapi.json", s.handleOpenAPI).Methods("GET")
+	r.HandleFunc("/api/docs", s.handleAPIDocs).Methods("GET")
+
+	// スクリプトなどから使うJSON API
+	s.registerAPIV1Routes(r)
+
+	// 静的ファイルの配信
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
+
+	return r
+}
+
 // parseMarkdown はMarkdownテキストをHTMLに変換します
 func (s *Server) parseMarkdown(source string) template.HTML {
 	var buf bytes.Buffer
@@ -137,30 +219,21 @@ func (s *Server) handleDocuments(w http.ResponseWriter, r *http.Request) {
 
 	if versionParam != "" {
 		// 特定のバージョンのドキュメントを取得
-		// 複数の時刻フォーマットを試行
-		var versionTime time.Time
-		var parseErr error
-
-		// ISO8601形式を試行
-		versionTime, parseErr = time.Parse("2006-01-02T15:04:05Z", versionParam)
+		versionTime, parseErr := usecase.ParseVersion(versionParam)
 		if parseErr != nil {
-			// RFC3339形式を試行
-			versionTime, parseErr = time.Parse(time.RFC3339, versionParam)
-			if parseErr != nil {
-				// データベース形式を試行
-				versionTime, parseErr = time.Parse("2006-01-02 15:04:05.999999-07:00", versionParam)
-				if parseErr != nil {
-					http.Error(w, "Invalid version format", http.StatusBadRequest)
-					return
-				}
-			}
+			http.Error(w, "Invalid version format", http.StatusBadRequest)
+			return
 		}
 		documents, err = s.documentUsecase.GetDocumentsByVersion(versionTime)
 		selectedVersion = versionParam
 	} else {
-		// パラメータが指定されていない場合は最新バージョンを使用
-		if len(versions) > 0 {
-			latestVersion := versions[0] // versions は既に DESC でソートされている
+		// パラメータが指定されていない場合は最新バージョン（スコープ付きの生成を除く）を使用
+		latestVersion, latestErr := s.documentUsecase.GetLatestVersion()
+		if latestErr != nil {
+			http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+			return
+		}
+		if !latestVersion.IsZero() {
 			documents, err = s.documentUsecase.GetDocumentsByVersion(latestVersion)
 			selectedVersion = latestVersion.Format("2006-01-02 15:04:05.999999-07:00")
 		} else {
@@ -174,14 +247,45 @@ func (s *Server) handleDocuments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// スコープ付きの生成で作られたバージョンには対象範囲を表示する
+	runs, err := usecase.NewGenerationRunUsecase(s.db).GetGenerationRuns()
+	if err != nil {
+		http.Error(w, "Failed to fetch generation runs", http.StatusInternalServerError)
+		return
+	}
+	versionLabels := make(map[string]string)
+	for _, run := range runs {
+		var labels []string
+		if run.Scoped {
+			labels = append(labels, "scoped: "+usecase.ScopeOf(&run).Describe())
+		}
+		if options := usecase.OptionsOf(&run); options != (usecase.GenerationOptions{}) {
+			labels = append(labels, options.Describe())
+		}
+		if len(labels) > 0 {
+			versionLabels[run.VersionCreatedAt.Format("2006-01-02 15:04:05.999999-07:00")] = strings.Join(labels, "; ")
+		}
+	}
+
+	// 親タグでの絞り込みに子タグが付いたドキュメントも含めるため、タグの祖先を渡す
+	tagLineages, err := usecase.NewTagUsecase(s.db).GetTagLineages()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		Documents       []interface{}
 		Versions        []time.Time
+		VersionLabels   map[string]string
 		SelectedVersion string
+		TagLineages     map[string]usecase.TagLineage
 	}{
 		Documents:       make([]interface{}, len(documents)),
 		Versions:        versions,
+		VersionLabels:   versionLabels,
 		SelectedVersion: selectedVersion,
+		TagLineages:     tagLineages,
 	}
 
 	for i, doc := range documents {
@@ -213,12 +317,22 @@ func (s *Server) handleDocumentDetail(w http.ResponseWriter, r *http.Request) {
 	// MarkdownをHTMLに変換
 	contentHTML := s.parseMarkdown(document.Content)
 
+	revisions, err := s.documentUsecase.GetDocumentRevisions(document.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		*models.Document
 		ContentHTML template.HTML
+		Suggestions []string
+		Revisions   []models.DocumentRevision
 	}{
 		Document:    document,
 		ContentHTML: contentHTML,
+		Suggestions: ai.SuggestedQuestionsFor(document),
+		Revisions:   revisions,
 	}
 
 	if err := s.executeTemplateWithLogging(w, "document_detail_page.go.tmpl", data); err != nil {
@@ -228,20 +342,104 @@ func (s *Server) handleDocumentDetail(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleFragments(w http.ResponseWriter, r *http.Request) {
-	fragments, err := s.fragmentUsecase.GetAllFragments()
+	// tags=a,b で指定したタグのいずれかが付いたフラグメントに、user=name で作成したユーザーに絞り込む
+	selectedTags := splitList(r.URL.Query().Get("tags"))
+	userUsecase := usecase.NewUserUsecase(s.db)
+	var selectedUser *models.User
+	if username := strings.TrimSpace(r.URL.Query().Get("user")); username != "" {
+		user, err := userUsecase.GetUserByUsername(username)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		selectedUser = user
+	}
+
+	var userID uint
+	if selectedUser != nil {
+		userID = selectedUser.ID
+	}
+	fragments, err := s.fragmentUsecase.GetFragmentsByTags(selectedTags, userID)
 	if err != nil {
 		http.Error(w, "Failed to fetch fragments", http.StatusInternalServerError)
 		return
 	}
 
+	users, err := userUsecase.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+	userCounts, err := s.fragmentUsecase.CountFragmentsByUser()
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	summaries, err := usecase.NewTagUsecase(s.db).GetTagSummaries()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	type tagFilter struct {
+		Name     string
+		Color    string
+		Count    int64
+		Selected bool
+	}
+
+	type userFilter struct {
+		Username string
+		Count    int64
+		Selected bool
+	}
+
 	data := struct {
-		Fragments []interface{}
+		Fragments    []interface{}
+		TagFilters   []tagFilter
+		SelectedTags string
+		UserFilters  []userFilter
+		SelectedUser string
+		Editable     map[uint]bool // ログイン中のユーザーが編集・削除できるフラグメント
 	}{
-		Fragments: make([]interface{}, len(fragments)),
+		Fragments:    make([]interface{}, len(fragments)),
+		SelectedTags: strings.Join(selectedTags, ","),
+		Editable:     make(map[uint]bool, len(fragments)),
+	}
+	if selectedUser != nil {
+		data.SelectedUser = selectedUser.Username
+	}
+
+	for _, user := range users {
+		selected := selectedUser != nil && selectedUser.ID == user.ID
+		if userCounts[user.ID] == 0 && !selected {
+			continue
+		}
+		data.UserFilters = append(data.UserFilters, userFilter{
+			Username: user.Username,
+			Count:    userCounts[user.ID],
+			Selected: selected,
+		})
+	}
+
+	for _, summary := range summaries {
+		selected := slices.Contains(selectedTags, summary.Name)
+		if summary.FragmentCount == 0 && !selected {
+			continue
+		}
+		data.TagFilters = append(data.TagFilters, tagFilter{
+			Name:     summary.Name,
+			Color:    summary.Color,
+			Count:    summary.FragmentCount,
+			Selected: selected,
+		})
 	}
 
+	viewer := currentUser(r)
 	for i, fragment := range fragments {
 		data.Fragments[i] = fragment
+		data.Editable[fragment.ID] = viewer.CanModifyFragment(&fragment)
 	}
 
 	if err := s.executeTemplateWithLogging(w, "fragments_page.go.tmpl", data); err != nil {
@@ -264,6 +462,7 @@ func (s *Server) handleCreateFragment(w http.ResponseWriter, r *http.Request) {
 
 	input := usecase.CreateFragmentInput{
 		Content: content,
+		UserID:  currentUserID(r),
 	}
 
 	_, err := s.fragmentUsecase.CreateFragment(input)
@@ -272,11 +471,27 @@ func (s *Server) handleCreateFragment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.refreshSemanticIndex(r)
+
 	// フラグメント一覧にリダイレクト
 	http.Redirect(w, r, "/fragments", http.StatusSeeOther)
 }
 
 func (s *Server) handleAICreate(w http.ResponseWriter, r *http.Request) {
+	// 対象範囲（tags / since / until / fragment_ids）を指定した場合はスコープ付きのバージョンとして作成
+	scope, err := parseGenerationScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 生成パラメータ（instructions / audience / style / granularity / target_documents）
+	options, err := parseGenerationOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// AIサービス初期化
 	aiService, err := ai.NewService(s.db)
 	if err != nil {
@@ -285,7 +500,7 @@ func (s *Server) handleAICreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// ドキュメント作成
-	err = aiService.CreateDocuments(context.Background())
+	err = aiService.CreateDocuments(context.Background(), scope, options)
 	if err != nil {
 		http.Error(w, "Failed to create documents", http.StatusInternalServerError)
 		return
@@ -299,6 +514,56 @@ func (s *Server) handleAICreate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// parseGenerationScope はドキュメント生成の対象範囲をリクエストから取り出す
+func parseGenerationScope(r *http.Request) (usecase.GenerationScope, error) {
+	var scope usecase.GenerationScope
+	if err := r.ParseForm(); err != nil {
+		return scope, fmt.Errorf("failed to parse form")
+	}
+
+	scope.Tags = splitList(r.FormValue("tags"))
+	if value := r.FormValue("since"); value != "" {
+		since, err := usecase.ParseDate(value)
+		if err != nil {
+			return scope, fmt.Errorf("invalid since: %s", value)
+		}
+		scope.Since = &since
+	}
+	if value := r.FormValue("until"); value != "" {
+		until, err := usecase.ParseDateUntil(value)
+		if err != nil {
+			return scope, fmt.Errorf("invalid until: %s", value)
+		}
+		scope.Until = &until
+	}
+	for _, value := range splitList(r.FormValue("fragment_ids")) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return scope, fmt.Errorf("invalid fragment ID: %s", value)
+		}
+		scope.FragmentIDs = append(scope.FragmentIDs, uint(id))
+	}
+	return scope, nil
+}
+
+// parseGenerationOptions はドキュメント生成のパラメータをリクエストから取り出す
+func parseGenerationOptions(r *http.Request) (usecase.GenerationOptions, error) {
+	options := usecase.GenerationOptions{
+		Instructions: strings.TrimSpace(r.FormValue("instructions")),
+		Audience:     strings.TrimSpace(r.FormValue("audience")),
+		Style:        r.FormValue("style"),
+		Granularity:  r.FormValue("granularity"),
+	}
+	if value := r.FormValue("target_documents"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid target_documents: %s", value)
+		}
+		options.TargetDocuments = count
+	}
+	return options, options.Validate()
+}
+
 func (s *Server) handleDocumentSearch(w http.ResponseWriter, r *http.Request) {
 	query := strings.TrimSpace(r.URL.Query().Get("q"))
 	if query == "" {
@@ -306,32 +571,158 @@ func (s *Server) handleDocumentSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 全ドキュメントを取得
-	documents, err := s.documentUsecase.GetAllDocuments()
+	// セマンティック検索モード
+	if r.URL.Query().Get("mode") == "semantic" {
+		s.handleSemanticSearch(w, r, query)
+		return
+	}
+
+	input := usecase.SearchDocumentsInput{Query: query}
+	if err := parseSearchParams(r, &input.Tags, &input.Since, &input.Until, &input.Page, &input.PerPage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if versionParam := r.URL.Query().Get("version"); versionParam != "" {
+		version, err := usecase.ParseVersion(versionParam)
+		if err != nil {
+			http.Error(w, "Invalid version format", http.StatusBadRequest)
+			return
+		}
+		input.Version = &version
+	}
+
+	result, err := s.searchUsecase.SearchDocuments(input)
 	if err != nil {
-		http.Error(w, "Failed to fetch documents", http.StatusInternalServerError)
+		log.Printf("Document search error: %v", err)
+		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
 		return
 	}
 
-	// クライアントサイドでの検索用に全ドキュメントをJSONで返す
-	// 部分一致検索はJavaScript側で実行
-	var searchableDocuments []map[string]interface{}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":    query,
+		"mode":     "keyword",
+		"hits":     result.Hits,
+		"total":    result.Total,
+		"page":     result.Page,
+		"per_page": result.PerPage,
+	})
+}
 
-	for _, doc := range documents {
-		searchableDocuments = append(searchableDocuments, map[string]interface{}{
-			"id":                 doc.ID,
-			"title":              doc.Title,
-			"summary":            doc.Summary,
-			"content":            doc.Content,
-			"created_at":         doc.CreatedAt.Format("2006-01-02 15:04:05"),
-			"version_created_at": doc.VersionCreatedAt.Format("2006-01-02 15:04:05.999999-07:00"),
-		})
+// parseSearchParams は検索APIで共通のクエリパラメータ（tags, since, until, page, per_page）を解釈する
+func parseSearchParams(r *http.Request, tags *[]string, since, until **time.Time, page, perPage *int) error {
+	q := r.URL.Query()
+
+	*tags = append(*tags, splitList(q.Get("tags"))...)
+
+	if sinceParam := q.Get("since"); sinceParam != "" {
+		t, err := usecase.ParseDate(sinceParam)
+		if err != nil {
+			return fmt.Errorf("invalid since: %s", sinceParam)
+		}
+		*since = &t
+	}
+
+	if untilParam := q.Get("until"); untilParam != "" {
+		t, err := usecase.ParseDateUntil(untilParam)
+		if err != nil {
+			return fmt.Errorf("invalid until: %s", untilParam)
+		}
+		*until = &t
+	}
+
+	for name, target := range map[string]*int{"page": page, "per_page": perPage} {
+		if value := q.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("invalid %s: %s", name, value)
+			}
+			*target = parsed
+		}
+	}
+
+	return nil
+}
+
+// splitList はカンマ区切りの値を空要素を除いて分割する
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *Server) handleFragmentSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		return
+	}
+
+	input := usecase.SearchFragmentsInput{Query: query}
+	if err := parseSearchParams(r, &input.Tags, &input.Since, &input.Until, &input.Page, &input.PerPage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.searchUsecase.SearchFragments(input)
+	if err != nil {
+		log.Printf("Fragment search error: %v", err)
+		http.Error(w, "Failed to search fragments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":    query,
+		"hits":     result.Hits,
+		"total":    result.Total,
+		"page":     result.Page,
+		"per_page": result.PerPage,
+	})
+}
+
+func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request, query string) {
+	limit := 10
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// 検索対象の種別（document / fragment）
+	var ownerTypes []string
+	if typeParam := r.URL.Query().Get("type"); typeParam != "" {
+		ownerTypes = strings.Split(typeParam, ",")
+	}
+
+	aiService, err := ai.NewService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create AI service", http.StatusInternalServerError)
+		return
+	}
+
+	hits, err := aiService.SemanticSearch(r.Context(), query, ai.SemanticSearchOptions{
+		Limit:      limit,
+		OwnerTypes: ownerTypes,
+	})
+	if err != nil {
+		log.Printf("Semantic search error: %v", err)
+		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"documents": searchableDocuments,
-		"query":     query,
+		"query": query,
+		"mode":  "semantic",
+		"hits":  hits,
 	})
 }
 
@@ -344,12 +735,15 @@ func (s *Server) handleAICompress(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// フラグメント圧縮
-	err = aiService.CompressFragments(context.Background())
+	// 実行した管理者を適用の承認者として記録する
+	err = aiService.CompressFragments(context.Background(), currentUserID(r))
 	if err != nil {
 		http.Error(w, "Failed to compress fragments", http.StatusInternalServerError)
 		return
 	}
 
+	s.refreshSemanticIndex(r)
+
 	// JSON レスポンス
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -358,6 +752,74 @@ func (s *Server) handleAICompress(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handleAITag(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	// fragment_ids を指定しない場合はタグのないフラグメント、all=true の場合はすべてが対象
+	var fragmentIDs []uint
+	for _, value := range splitList(r.FormValue("fragment_ids")) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid fragment ID: "+value, http.StatusBadRequest)
+			return
+		}
+		fragmentIDs = append(fragmentIDs, uint(id))
+	}
+	all := r.FormValue("all") == "true"
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create AI service", http.StatusInternalServerError)
+		return
+	}
+
+	results, err := aiService.AutoTagFragments(context.Background(), fragmentIDs, all)
+	if err != nil {
+		http.Error(w, "Failed to tag fragments", http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []ai.FragmentTagResult{}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"results": results,
+	})
+}
+
+// handleAIConsolidateTags はタグの統合案を返す（適用は /api/tags/merge で行う）
+func (s *Server) handleAIConsolidateTags(w http.ResponseWriter, r *http.Request) {
+	// AIサービス初期化
+	aiService, err := ai.NewService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create AI service", http.StatusInternalServerError)
+		return
+	}
+
+	proposals, err := aiService.ProposeTagMerges(context.Background())
+	if err != nil {
+		http.Error(w, "Failed to propose tag merges", http.StatusInternalServerError)
+		return
+	}
+	if proposals == nil {
+		proposals = []ai.TagMergeProposal{}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"proposals": proposals,
+	})
+}
+
 func (s *Server) handleDocumentAsk(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -381,6 +843,12 @@ func (s *Server) handleDocumentAsk(w http.ResponseWriter, r *http.Request) {
 
 	useWebSearch := r.FormValue("web_search") == "true"
 
+	conversationID, err := parseConversationID(r)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
 	// QAサービス初期化
 	qaService, err := ai.NewQAService(s.db)
 	if err != nil {
@@ -390,9 +858,11 @@ func (s *Server) handleDocumentAsk(w http.ResponseWriter, r *http.Request) {
 
 	// 質問応答実行
 	qaRequest := ai.QARequest{
-		DocumentID:   uint(id),
-		Question:     question,
-		UseWebSearch: useWebSearch,
+		DocumentID:     uint(id),
+		Question:       question,
+		UseWebSearch:   useWebSearch,
+		ConversationID: conversationID,
+		UserID:         currentUserID(r),
 	}
 
 	response, err := qaService.AskQuestion(context.Background(), qaRequest)
@@ -420,6 +890,12 @@ func (s *Server) handleGlobalDocumentAsk(w http.ResponseWriter, r *http.Request)
 
 	useWebSearch := r.FormValue("web_search") == "true"
 
+	conversationID, err := parseConversationID(r)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
 	// QAサービス初期化
 	qaService, err := ai.NewQAService(s.db)
 	if err != nil {
@@ -429,8 +905,29 @@ func (s *Server) handleGlobalDocumentAsk(w http.ResponseWriter, r *http.Request)
 
 	// 全ドキュメント質問応答実行
 	qaRequest := ai.GlobalQARequest{
-		Question:     question,
-		UseWebSearch: useWebSearch,
+		Question:       question,
+		UseWebSearch:   useWebSearch,
+		ConversationID: conversationID,
+		UserID:         currentUserID(r),
+		Tags:           splitList(r.FormValue("tags")),
+	}
+
+	// 対象範囲（バージョン・ドキュメントID）
+	if versionParam := r.FormValue("version"); versionParam != "" {
+		version, err := usecase.ParseVersion(versionParam)
+		if err != nil {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+		qaRequest.Version = &version
+	}
+	for _, value := range splitList(r.FormValue("document_ids")) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid document_ids", http.StatusBadRequest)
+			return
+		}
+		qaRequest.DocumentIDs = append(qaRequest.DocumentIDs, uint(id))
 	}
 
 	response, err := qaService.AskGlobalQuestion(context.Background(), qaRequest)
@@ -444,38 +941,1332 @@ func (s *Server) handleGlobalDocumentAsk(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleDeleteFragment(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
+func (s *Server) handleFragmentAsk(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
 
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	question := r.FormValue("question")
+	if question == "" {
+		http.Error(w, "Question is required", http.StatusBadRequest)
+		return
+	}
+
+	conversationID, err := parseConversationID(r)
 	if err != nil {
-		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
 		return
 	}
 
-	// フラグメントが存在するかチェック
-	fragment, err := s.fragmentUsecase.GetFragment(uint(id))
+	qaRequest := ai.FragmentQARequest{
+		Question:       question,
+		UseWebSearch:   r.FormValue("web_search") == "true",
+		ConversationID: conversationID,
+		UserID:         currentUserID(r),
+		Tags:           splitList(r.FormValue("tags")),
+	}
+
+	// 対象期間
+	if sinceParam := r.FormValue("since"); sinceParam != "" {
+		since, err := usecase.ParseDate(sinceParam)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		qaRequest.Since = &since
+	}
+	if untilParam := r.FormValue("until"); untilParam != "" {
+		until, err := usecase.ParseDateUntil(untilParam)
+		if err != nil {
+			http.Error(w, "Invalid until", http.StatusBadRequest)
+			return
+		}
+		qaRequest.Until = &until
+	}
+
+	// QAサービス初期化
+	qaService, err := ai.NewQAService(s.db)
 	if err != nil {
-		http.Error(w, "Fragment not found", http.StatusNotFound)
+		http.Error(w, "Failed to create QA service", http.StatusInternalServerError)
 		return
 	}
 
-	// 削除実行
-	err = s.fragmentUsecase.DeleteFragment(uint(id))
+	response, err := qaService.AskFragmentQuestion(context.Background(), qaRequest)
 	if err != nil {
-		http.Error(w, "Failed to delete fragment", http.StatusInternalServerError)
+		http.Error(w, "Failed to process question", http.StatusInternalServerError)
 		return
 	}
 
 	// JSON レスポンス
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "success",
-		"message": "Fragment deleted successfully",
-		"fragment": map[string]interface{}{
-			"id":      fragment.ID,
-			"content": fragment.Content,
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleAgentAsk(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	question := r.FormValue("question")
+	if question == "" {
+		http.Error(w, "Question is required", http.StatusBadRequest)
+		return
+	}
+
+	conversationID, err := parseConversationID(r)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	qaRequest := ai.AgentQARequest{
+		Question:       question,
+		ConversationID: conversationID,
+		UserID:         currentUserID(r),
+	}
+	if value := r.FormValue("max_steps"); value != "" {
+		maxSteps, err := strconv.Atoi(value)
+		if err != nil || maxSteps <= 0 {
+			http.Error(w, "Invalid max_steps", http.StatusBadRequest)
+			return
+		}
+		qaRequest.MaxSteps = maxSteps
+	}
+
+	// QAサービス初期化
+	qaService, err := ai.NewQAService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create QA service", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := qaService.AskWithTools(context.Background(), qaRequest)
+	if err != nil {
+		http.Error(w, "Failed to process question", http.StatusInternalServerError)
+		return
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseConversationID はフォームのconversation_idを取得する（未指定の場合は0）
+func parseConversationID(r *http.Request) (uint, error) {
+	value := r.FormValue("conversation_id")
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// parseQAHistoryParams は質問応答履歴の検索条件をクエリパラメータから取得する
+func parseQAHistoryParams(r *http.Request) (usecase.QAHistoryInput, error) {
+	query := r.URL.Query()
+	input := usecase.QAHistoryInput{
+		Scope: query.Get("scope"),
+		Limit: 100,
+	}
+
+	if value := query.Get("document_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return input, fmt.Errorf("invalid document_id: %w", err)
+		}
+		input.DocumentID = uint(id)
+	}
+	if value := query.Get("feedback"); value != "" {
+		feedback, err := strconv.Atoi(value)
+		if err != nil {
+			return input, fmt.Errorf("invalid feedback: %w", err)
+		}
+		input.Feedback = &feedback
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return input, fmt.Errorf("invalid limit: %w", err)
+		}
+		input.Limit = limit
+	}
+
+	return input, nil
+}
+
+func (s *Server) handleQAHistoryPage(w http.ResponseWriter, r *http.Request) {
+	input, err := parseQAHistoryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exchanges, err := s.qaExchangeUsecase.GetHistory(input)
+	if err != nil {
+		http.Error(w, "Failed to fetch QA history", http.StatusInternalServerError)
+		return
+	}
+
+	// 回答はMarkdownとして表示
+	renderedAnswers := make(map[uint]template.HTML, len(exchanges))
+	for _, exchange := range exchanges {
+		renderedAnswers[exchange.ID] = s.parseMarkdown(exchange.Answer)
+	}
+
+	data := struct {
+		Exchanges       []models.QAExchange
+		RenderedAnswers map[uint]template.HTML
+		Scope           string
+		Feedback        string
+	}{
+		Exchanges:       exchanges,
+		RenderedAnswers: renderedAnswers,
+		Scope:           input.Scope,
+		Feedback:        r.URL.Query().Get("feedback"),
+	}
+
+	if err := s.executeTemplateWithLogging(w, "qa_history_page.go.tmpl", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleQAHistory(w http.ResponseWriter, r *http.Request) {
+	input, err := parseQAHistoryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exchanges, err := s.qaExchangeUsecase.GetHistory(input)
+	if err != nil {
+		http.Error(w, "Failed to fetch QA history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exchanges)
+}
+
+func (s *Server) handleQAFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid exchange ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	rating, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || (rating != models.FeedbackUp && rating != models.FeedbackDown && rating != 0) {
+		http.Error(w, "Rating must be 1, -1 or 0", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.qaExchangeUsecase.GetExchange(uint(id)); err != nil {
+		http.Error(w, "Exchange not found", http.StatusNotFound)
+		return
+	}
+
+	exchange, err := s.qaExchangeUsecase.SetFeedback(usecase.SetFeedbackInput{
+		ExchangeID: uint(id),
+		Rating:     rating,
+		Comment:    r.FormValue("comment"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to save feedback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"feedback": exchange.Feedback,
+	})
+}
+
+func (s *Server) handleQASaveFragment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid exchange ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.qaExchangeUsecase.GetExchange(uint(id)); err != nil {
+		http.Error(w, "Exchange not found", http.StatusNotFound)
+		return
+	}
+
+	fragment, err := s.qaExchangeUsecase.SaveAsFragment(uint(id), currentUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to save answer as fragment", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"fragment_id": fragment.ID,
+	})
+}
+
+func (s *Server) handleConversations(w http.ResponseWriter, r *http.Request) {
+	conversations, err := s.conversationUsecase.GetAllConversations()
+	if err != nil {
+		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
+
+	// 選択中のスレッド
+	var selected *models.Conversation
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+			return
+		}
+		selected, err = s.conversationUsecase.GetConversation(uint(id))
+		if err != nil {
+			http.Error(w, "Conversation not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	// アシスタントの回答はMarkdownとして表示
+	renderedMessages := make(map[uint]template.HTML)
+	if selected != nil {
+		for _, message := range selected.Messages {
+			if message.Role == models.MessageRoleAssistant {
+				renderedMessages[message.ID] = s.parseMarkdown(message.Content)
+			}
+		}
+	}
+
+	data := struct {
+		Conversations    []models.Conversation
+		Selected         *models.Conversation
+		RenderedMessages map[uint]template.HTML
+	}{
+		Conversations:    conversations,
+		Selected:         selected,
+		RenderedMessages: renderedMessages,
+	}
+
+	if err := s.executeTemplateWithLogging(w, "conversations_page.go.tmpl", data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	conversations, err := s.conversationUsecase.GetAllConversations()
+	if err != nil {
+		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversations)
+}
+
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	conversation, err := s.conversationUsecase.GetConversation(uint(id))
+	if err != nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+func (s *Server) handleConversationMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	question := r.FormValue("question")
+	if question == "" {
+		http.Error(w, "Question is required", http.StatusBadRequest)
+		return
+	}
+
+	// スレッドが存在するかチェック
+	if _, err := s.conversationUsecase.GetConversation(uint(id)); err != nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// QAサービス初期化
+	qaService, err := ai.NewQAService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create QA service", http.StatusInternalServerError)
+		return
+	}
+
+	response, err := qaService.ContinueConversation(context.Background(), ai.ConversationRequest{
+		ConversationID: uint(id),
+		Question:       question,
+		UseWebSearch:   r.FormValue("web_search") == "true",
+		UserID:         currentUserID(r),
+	})
+	if err != nil {
+		http.Error(w, "Failed to process question", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.conversationUsecase.GetConversation(uint(id)); err != nil {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.conversationUsecase.DeleteConversation(uint(id)); err != nil {
+		http.Error(w, "Failed to delete conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Conversation deleted successfully",
+	})
+}
+
+func (s *Server) handleUpdateFragment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+	if !currentUser(r).CanModifyFragment(existing) {
+		http.Error(w, "Only the author or an admin can edit this fragment", http.StatusForbidden)
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.UpdateFragment(usecase.UpdateFragmentInput{
+		ID:      uint(id),
+		Content: content,
+	})
+	if err != nil {
+		http.Error(w, "Failed to update fragment", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Fragment updated successfully",
+		"fragment": map[string]interface{}{
+			"id":         fragment.ID,
+			"content":    fragment.Content,
+			"updated_at": fragment.UpdatedAt,
+		},
+	})
+}
+
+func (s *Server) handleFragmentRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.fragmentUsecase.GetFragment(uint(id)); err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := s.fragmentUsecase.GetFragmentRevisions(uint(id))
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]map[string]interface{}, len(revisions))
+	for i, revision := range revisions {
+		results[i] = map[string]interface{}{
+			"id":         revision.ID,
+			"content":    revision.Content,
+			"created_at": revision.CreatedAt,
+		}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"fragment_id": id,
+		"revisions":   results,
+	})
+}
+
+func (s *Server) handleRestoreFragmentRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		return
+	}
+	revisionID, err := strconv.ParseUint(vars["revisionId"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+	if !currentUser(r).CanModifyFragment(existing) {
+		http.Error(w, "Only the author or an admin can restore this fragment", http.StatusForbidden)
+		return
+	}
+
+	fragment, err := s.fragmentUsecase.RestoreFragmentRevision(uint(id), uint(revisionID))
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Fragment restored successfully",
+		"fragment": map[string]interface{}{
+			"id":         fragment.ID,
+			"content":    fragment.Content,
+			"updated_at": fragment.UpdatedAt,
+		},
+	})
+}
+
+func (s *Server) handleDeleteFragment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		return
+	}
+
+	// フラグメントが存在するかチェック
+	fragment, err := s.fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+	if !currentUser(r).CanModifyFragment(fragment) {
+		http.Error(w, "Only the author or an admin can delete this fragment", http.StatusForbidden)
+		return
+	}
+
+	// 削除実行
+	err = s.fragmentUsecase.DeleteFragment(uint(id))
+	if err != nil {
+		http.Error(w, "Failed to delete fragment", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Fragment deleted successfully",
+		"fragment": map[string]interface{}{
+			"id":      fragment.ID,
+			"content": fragment.Content,
+		},
+	})
+}
+
+func (s *Server) handleNewDocument(w http.ResponseWriter, r *http.Request) {
+	s.renderDocumentEditor(w, r, nil)
+}
+
+func (s *Server) handleEditDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	document, err := s.documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	s.renderDocumentEditor(w, r, document)
+}
+
+// renderDocumentEditor はドキュメントの作成・編集ページを表示する（document が nil の場合は新規作成）
+func (s *Server) renderDocumentEditor(w http.ResponseWriter, r *http.Request, document *models.Document) {
+	data := struct {
+		Document *models.Document
+		TagNames string
+		Username string
+	}{
+		Document: document,
+		Username: currentUser(r).Username,
+	}
+
+	if document != nil {
+		names := make([]string, len(document.Tags))
+		for i, tag := range document.Tags {
+			names[i] = tag.Name
+		}
+		data.TagNames = strings.Join(names, ", ")
+	}
+
+	if err := s.executeTemplateWithLogging(w, "document_editor_page.go.tmpl", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// documentForm はドキュメントの作成・編集フォームの入力（編集者はログイン中のユーザー）
+type documentForm struct {
+	Title   string
+	Summary string
+	Content string
+	Tags    []string
+}
+
+func parseDocumentForm(r *http.Request) (*documentForm, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("failed to parse form")
+	}
+
+	form := &documentForm{
+		Title:   strings.TrimSpace(r.FormValue("title")),
+		Summary: strings.TrimSpace(r.FormValue("summary")),
+		Content: strings.TrimSpace(r.FormValue("content")),
+		Tags:    splitList(r.FormValue("tags")),
+	}
+	if form.Title == "" || form.Summary == "" || form.Content == "" {
+		return nil, fmt.Errorf("title, summary and content are required")
+	}
+	return form, nil
+}
+
+func (s *Server) handleCreateDocument(w http.ResponseWriter, r *http.Request) {
+	form, err := parseDocumentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tagIDs, err := usecase.NewTagUsecase(s.db).GetOrCreateTags(form.Tags)
+	if err != nil {
+		http.Error(w, "Failed to create tags", http.StatusInternalServerError)
+		return
+	}
+
+	// 人が作成したドキュメントは最新バージョンに追加
+	version, err := s.documentUsecase.CurrentVersion()
+	if err != nil {
+		http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+		return
+	}
+
+	document, err := s.documentUsecase.CreateDocument(usecase.CreateDocumentInput{
+		Title:            form.Title,
+		Summary:          form.Summary,
+		Content:          form.Content,
+		VersionCreatedAt: version,
+		TagIDs:           tagIDs,
+		Author:           currentUser(r).Username,
+		UserID:           currentUserID(r),
+	})
+	if err != nil {
+		http.Error(w, "Failed to create document", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	s.refreshSuggestedQuestions(r, document.ID)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Document created successfully",
+		"document": map[string]interface{}{
+			"id":    document.ID,
+			"title": document.Title,
+		},
+	})
+}
+
+func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	form, err := parseDocumentForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.documentUsecase.GetDocument(uint(id)); err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	tagIDs, err := usecase.NewTagUsecase(s.db).GetOrCreateTags(form.Tags)
+	if err != nil {
+		http.Error(w, "Failed to create tags", http.StatusInternalServerError)
+		return
+	}
+	if tagIDs == nil {
+		// フォームでは常にタグ全体を送るため、空の場合はタグを外す
+		tagIDs = []uint{}
+	}
+
+	document, err := s.documentUsecase.UpdateDocument(usecase.UpdateDocumentInput{
+		ID:      uint(id),
+		Title:   form.Title,
+		Summary: form.Summary,
+		Content: form.Content,
+		TagIDs:  tagIDs,
+		Author:  currentUser(r).Username,
+		UserID:  currentUserID(r),
+	})
+	if err != nil {
+		http.Error(w, "Failed to update document", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	s.refreshSuggestedQuestions(r, document.ID)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Document updated successfully",
+		"document": map[string]interface{}{
+			"id":              document.ID,
+			"title":           document.Title,
+			"edited_by_human": document.EditedByHuman,
+			"updated_at":      document.UpdatedAt,
+		},
+	})
+}
+
+// refreshSuggestedQuestions は編集されたドキュメントの質問候補を再生成する（失敗しても編集は完了している）
+// リクエストの中で実行し、クライアントが切断した場合は中断する
+func (s *Server) refreshSuggestedQuestions(r *http.Request, documentID uint) {
+	// AIの呼び出しは ai 権限が必要（ない場合は ai suggest で再生成されるまで古い候補を表示しない）
+	if !canUseAI(r) {
+		return
+	}
+	aiService, err := ai.NewService(s.db)
+	if err == nil {
+		err = aiService.RefreshSuggestedQuestions(r.Context(), []uint{documentID})
+	}
+	if err != nil {
+		log.Printf("Suggested questions for document %d were not updated: %v", documentID, err)
+	}
+}
+
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	// ドキュメントが存在するかチェック
+	document, err := s.documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.documentUsecase.DeleteDocument(document.ID); err != nil {
+		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Document deleted successfully",
+		"document": map[string]interface{}{
+			"id":    document.ID,
+			"title": document.Title,
+		},
+	})
+}
+
+func (s *Server) handleDocumentPreview(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	// 詳細ページと同じレンダラーでプレビューする
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"html": s.parseMarkdown(r.FormValue("content")),
+	})
+}
+
+func (s *Server) handleDocumentRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.documentUsecase.GetDocument(uint(id)); err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := s.documentUsecase.GetDocumentRevisions(uint(id))
+	if err != nil {
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]map[string]interface{}, len(revisions))
+	for i, revision := range revisions {
+		results[i] = map[string]interface{}{
+			"id":         revision.ID,
+			"author":     revision.Author,
+			"title":      revision.Title,
+			"summary":    revision.Summary,
+			"content":    revision.Content,
+			"created_at": revision.CreatedAt,
+		}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"document_id": id,
+		"revisions":   results,
+	})
+}
+
+// handleLockDocument はPOSTでドキュメントを固定し、DELETEで固定を解除する
+// handleFragmentTags は POST でフラグメントにタグを追加し、DELETE で外す（tags=a,b）
+func (s *Server) handleFragmentTags(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid fragment ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	tags := splitList(r.FormValue("tags"))
+	if len(tags) == 0 {
+		http.Error(w, "Tags are required", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.fragmentUsecase.GetFragment(uint(id))
+	if err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+	if !currentUser(r).CanModifyFragment(existing) {
+		http.Error(w, "Only the author or an admin can tag this fragment", http.StatusForbidden)
+		return
+	}
+
+	var fragment *models.Fragment
+	if r.Method == http.MethodPost {
+		fragment, err = s.fragmentUsecase.AddFragmentTags(uint(id), tags)
+	} else {
+		fragment, err = s.fragmentUsecase.RemoveFragmentTags(uint(id), tags)
+	}
+	if err != nil {
+		http.Error(w, "Fragment not found", http.StatusNotFound)
+		return
+	}
+
+	tagList := make([]map[string]interface{}, len(fragment.Tags))
+	for i, tag := range fragment.Tags {
+		tagList[i] = map[string]interface{}{
+			"name":  tag.Name,
+			"color": tag.Color,
+		}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"fragment": map[string]interface{}{
+			"id":   fragment.ID,
+			"tags": tagList,
+		},
+	})
+}
+
+func (s *Server) handleTagTree(w http.ResponseWriter, r *http.Request) {
+	roots, err := usecase.NewTagUsecase(s.db).GetTagTree()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Roots []*usecase.TagNode
+	}{
+		Roots: roots,
+	}
+
+	if err := s.executeTemplateWithLogging(w, "tags_page.go.tmpl", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleTagDetail はタグ（子孫のタグを含む）が付いたドキュメントとフラグメントを表示する
+// ドキュメントは ?version= のバージョン（省略時は最新バージョン）のものを表示する
+func (s *Server) handleTagDetail(w http.ResponseWriter, r *http.Request) {
+	tagUsecase := usecase.NewTagUsecase(s.db)
+	tag, err := tagUsecase.GetTagByName(mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	ancestors, err := tagUsecase.GetTagAncestors(tag)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+	children, err := tagUsecase.GetChildTags(tag.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	tagNames := []string{tag.Name}
+	versionCounts, err := s.documentUsecase.CountDocumentsByVersionWithTags(tagNames)
+	if err != nil {
+		http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+		return
+	}
+
+	// バージョンはナノ秒まで含めて指定させる（マイクロ秒に丸めると一致しない）
+	var version time.Time
+	if versionParam := r.URL.Query().Get("version"); versionParam != "" {
+		if version, err = usecase.ParseVersion(versionParam); err != nil {
+			http.Error(w, "Invalid version format", http.StatusBadRequest)
+			return
+		}
+	} else if version, err = s.documentUsecase.GetLatestVersion(); err != nil {
+		http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+		return
+	}
+
+	documents := []models.Document{}
+	if !version.IsZero() {
+		if documents, err = s.documentUsecase.GetDocumentsByVersionWithTags(version, tagNames); err != nil {
+			http.Error(w, "Failed to fetch documents", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	fragments, err := s.fragmentUsecase.GetFragmentsByTags(tagNames, 0)
+	if err != nil {
+		http.Error(w, "Failed to fetch fragments", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Tag             *models.Tag
+		Ancestors       []models.Tag
+		Children        []models.Tag
+		VersionCounts   []usecase.VersionDocumentCount
+		SelectedVersion string
+		Documents       []models.Document
+		Fragments       []models.Fragment
+	}{
+		Tag:             tag,
+		Ancestors:       ancestors,
+		Children:        children,
+		VersionCounts:   versionCounts,
+		SelectedVersion: version.Format("2006-01-02 15:04:05.999999999-07:00"),
+		Documents:       documents,
+		Fragments:       fragments,
+	}
+
+	if err := s.executeTemplateWithLogging(w, "tag_detail_page.go.tmpl", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleTagAdmin(w http.ResponseWriter, r *http.Request) {
+	summaries, err := usecase.NewTagUsecase(s.db).GetTagSummaries()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Tags []usecase.TagSummary
+	}{
+		Tags: summaries,
+	}
+
+	if err := s.executeTemplateWithLogging(w, "tag_admin_page.go.tmpl", data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	summaries, err := usecase.NewTagUsecase(s.db).GetTagSummaries()
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+	if summaries == nil {
+		summaries = []usecase.TagSummary{}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"tags":   summaries,
+	})
+}
+
+// tagFromRequest はパスのIDからタグを取得する（見つからない場合はエラーレスポンスを書き込み nil を返す）
+func (s *Server) tagFromRequest(w http.ResponseWriter, r *http.Request) *models.Tag {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return nil
+	}
+
+	tag, err := usecase.NewTagUsecase(s.db).GetTag(uint(id))
+	if err != nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return nil
+	}
+	return tag
+}
+
+// handleUpdateTag はタグの名前（name）と色（color）を変更する
+func (s *Server) handleUpdateTag(w http.ResponseWriter, r *http.Request) {
+	tag := s.tagFromRequest(w, r)
+	if tag == nil {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	// 名前・色・親タグの変更はまとめて適用し、いずれかが不正な場合はどれも変更しない
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		tagUsecase := usecase.NewTagUsecase(tx)
+		var err error
+		if name := strings.TrimSpace(r.FormValue("name")); name != "" && name != tag.Name {
+			if tag, err = tagUsecase.RenameTag(tag.Name, name); err != nil {
+				return err
+			}
+		}
+		if color := r.FormValue("color"); color != "" && color != tag.Color {
+			if tag, err = tagUsecase.SetTagColor(tag.Name, color); err != nil {
+				return err
+			}
+		}
+		// parent は空文字で最上位にするため、値ではなく指定の有無で判定する
+		if _, ok := r.Form["parent"]; ok {
+			if tag, err = tagUsecase.SetTagParent(tag.Name, r.FormValue("parent")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"tag": map[string]interface{}{
+			"id":        tag.ID,
+			"name":      tag.Name,
+			"color":     tag.Color,
+			"parent_id": tag.ParentID,
+		},
+	})
+}
+
+// handleDeleteTag は使われていないタグを削除する（使われている場合は 409）
+func (s *Server) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag := s.tagFromRequest(w, r)
+	if tag == nil {
+		return
+	}
+
+	if err := usecase.NewTagUsecase(s.db).DeleteTag(tag.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Tag deleted successfully",
+	})
+}
+
+// handleMergeTags は tags=a,b のタグを into のタグにまとめる
+func (s *Server) handleMergeTags(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	into := strings.TrimSpace(r.FormValue("into"))
+	tags := splitList(r.FormValue("tags"))
+	if into == "" || len(tags) == 0 {
+		http.Error(w, "Both into and tags are required", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := usecase.NewTagUsecase(s.db).MergeTags(into, tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"tag": map[string]interface{}{
+			"id":    tag.ID,
+			"name":  tag.Name,
+			"color": tag.Color,
+		},
+	})
+}
+
+// handlePruneTags は使われていないタグをすべて削除する
+func (s *Server) handlePruneTags(w http.ResponseWriter, r *http.Request) {
+	deleted, err := usecase.NewTagUsecase(s.db).DeleteUnusedTags()
+	if err != nil {
+		http.Error(w, "Failed to delete unused tags", http.StatusInternalServerError)
+		return
+	}
+	if deleted == nil {
+		deleted = []string{}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"deleted": deleted,
+	})
+}
+
+// handleTagSynonyms は POST でタグに同義語を追加し、DELETE で削除する（synonym）
+func (s *Server) handleTagSynonyms(w http.ResponseWriter, r *http.Request) {
+	tag := s.tagFromRequest(w, r)
+	if tag == nil {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	synonym := strings.TrimSpace(r.FormValue("synonym"))
+	if synonym == "" {
+		http.Error(w, "Synonym is required", http.StatusBadRequest)
+		return
+	}
+
+	tagUsecase := usecase.NewTagUsecase(s.db)
+	if r.Method == http.MethodPost {
+		if _, err := tagUsecase.AddTagSynonym(tag.Name, synonym); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := tagUsecase.RemoveTagSynonym(synonym); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Synonyms updated successfully",
+	})
+}
+
+func (s *Server) handleLockDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	document, err := s.documentUsecase.SetLocked(uint(id), r.Method == http.MethodPost)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"document": map[string]interface{}{
+			"id":        document.ID,
+			"locked":    document.Locked,
+			"locked_at": document.LockedAt,
+		},
+	})
+}
+
+func (s *Server) handleRegenerateDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	document, err := s.documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if document.Locked {
+		http.Error(w, "Document is locked. Unlock it before regenerating.", http.StatusConflict)
+		return
+	}
+
+	// AIサービス初期化
+	aiService, err := ai.NewService(s.db)
+	if err != nil {
+		http.Error(w, "Failed to create AI service", http.StatusInternalServerError)
+		return
+	}
+
+	document, err = aiService.RegenerateDocument(r.Context(), document.ID, r.FormValue("instructions"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to regenerate document: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.refreshSemanticIndex(r)
+
+	// JSON レスポンス
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": "Document regenerated successfully",
+		"document": map[string]interface{}{
+			"id":    document.ID,
+			"title": document.Title,
 		},
 	})
 }
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"insight/src/ai"
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"gorm.io/gorm"
+)
+
+// openAPIOperation は OpenAPI ドキュメントに記載する1つのルート
+// リクエスト・レスポンスの形は Go の型のゼロ値（またはopenAPIObject）で指定し、スキーマは型から生成する
+type openAPIOperation struct {
+	Method  string
+	Path    string // パス変数は {id} の形式（ルーターの正規表現は含めない）
+	Tag     string
+	Summary string
+
+	Query       []openAPIParam
+	Form        []openAPIParam // application/x-www-form-urlencoded の本文
+	JSONBody    interface{}    // application/json の本文
+	RequestType interface{}    // フォームの本文から組み立てる型（説明として記載する）
+
+	Status   int         // 成功時のステータス（0 は 200）
+	Response interface{} // 成功時のJSONの本文（nil の場合は本文なし）
+	HTML     bool        // HTMLページを返す
+}
+
+// openAPIParam はクエリパラメータまたはフォームの項目
+type openAPIParam struct {
+	Name        string
+	Type        string // string / integer / boolean（空の場合は string）
+	Description string
+	Required    bool
+}
+
+// openAPIObject はJSONのオブジェクトの形を項目名と値のゼロ値で表す
+type openAPIObject map[string]interface{}
+
+// よく使うパラメータ
+var (
+	openAPITagsParam    = openAPIParam{Name: "tags", Description: "Comma-separated tag names (child tags are included)"}
+	openAPISinceParam   = openAPIParam{Name: "since", Description: "Created on or after (YYYY-MM-DD or RFC3339)"}
+	openAPIUntilParam   = openAPIParam{Name: "until", Description: "Created before (YYYY-MM-DD is inclusive of that day)"}
+	openAPIPageParam    = openAPIParam{Name: "page", Type: "integer", Description: "Page number (default 1)"}
+	openAPIPerPageParam = openAPIParam{Name: "per_page", Type: "integer", Description: "Items per page (default 20, max 100)"}
+	openAPIVersionParam = openAPIParam{Name: "version", Description: "Document version timestamp"}
+	openAPIUserParam    = openAPIParam{Name: "user", Description: "Only fragments created by this username"}
+)
+
+// openAPIStatusResponse は従来のエンドポイントが返す {"status", "message"} の形
+var openAPIStatusResponse = openAPIObject{"status": "", "message": ""}
+
+// openAPIOperations はすべてのルートの説明
+// newRouter にルートを追加した場合はここにも追加する（openapi_test.go で検査する）
+func openAPIOperations() []openAPIOperation {
+	documentForm := []openAPIParam{
+		{Name: "title", Required: true},
+		{Name: "summary", Required: true},
+		{Name: "content", Description: "Markdown", Required: true},
+		{Name: "tags", Description: "Comma-separated tag names"},
+	}
+	fragmentSummary := openAPIObject{"id": uint(0), "content": "", "updated_at": time.Time{}}
+	documentSummary := openAPIObject{"id": uint(0), "title": ""}
+	tagSummary := openAPIObject{"id": uint(0), "name": "", "color": ""}
+	conversationIDParam := openAPIParam{Name: "conversation_id", Type: "integer", Description: "Continue an existing conversation (omit to start a new one)"}
+	webSearchParam := openAPIParam{Name: "web_search", Type: "boolean", Description: "Allow grounding with web search"}
+
+	return []openAPIOperation{
+		// ページ
+		{Method: "GET", Path: "/", Tag: "Pages", Summary: "Redirect to the documents page", Status: http.StatusSeeOther},
+		{Method: "GET", Path: "/documents", Tag: "Pages", Summary: "Documents page", Query: []openAPIParam{{Name: "version", Description: "Version to show (default: latest)"}}, HTML: true},
+		{Method: "GET", Path: "/documents/new", Tag: "Pages", Summary: "New document editor", HTML: true},
+		{Method: "GET", Path: "/documents/{id}", Tag: "Pages", Summary: "Document detail page", HTML: true},
+		{Method: "GET", Path: "/documents/{id}/edit", Tag: "Pages", Summary: "Document editor", HTML: true},
+		{Method: "GET", Path: "/fragments", Tag: "Pages", Summary: "Fragments page", Query: []openAPIParam{openAPITagsParam, openAPIUserParam}, HTML: true},
+		{Method: "GET", Path: "/tags", Tag: "Pages", Summary: "Tag tree", HTML: true},
+		{Method: "GET", Path: "/tags/{name}", Tag: "Pages", Summary: "Documents and fragments under a tag", Query: []openAPIParam{openAPIVersionParam}, HTML: true},
+		{Method: "GET", Path: "/admin/tags", Tag: "Pages", Summary: "Tag management page", HTML: true},
+		{Method: "GET", Path: "/qa", Tag: "Pages", Summary: "Q&A history page", Query: []openAPIParam{{Name: "feedback", Type: "integer", Description: "1 / -1 / 0"}}, HTML: true},
+		{Method: "GET", Path: "/conversations", Tag: "Pages", Summary: "Conversations page", Query: []openAPIParam{{Name: "id", Type: "integer", Description: "Conversation to open"}}, HTML: true},
+		{Method: "GET", Path: "/login", Tag: "Pages", Summary: "Login page", Query: []openAPIParam{{Name: "next", Description: "Path to open after logging in"}}, HTML: true},
+		{Method: "GET", Path: "/api/docs", Tag: "Pages", Summary: "Interactive API documentation", HTML: true},
+		{Method: "GET", Path: "/api/openapi.json", Tag: "Pages", Summary: "This OpenAPI document", Response: openAPIObject{}},
+
+		// 認証
+		{Method: "POST", Path: "/login", Tag: "Auth", Summary: "Log in with an API token and set the session cookie", Form: []openAPIParam{{Name: "token", Required: true}, {Name: "next", Description: "Path to redirect to"}}, Status: http.StatusSeeOther},
+		{Method: "POST", Path: "/logout", Tag: "Auth", Summary: "Delete the session and redirect to the login page", Status: http.StatusSeeOther},
+
+		// フラグメント
+		{Method: "POST", Path: "/fragments", Tag: "Fragments", Summary: "Create a fragment and redirect to the fragments page", Form: []openAPIParam{{Name: "content", Required: true}}, Status: http.StatusSeeOther},
+		{Method: "PUT", Path: "/fragments/{id}", Tag: "Fragments", Summary: "Update a fragment", Form: []openAPIParam{{Name: "content", Required: true}}, Response: openAPIObject{"status": "", "message": "", "fragment": fragmentSummary}},
+		{Method: "DELETE", Path: "/fragments/{id}", Tag: "Fragments", Summary: "Delete a fragment", Response: openAPIObject{"status": "", "message": "", "fragment": openAPIObject{"id": uint(0), "content": ""}}},
+		{Method: "GET", Path: "/api/fragments/{id}/revisions", Tag: "Fragments", Summary: "Fragment revisions", Response: openAPIObject{"fragment_id": uint(0), "revisions": []openAPIObject{{"id": uint(0), "content": "", "created_at": time.Time{}}}}},
+		{Method: "POST", Path: "/api/fragments/{id}/revisions/{revisionId}/restore", Tag: "Fragments", Summary: "Restore a fragment revision", Response: openAPIObject{"status": "", "message": "", "fragment": fragmentSummary}},
+		{Method: "POST", Path: "/api/fragments/{id}/tags", Tag: "Fragments", Summary: "Add tags to a fragment", Form: []openAPIParam{{Name: "tags", Description: "Comma-separated tag names", Required: true}}, Response: openAPIObject{"status": "", "fragment": openAPIObject{"id": uint(0), "tags": []string{}}}},
+		{Method: "DELETE", Path: "/api/fragments/{id}/tags", Tag: "Fragments", Summary: "Remove tags from a fragment", Query: []openAPIParam{{Name: "tags", Description: "Comma-separated tag names", Required: true}}, Response: openAPIObject{"status": "", "fragment": openAPIObject{"id": uint(0), "tags": []string{}}}},
+		{Method: "GET", Path: "/api/fragments/search", Tag: "Fragments", Summary: "Full-text search of fragments", Query: []openAPIParam{{Name: "q", Required: true}, openAPITagsParam, openAPISinceParam, openAPIUntilParam, openAPIPageParam, openAPIPerPageParam}, Response: openAPIObject{"query": "", "hits": []usecase.FragmentSearchHit{}, "total": int64(0), "page": 0, "per_page": 0}},
+
+		// ドキュメント
+		{Method: "POST", Path: "/documents", Tag: "Documents", Summary: "Create a document in the latest version", Form: documentForm, Response: openAPIObject{"status": "", "message": "", "document": documentSummary}},
+		{Method: "PUT", Path: "/documents/{id}", Tag: "Documents", Summary: "Update a document (tags are replaced)", Form: documentForm, Response: openAPIObject{"status": "", "message": "", "document": openAPIObject{"id": uint(0), "title": "", "edited_by_human": false, "updated_at": time.Time{}}}},
+		{Method: "DELETE", Path: "/documents/{id}", Tag: "Documents", Summary: "Delete a document", Response: openAPIObject{"status": "", "message": "", "document": documentSummary}},
+		{Method: "GET", Path: "/api/documents/search", Tag: "Documents", Summary: "Search documents", Query: []openAPIParam{{Name: "q", Required: true}, {Name: "mode", Description: "keyword (default) / semantic"}, openAPIVersionParam, openAPITagsParam, openAPISinceParam, openAPIUntilParam, openAPIPageParam, openAPIPerPageParam}, Response: openAPIObject{"query": "", "mode": "", "hits": []usecase.DocumentSearchHit{}, "total": int64(0), "page": 0, "per_page": 0}},
+		{Method: "POST", Path: "/api/documents/preview", Tag: "Documents", Summary: "Render Markdown as HTML", Form: []openAPIParam{{Name: "content", Required: true}}, Response: openAPIObject{"html": ""}},
+		{Method: "GET", Path: "/api/documents/{id}/revisions", Tag: "Documents", Summary: "Document revisions", Response: openAPIObject{"document_id": uint(0), "revisions": []openAPIObject{{"id": uint(0), "author": "", "title": "", "summary": "", "content": "", "created_at": time.Time{}}}}},
+		{Method: "POST", Path: "/api/documents/{id}/lock", Tag: "Documents", Summary: "Lock a document so it is carried over unchanged on regeneration", Response: openAPIObject{"status": "", "document": openAPIObject{"id": uint(0), "locked": false, "locked_at": &time.Time{}}}},
+		{Method: "DELETE", Path: "/api/documents/{id}/lock", Tag: "Documents", Summary: "Unlock a document", Response: openAPIObject{"status": "", "document": openAPIObject{"id": uint(0), "locked": false, "locked_at": &time.Time{}}}},
+		{Method: "POST", Path: "/api/documents/{id}/regenerate", Tag: "Documents", Summary: "Regenerate a document from its fragments with AI", Form: []openAPIParam{{Name: "instructions"}}, Response: openAPIObject{"status": "", "message": "", "document": documentSummary}},
+
+		// タグ
+		{Method: "GET", Path: "/api/tags", Tag: "Tags", Summary: "List tags with usage counts and synonyms", Response: openAPIObject{"status": "", "tags": []usecase.TagSummary{}}},
+		{Method: "POST", Path: "/api/tags/merge", Tag: "Tags", Summary: "Merge tags into one (merged names become synonyms)", Form: []openAPIParam{{Name: "into", Required: true}, {Name: "tags", Description: "Comma-separated tag names", Required: true}}, Response: openAPIObject{"status": "", "tag": tagSummary}},
+		{Method: "POST", Path: "/api/tags/prune", Tag: "Tags", Summary: "Delete all unused tags", Response: openAPIObject{"status": "", "deleted": []string{}}},
+		{Method: "PUT", Path: "/api/tags/{id}", Tag: "Tags", Summary: "Rename, recolor or re-parent a tag", Form: []openAPIParam{{Name: "name"}, {Name: "color", Description: "#RRGGBB"}, {Name: "parent", Description: "Parent tag name (empty for top level)"}}, Response: openAPIObject{"status": "", "tag": openAPIObject{"id": uint(0), "name": "", "color": "", "parent_id": (*uint)(nil)}}},
+		{Method: "DELETE", Path: "/api/tags/{id}", Tag: "Tags", Summary: "Delete an unused tag (409 if used)", Response: openAPIStatusResponse},
+		{Method: "POST", Path: "/api/tags/{id}/synonyms", Tag: "Tags", Summary: "Add a synonym", Form: []openAPIParam{{Name: "synonym", Required: true}}, Response: openAPIStatusResponse},
+		{Method: "DELETE", Path: "/api/tags/{id}/synonyms", Tag: "Tags", Summary: "Remove a synonym", Query: []openAPIParam{{Name: "synonym", Required: true}}, Response: openAPIStatusResponse},
+
+		// AI
+		{Method: "POST", Path: "/api/ai/create", Tag: "AI", Summary: "Generate documents from fragments", Form: []openAPIParam{
+			openAPITagsParam, openAPISinceParam, openAPIUntilParam,
+			{Name: "fragment_ids", Description: "Comma-separated fragment IDs"},
+			{Name: "instructions"}, {Name: "audience"},
+			{Name: "style", Description: "howto / reference / faq / adr / onboarding"},
+			{Name: "granularity", Description: "broad / detailed"},
+			{Name: "target_documents", Type: "integer"},
+		}, Response: openAPIStatusResponse},
+		{Method: "POST", Path: "/api/ai/compress", Tag: "AI", Summary: "Compress fragments", Response: openAPIStatusResponse},
+		{Method: "POST", Path: "/api/ai/tag", Tag: "AI", Summary: "Tag fragments automatically", Form: []openAPIParam{{Name: "fragment_ids", Description: "Comma-separated fragment IDs (default: untagged fragments)"}, {Name: "all", Type: "boolean"}}, Response: openAPIObject{"status": "", "results": []ai.FragmentTagResult{}}},
+		{Method: "POST", Path: "/api/ai/tags/consolidate", Tag: "AI", Summary: "Propose tag merges (not applied)", Response: openAPIObject{"status": "", "proposals": []ai.TagMergeProposal{}}},
+
+		// 質問応答
+		{Method: "POST", Path: "/api/documents/{id}/ask", Tag: "Q&A", Summary: "Ask about a document", Form: []openAPIParam{{Name: "question", Required: true}, webSearchParam, conversationIDParam}, RequestType: ai.QARequest{}, Response: ai.QAResponse{}},
+		{Method: "POST", Path: "/api/documents/ask", Tag: "Q&A", Summary: "Ask across documents", Form: []openAPIParam{{Name: "question", Required: true}, openAPIVersionParam, openAPITagsParam, {Name: "document_ids", Description: "Comma-separated document IDs (overrides version)"}, webSearchParam, conversationIDParam}, RequestType: ai.GlobalQARequest{}, Response: ai.QAResponse{}},
+		{Method: "POST", Path: "/api/fragments/ask", Tag: "Q&A", Summary: "Ask about fragments", Form: []openAPIParam{{Name: "question", Required: true}, openAPISinceParam, openAPIUntilParam, openAPITagsParam, webSearchParam, conversationIDParam}, RequestType: ai.FragmentQARequest{}, Response: ai.QAResponse{}},
+		{Method: "POST", Path: "/api/qa/agent", Tag: "Q&A", Summary: "Ask with tool calls", Form: []openAPIParam{{Name: "question", Required: true}, {Name: "max_steps", Type: "integer"}, conversationIDParam}, RequestType: ai.AgentQARequest{}, Response: ai.QAResponse{}},
+		{Method: "GET", Path: "/api/qa/history", Tag: "Q&A", Summary: "Q&A history", Query: []openAPIParam{{Name: "scope", Description: "document / global / fragments / agent"}, {Name: "document_id", Type: "integer"}, {Name: "feedback", Type: "integer", Description: "1 / -1 / 0"}, {Name: "limit", Type: "integer", Description: "Default 100"}}, Response: []models.QAExchange{}},
+		{Method: "POST", Path: "/api/qa/{id}/feedback", Tag: "Q&A", Summary: "Rate an answer", Form: []openAPIParam{{Name: "rating", Type: "integer", Description: "1 / -1 / 0", Required: true}, {Name: "comment"}}, Response: openAPIObject{"status": "", "feedback": 0}},
+		{Method: "POST", Path: "/api/qa/{id}/fragment", Tag: "Q&A", Summary: "Save an answer as a fragment", Response: openAPIObject{"status": "", "fragment_id": uint(0)}},
+		{Method: "GET", Path: "/api/conversations", Tag: "Q&A", Summary: "List conversations", Response: []models.Conversation{}},
+		{Method: "GET", Path: "/api/conversations/{id}", Tag: "Q&A", Summary: "Get a conversation with its messages", Response: models.Conversation{}},
+		{Method: "DELETE", Path: "/api/conversations/{id}", Tag: "Q&A", Summary: "Delete a conversation", Response: openAPIStatusResponse},
+		{Method: "POST", Path: "/api/conversations/{id}/messages", Tag: "Q&A", Summary: "Continue a conversation", Form: []openAPIParam{{Name: "question", Required: true}, webSearchParam}, RequestType: ai.ConversationRequest{}, Response: ai.QAResponse{}},
+
+		// JSON API (v1)
+		{Method: "GET", Path: "/api/v1/fragments", Tag: "v1", Summary: "List fragments", Query: []openAPIParam{openAPITagsParam, openAPIUserParam, openAPISinceParam, openAPIUntilParam, openAPIPageParam, openAPIPerPageParam}, Response: apiListResponseOf([]apiFragment{})},
+		{Method: "POST", Path: "/api/v1/fragments", Tag: "v1", Summary: "Create a fragment", JSONBody: apiFragmentRequest{}, Status: http.StatusCreated, Response: apiResponseOf(apiFragment{})},
+		{Method: "GET", Path: "/api/v1/fragments/{id}", Tag: "v1", Summary: "Get a fragment", Response: apiResponseOf(apiFragment{})},
+		{Method: "PUT", Path: "/api/v1/fragments/{id}", Tag: "v1", Summary: "Update a fragment", JSONBody: apiFragmentRequest{}, Response: apiResponseOf(apiFragment{})},
+		{Method: "DELETE", Path: "/api/v1/fragments/{id}", Tag: "v1", Summary: "Delete a fragment", Status: http.StatusNoContent},
+		{Method: "GET", Path: "/api/v1/documents", Tag: "v1", Summary: "List documents", Query: []openAPIParam{{Name: "version", Description: "Version timestamp or \"latest\""}, openAPITagsParam, openAPISinceParam, openAPIUntilParam, openAPIPageParam, openAPIPerPageParam}, Response: apiListResponseOf([]apiDocument{})},
+		{Method: "POST", Path: "/api/v1/documents", Tag: "v1", Summary: "Create a document in the latest version", JSONBody: apiDocumentRequest{}, Status: http.StatusCreated, Response: apiResponseOf(apiDocument{})},
+		{Method: "GET", Path: "/api/v1/documents/{id}", Tag: "v1", Summary: "Get a document", Response: apiResponseOf(apiDocument{})},
+		{Method: "PUT", Path: "/api/v1/documents/{id}", Tag: "v1", Summary: "Update a document", JSONBody: apiDocumentRequest{}, Response: apiResponseOf(apiDocument{})},
+		{Method: "DELETE", Path: "/api/v1/documents/{id}", Tag: "v1", Summary: "Delete a document", Status: http.StatusNoContent},
+		{Method: "GET", Path: "/api/v1/tags", Tag: "v1", Summary: "List tags", Query: []openAPIParam{openAPIPageParam, openAPIPerPageParam}, Response: apiListResponseOf([]usecase.TagSummary{})},
+		{Method: "POST", Path: "/api/v1/tags", Tag: "v1", Summary: "Create a tag", JSONBody: apiTagRequest{}, Status: http.StatusCreated, Response: apiResponseOf(usecase.TagSummary{})},
+		{Method: "GET", Path: "/api/v1/tags/{id}", Tag: "v1", Summary: "Get a tag", Response: apiResponseOf(usecase.TagSummary{})},
+		{Method: "PUT", Path: "/api/v1/tags/{id}", Tag: "v1", Summary: "Update a tag", JSONBody: apiTagRequest{}, Response: apiResponseOf(usecase.TagSummary{})},
+		{Method: "DELETE", Path: "/api/v1/tags/{id}", Tag: "v1", Summary: "Delete an unused tag", Status: http.StatusNoContent},
+		{Method: "GET", Path: "/api/v1/versions", Tag: "v1", Summary: "List document versions", Query: []openAPIParam{openAPIPageParam, openAPIPerPageParam}, Response: apiListResponseOf([]apiVersion{})},
+	}
+}
+
+// apiResponseOf は /api/v1 の単体のレスポンスの形
+func apiResponseOf(data interface{}) openAPIObject {
+	return openAPIObject{"data": data}
+}
+
+// apiListResponseOf は /api/v1 の一覧のレスポンスの形
+func apiListResponseOf(data interface{}) openAPIObject {
+	return openAPIObject{"data": data, "pagination": apiPagination{}}
+}
+
+// openAPIPathParam はパステンプレートの変数（{name} または {name:pattern}）
+var openAPIPathParam = regexp.MustCompile(`\{(\w+)(?::[^}]*)?\}`)
+
+// openAPIPath はルーターのパステンプレートから変数の正規表現を取り除く
+func openAPIPath(template string) string {
+	return openAPIPathParam.ReplaceAllString(template, "{$1}")
+}
+
+// buildOpenAPISpec は OpenAPI 3 のドキュメントを作成する
+func buildOpenAPISpec() map[string]interface{} {
+	schemas := newOpenAPISchemas()
+	paths := make(map[string]map[string]interface{})
+
+	for _, operation := range openAPIOperations() {
+		if paths[operation.Path] == nil {
+			paths[operation.Path] = make(map[string]interface{})
+		}
+		paths[operation.Path][strings.ToLower(operation.Method)] = schemas.operation(operation)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Insight API",
+			"version":     "1.0.0",
+			"description": "Authenticate with \"Authorization: Bearer <token>\" or a browser session; x-required-scope shows the scope each operation needs and x-required-role marks admin-only operations. Form endpoints accept application/x-www-form-urlencoded bodies. The /api/v1 endpoints accept JSON and return {\"data\": ...} or {\"error\": {\"code\", \"message\"}}.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth":    map[string]interface{}{"type": "http", "scheme": "bearer", "description": "Personal API token (insight token create)"},
+				"sessionCookie": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookieName, "description": "Browser session created by POST /login"},
+			},
+		},
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPISpec())
+}
+
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if err := s.executeTemplateWithLogging(w, "api_docs_page.go.tmpl", nil); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// openAPISchemas は Go の型から JSON Schema を作り、名前付きの型を components に登録する
+type openAPISchemas struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	return &openAPISchemas{
+		components: make(map[string]interface{}),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+func (s *openAPISchemas) operation(operation openAPIOperation) map[string]interface{} {
+	result := map[string]interface{}{
+		"summary":     operation.Summary,
+		"tags":        []string{operation.Tag},
+		"operationId": strings.ToLower(operation.Method) + openAPIOperationName(operation.Path),
+	}
+
+	// 認証と必要な権限（auth.go の requiredScope と同じ規則）
+	if scope := requiredScope(operation.Method, operation.Path, nil); scope == "" {
+		result["security"] = []interface{}{}
+	} else {
+		result["security"] = []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"sessionCookie": []string{}},
+		}
+		result["x-required-scope"] = scope
+		if adminRoutes[operation.Method+" "+operation.Path] {
+			result["x-required-role"] = models.UserRoleAdmin
+		}
+		if operation.Path == "/api/documents/search" {
+			result["description"] = "Requires the ai scope when mode=semantic."
+		}
+	}
+
+	var parameters []interface{}
+	for _, match := range openAPIPathParam.FindAllStringSubmatch(operation.Path, -1) {
+		paramType := "string"
+		if match[1] == "id" || strings.HasSuffix(match[1], "Id") {
+			paramType = "integer"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": paramType},
+		})
+	}
+	for _, param := range operation.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        param.Name,
+			"in":          "query",
+			"required":    param.Required,
+			"description": param.Description,
+			"schema":      openAPIParamSchema(param),
+		})
+	}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+
+	if len(operation.Form) > 0 {
+		properties := make(map[string]interface{})
+		var required []string
+		for _, param := range operation.Form {
+			properties[param.Name] = openAPIParamSchema(param)
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+		formSchema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			formSchema["required"] = required
+		}
+		requestBody := map[string]interface{}{
+			"required": len(required) > 0,
+			"content": map[string]interface{}{
+				"application/x-www-form-urlencoded": map[string]interface{}{"schema": formSchema},
+			},
+		}
+		if operation.RequestType != nil {
+			ref := s.schema(reflect.TypeOf(operation.RequestType))
+			requestBody["description"] = "Converted to " + strings.TrimPrefix(ref["$ref"].(string), "#/components/schemas/")
+			requestBody["x-request-schema"] = ref
+		}
+		result["requestBody"] = requestBody
+	} else if operation.JSONBody != nil {
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.value(operation.JSONBody)},
+			},
+		}
+	}
+
+	status := operation.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case operation.HTML:
+		success["content"] = map[string]interface{}{
+			"text/html": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+	case operation.Response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.value(operation.Response)},
+		}
+	}
+
+	// /api/v1 はエラーをJSONで、それ以外はテキストで返す
+	failure := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		},
+	}
+	if strings.HasPrefix(operation.Path, "/api/v1/") {
+		failure["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.value(apiErrorResponse{})},
+		}
+	}
+
+	result["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default":            failure,
+	}
+	return result
+}
+
+// openAPIOperationName はパスから operationId の後半を作る（例: /api/v1/fragments/{id} → ApiV1FragmentsById）
+func openAPIOperationName(path string) string {
+	var name strings.Builder
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' || r == '-' }) {
+		if match := openAPIPathParam.FindStringSubmatch(segment); match != nil {
+			segment = "By" + strings.ToUpper(match[1][:1]) + match[1][1:]
+		}
+		name.WriteString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+	if name.Len() == 0 {
+		return "Root"
+	}
+	return name.String()
+}
+
+func openAPIParamSchema(param openAPIParam) map[string]interface{} {
+	paramType := param.Type
+	if paramType == "" {
+		paramType = "string"
+	}
+	schema := map[string]interface{}{"type": paramType}
+	if param.Description != "" {
+		schema["description"] = param.Description
+	}
+	return schema
+}
+
+// value はレスポンスなどの形として指定された値のスキーマを返す
+func (s *openAPISchemas) value(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case openAPIObject:
+		properties := make(map[string]interface{}, len(v))
+		for name, property := range v {
+			properties[name] = s.value(property)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case []openAPIObject:
+		var items map[string]interface{}
+		if len(v) > 0 {
+			items = s.value(v[0])
+		} else {
+			items = map[string]interface{}{"type": "object"}
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+)
+
+// schema は型のスキーマを返す。名前付きの構造体は components に登録して参照を返す
+func (s *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case deletedAtType:
+		return map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return schema
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return s.ref(t)
+	}
+	// interface{} など
+	return map[string]interface{}{}
+}
+
+// ref は名前付きの構造体を components に登録し、参照を返す
+// 循環する型（Fragment ↔ Document など）に備えて、中身を作る前に名前を登録する
+func (s *openAPISchemas) ref(t reflect.Type) map[string]interface{} {
+	name, ok := s.names[t]
+	if !ok {
+		name = openAPISchemaName(t)
+		if _, taken := s.components[name]; taken {
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		s.names[t] = name
+		s.components[name] = map[string]interface{}{}
+		s.components[name] = s.structSchema(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISchemaName はスキーマ名を作る（/api/v1 の apiFragment などは Fragment とする）
+func openAPISchemaName(t reflect.Type) string {
+	name := t.Name()
+	if strings.HasPrefix(name, "api") && len(name) > 3 {
+		name = name[3:]
+		if t == reflect.TypeOf(apiError{}) {
+			name = "APIError"
+		}
+		if t == reflect.TypeOf(apiErrorResponse{}) {
+			name = "APIErrorResponse"
+		}
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// structSchema は encoding/json と同じ規則で構造体の項目を並べる
+func (s *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.collectFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *openAPISchemas) collectFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// タグのない埋め込み構造体（gorm.Model など）の項目は展開する
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.collectFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestOpenAPIDocumentsAllRoutes はルーターのすべてのルートが OpenAPI ドキュメントに記載されていることを確認する
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	documented := make(map[string]bool)
+	for _, operation := range openAPIOperations() {
+		key := operation.Method + " " + operation.Path
+		if documented[key] {
+			t.Errorf("%s is documented more than once", key)
+		}
+		documented[key] = true
+	}
+
+	routed := make(map[string]bool)
+	err := newRouter(&Server{}).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// PathPrefix やサブルーターなどメソッドを持たないルート
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			key := method + " " + openAPIPath(template)
+			routed[key] = true
+			if !documented[key] {
+				t.Errorf("%s is not documented in openAPIOperations", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk routes: %v", err)
+	}
+
+	for key := range documented {
+		if !routed[key] {
+			t.Errorf("%s is documented but has no route", key)
+		}
+	}
+}
+
+// TestBuildOpenAPISpec は生成したドキュメントの参照がすべて components に存在することを確認する
+func TestBuildOpenAPISpec(t *testing.T) {
+	spec := buildOpenAPISpec()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	for _, name := range []string{"QARequest", "QAResponse", "Fragment", "Document", "APIErrorResponse"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	// operationId は API ドキュメントのページで要素の id に使う
+	operationIDs := make(map[string]bool)
+	for path, operations := range spec["paths"].(map[string]map[string]interface{}) {
+		for method, operation := range operations {
+			id := operation.(map[string]interface{})["operationId"].(string)
+			if operationIDs[id] {
+				t.Errorf("duplicate operationId %s (%s %s)", id, method, path)
+			}
+			operationIDs[id] = true
+		}
+	}
+
+	var check func(v interface{})
+	check = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				name := ref[len("#/components/schemas/"):]
+				if _, ok := schemas[name]; !ok {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				check(child)
+			}
+		case map[string]map[string]interface{}:
+			for _, child := range v {
+				check(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				check(child)
+			}
+		}
+	}
+	check(spec)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"insight/src/models"
@@ -40,6 +41,8 @@ type DocumentRequest struct {
 	Content     string   `json:"content"`
 	FragmentIDs []int    `json:"fragment_ids"`
 	Tags        []string `json:"tags"`
+
+	SuggestedQuestions []string `json:"suggested_questions"`
 }
 
 // DocumentsResponse は複数ドキュメント作成レスポンスを表す構造体
@@ -48,44 +51,121 @@ type DocumentsResponse struct {
 	Analysis  string            `json:"analysis"`
 }
 
-// GenerateDocuments はフラグメントからドキュメントを生成
-func (g *DocumentGenerator) GenerateDocuments(ctx context.Context) error {
-	fmt.Println("Fetching all fragments...")
+// GenerateDocuments は対象範囲のフラグメントから、生成パラメータに従ってドキュメントを生成
+// 対象範囲を絞り込んだ場合はスコープ付きのバージョンとして記録され、最新バージョンを置き換えない
+func (g *DocumentGenerator) GenerateDocuments(ctx context.Context, scope usecase.GenerationScope, options usecase.GenerationOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Fetching fragments (%s)...\n", scope.Describe())
 
-	// 全フラグメントを取得
+	// 対象範囲のフラグメントをID順に取得（順序を固定化）
 	fragmentUsecase := usecase.NewFragmentUsecase(g.db)
-	fragments, err := fragmentUsecase.GetAllFragments()
+	fragments, err := fragmentUsecase.GetFragmentsInScope(scope)
 	if err != nil {
 		return fmt.Errorf("failed to get fragments: %w", err)
 	}
 
 	if len(fragments) == 0 {
-		fmt.Println("No fragments found in database.")
+		fmt.Println("No fragments found in the selected scope.")
 		return nil
 	}
 
-	fmt.Printf("Found %d fragments. Analyzing with AI...\n", len(fragments))
-
-	// フラグメントをIDでソートして順序を固定化
-	for i := 0; i < len(fragments); i++ {
-		for j := i + 1; j < len(fragments); j++ {
-			if fragments[i].ID > fragments[j].ID {
-				fragments[i], fragments[j] = fragments[j], fragments[i]
+	// 固定または人が作成・編集したドキュメントは新しいバージョンへそのまま引き継ぎ、そのフラグメントは参考情報としてのみ渡す
+	preservedDocuments, err := g.preservedDocuments()
+	if err != nil {
+		return err
+	}
+	if scope.IsScoped() {
+		preservedDocuments = preservedDocumentsInScope(preservedDocuments, fragments)
+	}
+	preservedFragmentIDs := make(map[uint]bool)
+	for _, document := range preservedDocuments {
+		for _, fragment := range document.Fragments {
+			preservedFragmentIDs[fragment.ID] = true
+		}
+	}
+	if len(preservedDocuments) > 0 {
+		var remaining []models.Fragment
+		for _, fragment := range fragments {
+			if !preservedFragmentIDs[fragment.ID] {
+				remaining = append(remaining, fragment)
 			}
 		}
+		fmt.Printf("Keeping %d locked or human-edited documents (%d fragments).\n", len(preservedDocuments), len(fragments)-len(remaining))
+		fragments = remaining
 	}
 
+	if len(fragments) == 0 {
+		fmt.Println("All fragments are covered by locked or human-edited documents. Nothing to generate.")
+		return nil
+	}
+
+	fmt.Printf("Found %d fragments. Analyzing with AI (%s)...\n", len(fragments), options.Describe())
+
 	// AI生成実行
-	response, err := g.generateDocumentsWithAI(ctx, fragments)
+	response, err := g.generateDocumentsWithAI(ctx, fragments, preservedDocuments, options)
 	if err != nil {
 		return err
 	}
 
+	// 引き継ぐドキュメントのフラグメントは新しいドキュメントに関連付けない
+	for i := range response.Documents {
+		var fragmentIDs []int
+		for _, id := range response.Documents[i].FragmentIDs {
+			if !preservedFragmentIDs[uint(id)] {
+				fragmentIDs = append(fragmentIDs, id)
+			}
+		}
+		response.Documents[i].FragmentIDs = fragmentIDs
+	}
+
 	// ドキュメントを作成
-	return g.createDocumentsFromResponse(response)
+	return g.createDocumentsFromResponse(response, preservedDocuments, scope, options, len(fragments))
 }
 
-func (g *DocumentGenerator) generateDocumentsWithAI(ctx context.Context, fragments []models.Fragment) (*DocumentsResponse, error) {
+// preservedDocumentsInScope は対象範囲のフラグメントを含む引き継ぎ対象のドキュメントだけを返す
+// フラグメントを持たない手書きのドキュメントは範囲を絞った生成には含めない
+func preservedDocumentsInScope(preservedDocuments []models.Document, fragments []models.Fragment) []models.Document {
+	inScope := make(map[uint]bool, len(fragments))
+	for _, fragment := range fragments {
+		inScope[fragment.ID] = true
+	}
+
+	var documents []models.Document
+	for _, document := range preservedDocuments {
+		for _, fragment := range document.Fragments {
+			if inScope[fragment.ID] {
+				documents = append(documents, document)
+				break
+			}
+		}
+	}
+	return documents
+}
+
+// preservedDocuments は最新バージョンの固定または人が作成・編集したドキュメントを取得する
+// これらは再生成で作り直さず、新しいバージョンへ引き継ぐ
+func (g *DocumentGenerator) preservedDocuments() ([]models.Document, error) {
+	documentUsecase := usecase.NewDocumentUsecase(g.db)
+
+	version, err := documentUsecase.GetLatestVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions: %w", err)
+	}
+	if version.IsZero() {
+		return nil, nil
+	}
+
+	documents, err := documentUsecase.GetPreservedDocuments(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preserved documents: %w", err)
+	}
+	return documents, nil
+}
+
+func (g *DocumentGenerator) generateDocumentsWithAI(ctx context.Context, fragments []models.Fragment, preservedDocuments []models.Document, options usecase.GenerationOptions) (*DocumentsResponse, error) {
 	// フラグメント情報をプロンプトに構築
 	fragmentsInfo := ""
 	for _, fragment := range fragments {
@@ -93,44 +173,23 @@ func (g *DocumentGenerator) generateDocumentsWithAI(ctx context.Context, fragmen
 			fragment.ID, fragment.Content, fragment.CreatedAt.Format("2006-01-02 15:04:05"))
 	}
 
+	// 固定・人が編集したドキュメントの情報（変更不可の参考情報）
+	lockedInfo := ""
+	for _, document := range preservedDocuments {
+		lockedInfo += fmt.Sprintf("Title: %s\nSummary: %s\n", document.Title, document.Summary)
+		for _, fragment := range document.Fragments {
+			lockedInfo += fmt.Sprintf("- Fragment %d: %s\n", fragment.ID, fragment.Content)
+		}
+		lockedInfo += "\n"
+	}
+
 	// 構造化出力スキーマを定義
 	schema := &genai.Schema{
 		Type: genai.TypeObject,
 		Properties: map[string]*genai.Schema{
 			"documents": {
-				Type: genai.TypeArray,
-				Items: &genai.Schema{
-					Type: genai.TypeObject,
-					Properties: map[string]*genai.Schema{
-						"title": {
-							Type:        genai.TypeString,
-							Description: "ドキュメントのタイトル",
-						},
-						"summary": {
-							Type:        genai.TypeString,
-							Description: "ドキュメントの要約",
-						},
-						"content": {
-							Type:        genai.TypeString,
-							Description: "ドキュメントの本文（Markdown形式）",
-						},
-						"fragment_ids": {
-							Type: genai.TypeArray,
-							Items: &genai.Schema{
-								Type: genai.TypeInteger,
-							},
-							Description: "使用するフラグメントのIDリスト",
-						},
-						"tags": {
-							Type: genai.TypeArray,
-							Items: &genai.Schema{
-								Type: genai.TypeString,
-							},
-							Description: "ドキュメントに適用するタグのリスト",
-						},
-					},
-					Required: []string{"title", "summary", "content", "fragment_ids", "tags"},
-				},
+				Type:  genai.TypeArray,
+				Items: documentSchema(),
 			},
 			"analysis": {
 				Type:        genai.TypeString,
@@ -149,7 +208,7 @@ func (g *DocumentGenerator) generateDocumentsWithAI(ctx context.Context, fragmen
 	}
 
 	// プロンプトを構築
-	prompt := g.buildDocumentPrompt(fragmentsInfo)
+	prompt := g.buildDocumentPrompt(fragmentsInfo, lockedInfo, options)
 
 	// AI生成を実行
 	fmt.Println("Generating structured output...")
@@ -176,22 +235,51 @@ func (g *DocumentGenerator) generateDocumentsWithAI(ctx context.Context, fragmen
 	return &documentsResponse, nil
 }
 
-func (g *DocumentGenerator) buildDocumentPrompt(fragmentsInfo string) string {
-	return fmt.Sprintf(`以下のフラグメントを分析し、テーマ別にドキュメントを作成してください。
-
-=== フラグメント一覧 ===
-%s
-
-=== 作成指針 ===
-- 関連するフラグメントをテーマ別にグループ化
-- フラグメントの内容を基に、必要な背景知識や詳細説明を適度に補完
-- 実用的で読みやすいドキュメントを作成
-- 各ドキュメントに適切なタグを2-4個程度付与
-
-=== タグ付与基準 ===
-- 短く簡潔で検索しやすいタグを使用
+// documentSchema は1件のドキュメントの構造化出力スキーマ
+func documentSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"title": {
+				Type:        genai.TypeString,
+				Description: "ドキュメントのタイトル",
+			},
+			"summary": {
+				Type:        genai.TypeString,
+				Description: "ドキュメントの要約",
+			},
+			"content": {
+				Type:        genai.TypeString,
+				Description: "ドキュメントの本文（Markdown形式）",
+			},
+			"fragment_ids": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeInteger,
+				},
+				Description: "使用するフラグメントのIDリスト",
+			},
+			"tags": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeString,
+				},
+				Description: "ドキュメントに適用するタグのリスト",
+			},
+			"suggested_questions": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeString,
+				},
+				Description: "ドキュメントの読者が尋ねそうな質問（3-5個）",
+			},
+		},
+		Required: []string{"title", "summary", "content", "fragment_ids", "tags"},
+	}
+}
 
-=== Markdown構造の要件 ===
+// markdownStructureGuide はドキュメント本文のMarkdown構造の要件
+const markdownStructureGuide = `=== Markdown構造の要件 ===
 contentフィールドは以下の構造に従ってください：
 1. # メインタイトル（titleと同じ）
 2. 空行
@@ -202,17 +290,10 @@ contentフィールドは以下の構造に従ってください：
 7. 空行
 8. ## サブ見出し2
 9. 内容段落
-10. 必要に応じてさらなる見出しと内容
-
-=== 出力形式 ===
-JSON形式で、各ドキュメントには以下を含める：
-- title: 適切な日本語タイトル
-- summary: 1-2文の簡潔な要約
-- content: 上記構造に従ったMarkdown形式の本文
-- fragment_ids: 使用したフラグメントのIDリスト
-- tags: ドキュメントに適したタグの配列
+10. 必要に応じてさらなる見出しと内容`
 
-=== Markdown例 ===
+// markdownExample はドキュメント本文のMarkdownの例
+const markdownExample = `=== Markdown例 ===
 # プログラミング言語の基礎
 
 プログラミング言語は開発者がコンピュータに指示を与えるためのツールです。
@@ -223,18 +304,165 @@ JSON形式で、各ドキュメントには以下を含める：
 
 ## 利用場面
 
-Webアプリケーション開発、システム開発、機械学習など、用途に応じて適切な言語を選択することが重要です。`, fragmentsInfo)
+Webアプリケーション開発、システム開発、機械学習など、用途に応じて適切な言語を選択することが重要です。`
+
+// styleGuides はスタイルごとのドキュメントの構成（既定のMarkdown構造の要件の代わりに使う）
+var styleGuides = map[string]string{
+	models.GenerationStyleHowTo: `=== スタイル: ハウツー ===
+読者が手を動かして目的を達成できるように書いてください。contentフィールドは以下の構造に従ってください：
+1. # メインタイトル（titleと同じ、「〜する方法」の形）
+2. 導入段落（何ができるようになるか）
+3. ## 前提条件
+4. ## 手順（番号付きリストで1ステップずつ、コマンドや設定はコードブロックで示す）
+5. ## 確認方法
+6. ## トラブルシューティング（フラグメントに情報がある場合のみ）`,
+	models.GenerationStyleReference: `=== スタイル: リファレンス ===
+読者が必要な情報をすぐに探せるように、網羅的かつ簡潔に書いてください。contentフィールドは以下の構造に従ってください：
+1. # メインタイトル（titleと同じ、対象の名前）
+2. 概要段落（1-2行）
+3. ## 項目ごとの見出し（設定項目・コマンド・APIなど）
+4. 各項目は定義・値・既定値・例を箇条書きまたは表で示す
+5. 説明的な文章や手順は最小限にする`,
+	models.GenerationStyleFAQ: `=== スタイル: FAQ ===
+読者が抱きそうな質問と、その回答の形式で書いてください。contentフィールドは以下の構造に従ってください：
+1. # メインタイトル（titleと同じ）
+2. 導入段落（このFAQが扱う範囲）
+3. ## 質問（疑問文の見出し）
+4. 回答段落（結論を先に書く）
+5. 質問と回答をフラグメントの内容の分だけ繰り返す`,
+	models.GenerationStyleADR: `=== スタイル: ADR（設計判断の記録） ===
+フラグメントに含まれる設計判断ごとに、Architecture Decision Recordとして書いてください。contentフィールドは以下の構造に従ってください：
+1. # メインタイトル（titleと同じ、決定した内容）
+2. ## ステータス（提案・承認・廃止など、フラグメントから判断できない場合は「承認」）
+3. ## コンテキスト（判断が必要になった背景と制約）
+4. ## 決定（何を選んだか）
+5. ## 検討した選択肢（フラグメントに情報がある場合のみ）
+6. ## 結果（決定によって生じる利点・欠点・影響）`,
+	models.GenerationStyleOnboarding: `=== スタイル: オンボーディングガイド ===
+チームに新しく参加した人が最初に読むガイドとして書いてください。前提知識を仮定せず、用語は初出で説明してください。contentフィールドは以下の構造に従ってください：
+1. # メインタイトル（titleと同じ）
+2. 導入段落（このガイドを読むと何が分かるか）
+3. ## 全体像
+4. ## 知っておくべきこと（重要な概念・ルール・注意点）
+5. ## 最初にやること（手順がある場合は番号付きリスト）
+6. ## 次に読むもの・聞く相手（フラグメントに情報がある場合のみ）`,
+}
+
+// granularityGuides は粒度ごとのドキュメントのまとめ方
+var granularityGuides = map[string]string{
+	models.GenerationGranularityBroad:    "大きなテーマでフラグメントをまとめ、少数の包括的なドキュメントにする",
+	models.GenerationGranularityDetailed: "テーマを細かく分け、1件のドキュメントが1つの話題だけを扱うようにする",
 }
 
-func (g *DocumentGenerator) createDocumentsFromResponse(documentsResponse *DocumentsResponse) error {
+// buildGenerationOptionsSection は利用者の生成パラメータをプロンプトの指示にする
+func buildGenerationOptionsSection(options usecase.GenerationOptions) string {
+	var lines []string
+	if options.Audience != "" {
+		lines = append(lines, fmt.Sprintf("- 想定読者: %s（この読者に合わせて用語の説明や詳しさを調整する）", options.Audience))
+	}
+	if guide, ok := granularityGuides[options.Granularity]; ok {
+		lines = append(lines, "- 粒度: "+guide)
+	}
+	if options.TargetDocuments > 0 {
+		lines = append(lines, fmt.Sprintf("- ドキュメント数: %d件程度にまとめる（フラグメントの内容に対して無理のない範囲で）", options.TargetDocuments))
+	}
+
+	section := ""
+	if len(lines) > 0 {
+		section += "\n=== 生成パラメータ ===\n" + strings.Join(lines, "\n") + "\n"
+	}
+	if options.Instructions != "" {
+		section += fmt.Sprintf(`
+=== 利用者からの追加指示（最優先で従うこと） ===
+%s
+`, options.Instructions)
+	}
+	return section
+}
+
+func (g *DocumentGenerator) buildDocumentPrompt(fragmentsInfo, lockedInfo string, options usecase.GenerationOptions) string {
+	lockedSection := ""
+	if lockedInfo != "" {
+		lockedSection = fmt.Sprintf(`
+=== 固定ドキュメント（参考情報・変更不可） ===
+以下のドキュメントは人が確定・作成・編集したもので、新しいバージョンにそのまま引き継がれます。
+これらと重複するドキュメントは作成せず、内容を補完・参照する形で他のドキュメントを作成してください。
+ここに含まれるフラグメントIDは fragment_ids に含めないでください。
+
+%s
+`, lockedInfo)
+	}
+
+	// スタイルを指定した場合は、既定の構造と例の代わりにスタイルの構成を使う
+	structureGuide := markdownStructureGuide + "\n\n" + markdownExample
+	if guide, ok := styleGuides[options.Style]; ok {
+		structureGuide = guide
+	}
+
+	return fmt.Sprintf(`以下のフラグメントを分析し、テーマ別にドキュメントを作成してください。
+
+=== フラグメント一覧 ===
+%s
+%s%s
+=== 作成指針 ===
+- 関連するフラグメントをテーマ別にグループ化
+- フラグメントの内容を基に、必要な背景知識や詳細説明を適度に補完
+- 実用的で読みやすいドキュメントを作成
+- 各ドキュメントに適切なタグを2-4個程度付与
+
+=== タグ付与基準 ===
+- 短く簡潔で検索しやすいタグを使用
+
+%s
+
+=== 出力形式 ===
+JSON形式で、各ドキュメントには以下を含める：
+- title: 適切な日本語タイトル
+- summary: 1-2文の簡潔な要約
+- content: 上記構造に従ったMarkdown形式の本文
+- fragment_ids: 使用したフラグメントのIDリスト
+- tags: ドキュメントに適したタグの配列
+- suggested_questions: 読者が次に知りたくなりそうな、本文で答えられる具体的な質問を3-5個`, fragmentsInfo, lockedSection, buildGenerationOptionsSection(options), structureGuide)
+}
+
+func (g *DocumentGenerator) createDocumentsFromResponse(documentsResponse *DocumentsResponse, preservedDocuments []models.Document, scope usecase.GenerationScope, options usecase.GenerationOptions, fragmentCount int) error {
 	// ドキュメントを作成
 	fmt.Printf("Creating %d documents...\n", len(documentsResponse.Documents))
 
 	// 同一バッチのドキュメント群に同じバージョンタイムスタンプを設定
 	versionCreatedAt := time.Now()
-	fmt.Printf("Document version timestamp: %s\n\n", versionCreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Document version timestamp: %s\n", versionCreatedAt.Format("2006-01-02 15:04:05"))
+	if scope.IsScoped() {
+		fmt.Printf("Scoped version (%s): the latest full version is kept as \"latest\".\n", scope.Describe())
+	}
+	fmt.Println()
+
+	// 生成の記録をドキュメントより先に保存する（スコープ付きのバージョンを最新と区別するために使用）
+	// 記録がないままドキュメントだけが残ると、スコープ付きのバージョンが最新として扱われてしまう
+	runUsecase := usecase.NewGenerationRunUsecase(g.db)
+	run, err := runUsecase.CreateGenerationRun(usecase.CreateGenerationRunInput{
+		VersionCreatedAt: versionCreatedAt,
+		Scope:            scope,
+		Options:          options,
+		FragmentCount:    fragmentCount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record generation run: %w", err)
+	}
 
 	documentUsecase := usecase.NewDocumentUsecase(g.db)
+	documentCount := 0
+
+	// 固定・人が編集したドキュメントを内容を変えずに引き継ぐ
+	for _, preserved := range preservedDocuments {
+		document, err := documentUsecase.CarryOverDocument(&preserved, versionCreatedAt)
+		if err != nil {
+			fmt.Printf("Failed to carry over document '%s': %v\n", preserved.Title, err)
+			continue
+		}
+		fmt.Printf("✓ Document carried over with ID: %d (%s)\n", document.ID, document.Title)
+		documentCount++
+	}
 
 	for i, docReq := range documentsResponse.Documents {
 		fmt.Printf("Creating document %d: %s (Tags: %v)\n", i+1, docReq.Title, docReq.Tags)
@@ -267,11 +495,23 @@ func (g *DocumentGenerator) createDocumentsFromResponse(documentsResponse *Docum
 			continue
 		}
 
+		// 質問候補を生成元の本文のハッシュとともに保存
+		if questions := normalizeQuestions(docReq.SuggestedQuestions); len(questions) > 0 {
+			if err := documentUsecase.SetSuggestedQuestions(document.ID, questions, contentHash(document.Content)); err != nil {
+				fmt.Printf("Failed to save suggested questions for document '%s': %v\n", docReq.Title, err)
+			}
+		}
+
 		fmt.Printf("✓ Document created with ID: %d (Version: %s, Fragments: %d, Tags: %d)\n",
 			document.ID,
 			document.VersionCreatedAt.Format("2006-01-02 15:04:05"),
 			len(fragmentIDs),
 			len(tagIDs))
+		documentCount++
+	}
+
+	if err := runUsecase.SetDocumentCount(run.ID, documentCount); err != nil {
+		return fmt.Errorf("failed to record generation run: %w", err)
 	}
 
 	fmt.Println("\nDocument creation completed!")
@@ -280,51 +520,5 @@ func (g *DocumentGenerator) createDocumentsFromResponse(documentsResponse *Docum
 
 // createOrGetTags は指定されたタグ名のタグを作成または取得する
 func (g *DocumentGenerator) createOrGetTags(tagNames []string) ([]uint, error) {
-	var tagIDs []uint
-
-	for _, tagName := range tagNames {
-		if tagName == "" {
-			continue
-		}
-
-		// 既存のタグを検索
-		var tag models.Tag
-		err := g.db.Where("name = ?", tagName).First(&tag).Error
-		if err == nil {
-			// 既存のタグが見つかった場合
-			tagIDs = append(tagIDs, tag.ID)
-			continue
-		}
-
-		// タグが見つからない場合は新しく作成
-		newTag := models.Tag{
-			Name:  tagName,
-			Color: g.generateTagColor(tagName), // タグ名から色を生成
-		}
-
-		if err := g.db.Create(&newTag).Error; err != nil {
-			return nil, fmt.Errorf("failed to create tag '%s': %w", tagName, err)
-		}
-
-		tagIDs = append(tagIDs, newTag.ID)
-		fmt.Printf("  Created new tag: %s (ID: %d)\n", tagName, newTag.ID)
-	}
-
-	return tagIDs, nil
-}
-
-// generateTagColor はタグ名から一意の色を生成する
-func (g *DocumentGenerator) generateTagColor(tagName string) string {
-	// 簡単なハッシュベースの色生成
-	hash := 0
-	for _, char := range tagName {
-		hash = int(char) + ((hash << 5) - hash)
-	}
-
-	// HSL色空間で彩度と明度を固定し、色相のみを変更
-	hue := (hash%360 + 360) % 360
-
-	// 色相を6つの主要な色に分類してより見やすい色にする
-	colors := []string{"#3B82F6", "#EF4444", "#10B981", "#F59E0B", "#8B5CF6", "#EC4899"}
-	return colors[hue%len(colors)]
+	return usecase.NewTagUsecase(g.db).GetOrCreateTags(tagNames)
 }
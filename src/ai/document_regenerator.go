@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"google.golang.org/genai"
+)
+
+// RegenerateDocument は1件のドキュメントだけを関連フラグメントから作り直す
+// 結果は同じドキュメントの "AI" のリビジョンとして保存され、同じバージョンの他のドキュメントは変更しない
+func (g *DocumentGenerator) RegenerateDocument(ctx context.Context, documentID uint, instructions string) (*models.Document, error) {
+	documentUsecase := usecase.NewDocumentUsecase(g.db)
+
+	document, err := documentUsecase.GetDocument(documentID)
+	if err != nil {
+		return nil, fmt.Errorf("document with ID %d not found", documentID)
+	}
+	if document.Locked {
+		return nil, fmt.Errorf("document %d is locked; unlock it before regenerating", documentID)
+	}
+	if len(document.Fragments) == 0 {
+		return nil, fmt.Errorf("document %d has no linked fragments to regenerate from", documentID)
+	}
+
+	fmt.Printf("Regenerating document %d from %d fragments...\n", document.ID, len(document.Fragments))
+	if document.EditedByHuman {
+		fmt.Println("This document has been edited by a person. The edits are kept in the revision history.")
+	}
+
+	// 生成時のスタイル・粒度・想定読者などを引き継ぐ（記録がない古いバージョンは既定値）
+	var options usecase.GenerationOptions
+	if run, err := usecase.NewGenerationRunUsecase(g.db).GetGenerationRunByVersion(document.VersionCreatedAt); err == nil {
+		options = usecase.OptionsOf(run)
+	}
+	// ドキュメント数の指定は1件の作り直しには当てはまらない
+	options.TargetDocuments = 0
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		options.Instructions = strings.TrimSpace(options.Instructions + "\n" + instructions)
+	}
+
+	config := &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr(float32(0.1)),
+		MaxOutputTokens:  8000,
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   documentSchema(),
+	}
+
+	resp, err := g.client.Models.GenerateContent(ctx, "gemini-2.5-flash", genai.Text(g.buildRegeneratePrompt(document, options)), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no response generated")
+	}
+
+	var docReq DocumentRequest
+	if err := json.Unmarshal([]byte(resp.Candidates[0].Content.Parts[0].Text), &docReq); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+	}
+	if strings.TrimSpace(docReq.Title) == "" || strings.TrimSpace(docReq.Content) == "" {
+		return nil, fmt.Errorf("generated document is empty")
+	}
+
+	tagIDs, err := g.createOrGetTags(docReq.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if tagIDs == nil {
+		tagIDs = []uint{}
+	}
+
+	// 関連フラグメントは変えずに内容とタグだけを置き換える
+	regenerated, err := documentUsecase.UpdateDocument(usecase.UpdateDocumentInput{
+		ID:      document.ID,
+		Title:   docReq.Title,
+		Summary: docReq.Summary,
+		Content: docReq.Content,
+		TagIDs:  tagIDs,
+		Author:  usecase.DocumentAuthorAI,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save regenerated document: %w", err)
+	}
+
+	if questions := normalizeQuestions(docReq.SuggestedQuestions); len(questions) > 0 {
+		if err := documentUsecase.SetSuggestedQuestions(regenerated.ID, questions, contentHash(regenerated.Content)); err != nil {
+			fmt.Printf("Failed to save suggested questions: %v\n", err)
+		}
+	}
+
+	fmt.Printf("✓ Document regenerated: %d (%s)\n", regenerated.ID, regenerated.Title)
+	return regenerated, nil
+}
+
+func (g *DocumentGenerator) buildRegeneratePrompt(document *models.Document, options usecase.GenerationOptions) string {
+	fragmentsInfo := ""
+	for _, fragment := range document.Fragments {
+		fragmentsInfo += fmt.Sprintf("Fragment ID: %d\nContent: %s\nCreated: %s\n\n",
+			fragment.ID, fragment.Content, fragment.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	// 人が編集したドキュメントは、その修正内容を尊重させる
+	currentNote := "現在のドキュメントには誤りや不足がある可能性があります。フラグメントを正として書き直してください。"
+	if document.EditedByHuman {
+		currentNote = "現在のドキュメントには人による修正が含まれています。修正された内容は尊重しつつ、フラグメントに基づいて書き直してください。"
+	}
+
+	// 生成時にスタイルを指定していた場合は、既定の構造の代わりにスタイルの構成を使う
+	structureGuide := markdownStructureGuide
+	if guide, ok := styleGuides[options.Style]; ok {
+		structureGuide = guide
+	}
+
+	return fmt.Sprintf(`以下のフラグメントから、1件のドキュメントを作り直してください。
+%s
+
+=== フラグメント一覧 ===
+%s
+=== 現在のドキュメント ===
+タイトル: %s
+要約: %s
+
+%s
+%s
+=== 作成指針 ===
+- すべてのフラグメントの内容を1件のドキュメントにまとめる
+- フラグメントの内容を基に、必要な背景知識や詳細説明を適度に補完
+- 適切なタグを2-4個程度付与
+
+%s
+
+=== 出力形式 ===
+JSON形式で以下を含める：
+- title: 適切な日本語タイトル
+- summary: 1-2文の簡潔な要約
+- content: 上記構造に従ったMarkdown形式の本文
+- fragment_ids: 使用したフラグメントのIDリスト
+- tags: ドキュメントに適したタグの配列
+- suggested_questions: 読者が次に知りたくなりそうな、本文で答えられる具体的な質問を3-5個`,
+		currentNote, fragmentsInfo, document.Title, document.Summary, document.Content, buildGenerationOptionsSection(options), structureGuide)
+}
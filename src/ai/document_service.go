@@ -2,6 +2,10 @@ package ai
 
 import (
 	"context"
+	"fmt"
+
+	"insight/src/models"
+	"insight/src/usecase"
 
 	"gorm.io/gorm"
 )
@@ -18,20 +22,134 @@ func NewService(db *gorm.DB) (*Service, error) {
 	}, nil
 }
 
-// CreateDocuments はフラグメントからドキュメントを作成
-func (s *Service) CreateDocuments(ctx context.Context) error {
+// CreateDocuments は対象範囲のフラグメントから、生成パラメータに従ってドキュメントを作成
+func (s *Service) CreateDocuments(ctx context.Context, scope usecase.GenerationScope, options usecase.GenerationOptions) error {
 	generator, err := NewDocumentGenerator(s.db)
 	if err != nil {
 		return err
 	}
-	return generator.GenerateDocuments(ctx)
+	if err := generator.GenerateDocuments(ctx, scope, options); err != nil {
+		return err
+	}
+
+	// 生成されたドキュメントをベクトルインデックスに反映
+	if err := s.RefreshSemanticIndex(ctx); err != nil {
+		fmt.Printf("Failed to refresh semantic index: %v\n", err)
+	}
+
+	// 生成時に質問候補が得られなかったドキュメントを補完
+	if err := s.RefreshSuggestedQuestions(ctx, nil); err != nil {
+		fmt.Printf("Failed to refresh suggested questions: %v\n", err)
+	}
+	return nil
+}
+
+// RegenerateDocument は1件のドキュメントだけを関連フラグメントから作り直す
+// instructions には利用者からの追加指示を指定できる
+func (s *Service) RegenerateDocument(ctx context.Context, documentID uint, instructions string) (*models.Document, error) {
+	generator, err := NewDocumentGenerator(s.db)
+	if err != nil {
+		return nil, err
+	}
+	document, err := generator.RegenerateDocument(ctx, documentID, instructions)
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成時に質問候補が得られなかった場合は補完
+	if err := s.RefreshSuggestedQuestions(ctx, []uint{document.ID}); err != nil {
+		fmt.Printf("Failed to refresh suggested questions: %v\n", err)
+	}
+	return document, nil
+}
+
+// RefreshSuggestedQuestions は本文が変わったドキュメントの質問候補を再生成する
+// documentIDs を指定しない場合は最新バージョンのドキュメントを対象とする
+func (s *Service) RefreshSuggestedQuestions(ctx context.Context, documentIDs []uint) error {
+	documentUsecase := usecase.NewDocumentUsecase(s.db)
+
+	var documents []models.Document
+	if len(documentIDs) > 0 {
+		if err := s.db.Find(&documents, documentIDs).Error; err != nil {
+			return fmt.Errorf("failed to get documents: %w", err)
+		}
+	} else {
+		version, err := documentUsecase.GetLatestVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get versions: %w", err)
+		}
+		if version.IsZero() {
+			return nil
+		}
+		documents, err = documentUsecase.GetDocumentsByVersion(version)
+		if err != nil {
+			return fmt.Errorf("failed to get documents: %w", err)
+		}
+	}
+
+	suggester, err := NewQuestionSuggester(s.db)
+	if err != nil {
+		return err
+	}
+	return suggester.Refresh(ctx, documents)
 }
 
-// CompressFragments はフラグメントを圧縮する
-func (s *Service) CompressFragments(ctx context.Context) error {
+// CompressFragments はフラグメントを圧縮し、適用した操作を承認者（approvedBy）とともに記録する
+func (s *Service) CompressFragments(ctx context.Context, approvedBy *uint) error {
 	compressor, err := NewFragmentCompressor(s.db)
 	if err != nil {
 		return err
 	}
-	return compressor.CompressFragments(ctx)
+	return compressor.CompressFragments(ctx, approvedBy)
+}
+
+// AutoTagFragments はフラグメントに既存のタグの語彙を優先してタグを付ける
+// fragmentIDs を指定した場合はそのフラグメントのみ、all が true の場合はタグ付け済みのものも含めて対象とする
+// どちらも指定しない場合はタグのないフラグメントを対象とする
+func (s *Service) AutoTagFragments(ctx context.Context, fragmentIDs []uint, all bool) ([]FragmentTagResult, error) {
+	fragmentUsecase := usecase.NewFragmentUsecase(s.db)
+
+	var fragments []models.Fragment
+	var err error
+	switch {
+	case len(fragmentIDs) > 0:
+		fragments, err = fragmentUsecase.GetFragmentsInScope(usecase.GenerationScope{FragmentIDs: fragmentIDs})
+	case all:
+		fragments, err = fragmentUsecase.GetFragmentsInScope(usecase.GenerationScope{})
+	default:
+		fragments, err = fragmentUsecase.GetUntaggedFragments()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fragments: %w", err)
+	}
+	if len(fragments) == 0 {
+		fmt.Println("No fragments to tag.")
+		return nil, nil
+	}
+
+	tagger, err := NewFragmentTagger(s.db)
+	if err != nil {
+		return nil, err
+	}
+	return tagger.TagFragments(ctx, fragments)
+}
+
+// ProposeTagMerges はタグの語彙を見直し、統合すべきタグの組を提案する（適用はしない）
+func (s *Service) ProposeTagMerges(ctx context.Context) ([]TagMergeProposal, error) {
+	consolidator, err := NewTagConsolidator(s.db)
+	if err != nil {
+		return nil, err
+	}
+	return consolidator.ProposeMerges(ctx)
+}
+
+// RefreshSemanticIndex は内容が変わったFragmentとDocumentをベクトルインデックスに反映する
+func (s *Service) RefreshSemanticIndex(ctx context.Context) error {
+	return NewSemanticIndex(s.db).Refresh(ctx)
+}
+
+// SemanticSearch はベクトルインデックスを用いてFragmentとDocumentを意味検索する
+// インデックスは更新しないため、必要に応じて事前に RefreshSemanticIndex を呼び出す
+func (s *Service) SemanticSearch(ctx context.Context, query string, opts SemanticSearchOptions) ([]SemanticHit, error) {
+	return NewSemanticIndex(s.db).Search(ctx, query, opts)
 }
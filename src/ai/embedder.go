@@ -0,0 +1,185 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genai"
+)
+
+// Embedder はテキストをベクトルに変換するインターフェース
+type Embedder interface {
+	// Name は埋め込みモデル名を返す（異なるモデルのベクトルは比較しない）
+	Name() string
+	// Embed は複数テキストをまとめてベクトル化する
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder は利用可能な埋め込み器を返す
+// GEMINI_API_KEY が設定されていればGeminiを、なければオフラインのハッシュ埋め込みを使用する
+func NewEmbedder(ctx context.Context) Embedder {
+	if os.Getenv("GEMINI_API_KEY") == "" {
+		return NewHashEmbedder()
+	}
+
+	client, err := NewGenaiClient(ctx)
+	if err != nil {
+		fmt.Printf("Falling back to offline embedder: %v\n", err)
+		return NewHashEmbedder()
+	}
+
+	return &GeminiEmbedder{client: client, model: "text-embedding-004"}
+}
+
+// GeminiEmbedder はGeminiの埋め込みAPIを使用する埋め込み器
+type GeminiEmbedder struct {
+	client *genai.Client
+	model  string
+}
+
+// Name は埋め込みモデル名を返す
+func (e *GeminiEmbedder) Name() string {
+	return "gemini/" + e.model
+}
+
+// Embed は複数テキストをまとめてベクトル化する
+func (e *GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	// APIのバッチ上限を考慮して分割して送信
+	const batchSize = 100
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		contents := make([]*genai.Content, 0, end-start)
+		for _, text := range texts[start:end] {
+			contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+		}
+
+		resp, err := e.client.Models.EmbedContent(ctx, e.model, contents, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed content: %w", err)
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("unexpected embedding count: got %d, want %d", len(resp.Embeddings), end-start)
+		}
+
+		for _, embedding := range resp.Embeddings {
+			vectors = append(vectors, normalizeVector(embedding.Values))
+		}
+	}
+
+	return vectors, nil
+}
+
+// HashEmbedder はネットワーク不要のオフライン埋め込み器
+// 単語と文字bi-gramを特徴ハッシュで固定次元に射影する
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder は新しいHashEmbedderを作成
+func NewHashEmbedder() *HashEmbedder {
+	return &HashEmbedder{dimensions: 512}
+}
+
+// Name は埋め込みモデル名を返す
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("offline/hash-%d", e.dimensions)
+}
+
+// Embed は複数テキストをまとめてベクトル化する
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		for _, feature := range textFeatures(text) {
+			h := fnv.New32a()
+			h.Write([]byte(feature))
+			sum := h.Sum32()
+
+			// 符号付きハッシュで衝突の偏りを打ち消す
+			sign := float32(1)
+			if sum&(1<<31) != 0 {
+				sign = -1
+			}
+			vector[int(sum%uint32(e.dimensions))] += sign
+		}
+		vectors[i] = normalizeVector(vector)
+	}
+	return vectors, nil
+}
+
+// textFeatures はテキストから特徴量（英数字の単語と、それ以外の文字bi-gram）を抽出する
+// 日本語は分かち書きされないため文字bi-gramで近似する
+func textFeatures(text string) []string {
+	var features []string
+	var word []rune
+	var prev rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			features = append(features, "w:"+string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, r)
+			prev = 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushWord()
+			features = append(features, "c:"+string(r))
+			if prev != 0 {
+				features = append(features, "b:"+string([]rune{prev, r}))
+			}
+			prev = r
+		default:
+			flushWord()
+			prev = 0
+		}
+	}
+	flushWord()
+
+	return features
+}
+
+// normalizeVector はベクトルをL2正規化する
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	scale := float32(1 / math.Sqrt(norm))
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = v * scale
+	}
+	return normalized
+}
+
+// cosineSimilarity は正規化済みベクトル同士のコサイン類似度を返す
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
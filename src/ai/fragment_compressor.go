@@ -33,7 +33,8 @@ func NewFragmentCompressor(db *gorm.DB) (*FragmentCompressor, error) {
 }
 
 // CompressFragments はフラグメントを圧縮する
-func (c *FragmentCompressor) CompressFragments(ctx context.Context) error {
+// approvedBy は圧縮を実行したユーザーで、適用した操作の承認者として記録する
+func (c *FragmentCompressor) CompressFragments(ctx context.Context, approvedBy *uint) error {
 	fmt.Println("Fetching all fragments for compression...")
 
 	// 全フラグメントを取得
@@ -57,7 +58,7 @@ func (c *FragmentCompressor) CompressFragments(ctx context.Context) error {
 	}
 
 	// アクションを実行
-	return c.executeCompressionActions(response)
+	return c.executeCompressionActions(response, approvedBy)
 }
 
 func (c *FragmentCompressor) analyzeFragmentsWithAI(ctx context.Context, fragments []models.Fragment) (*compressionResponse, error) {
@@ -175,7 +176,7 @@ func (c *FragmentCompressor) buildCompressionPrompt(fragmentsInfo string) string
 JSON形式で出力してください。`, fragmentsInfo)
 }
 
-func (c *FragmentCompressor) executeCompressionActions(response *compressionResponse) error {
+func (c *FragmentCompressor) executeCompressionActions(response *compressionResponse, approvedBy *uint) error {
 	// アクションを実行
 	for i, action := range response.Actions {
 		fmt.Printf("Action %d: %s (IDs: %v) - %s\n", i+1, action.Type, action.FragmentIDs, action.Reason)
@@ -188,6 +189,7 @@ func (c *FragmentCompressor) executeCompressionActions(response *compressionResp
 				continue
 			}
 			fmt.Printf("✓ Merged fragments %v\n", action.FragmentIDs)
+			c.recordAction(action.Type, action.FragmentIDs, action.NewContent, action.Reason, approvedBy)
 
 		} else if action.Type == "delete" && len(action.FragmentIDs) > 0 {
 			// 削除処理
@@ -197,6 +199,7 @@ func (c *FragmentCompressor) executeCompressionActions(response *compressionResp
 				continue
 			}
 			fmt.Printf("✓ Deleted fragments %v\n", action.FragmentIDs)
+			c.recordAction(action.Type, action.FragmentIDs, "", action.Reason, approvedBy)
 		}
 	}
 
@@ -204,6 +207,25 @@ func (c *FragmentCompressor) executeCompressionActions(response *compressionResp
 	return nil
 }
 
+// recordAction は適用した操作を承認者とともに記録する
+// 記録に失敗しても操作自体は適用済みのため、エラーは出力のみとする
+func (c *FragmentCompressor) recordAction(actionType string, fragmentIDs []int, newContent, reason string, approvedBy *uint) {
+	ids := make([]uint, len(fragmentIDs))
+	for i, id := range fragmentIDs {
+		ids[i] = uint(id)
+	}
+	record := models.CompressionAction{
+		Type:         actionType,
+		FragmentIDs:  ids,
+		NewContent:   newContent,
+		Reason:       reason,
+		ApprovedByID: approvedBy,
+	}
+	if err := c.db.Create(&record).Error; err != nil {
+		fmt.Printf("Failed to record compression action: %v\n", err)
+	}
+}
+
 // mergeFragments は複数のフラグメントを統合する
 func (c *FragmentCompressor) mergeFragments(fragmentIDs []int, newContent string) error {
 	// 最初のフラグメントを更新
@@ -211,13 +233,23 @@ func (c *FragmentCompressor) mergeFragments(fragmentIDs []int, newContent string
 
 	// トランザクション内で処理
 	return c.db.Transaction(func(tx *gorm.DB) error {
-		// 最初のフラグメントを更新
-		if err := tx.Model(&models.Fragment{}).Where("id = ?", firstID).Update("content", newContent).Error; err != nil {
+		// 最初のフラグメントを更新（統合前の内容はリビジョンとして残り、履歴から復元できる）
+		if _, err := usecase.NewFragmentUsecase(tx).UpdateFragment(usecase.UpdateFragmentInput{
+			ID:      firstID,
+			Content: newContent,
+		}); err != nil {
 			return err
 		}
 
-		// 残りのフラグメントを削除
+		// 残りのフラグメントのタグを引き継いでから削除
 		for i := 1; i < len(fragmentIDs); i++ {
+			err := tx.Exec(`INSERT INTO fragment_tags (fragment_id, tag_id)
+				SELECT ?, tag_id FROM fragment_tags WHERE fragment_id = ?
+				AND tag_id NOT IN (SELECT tag_id FROM fragment_tags WHERE fragment_id = ?)`,
+				firstID, fragmentIDs[i], firstID).Error
+			if err != nil {
+				return err
+			}
 			if err := tx.Delete(&models.Fragment{}, fragmentIDs[i]).Error; err != nil {
 				return err
 			}
@@ -0,0 +1,226 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+const (
+	// taggingBatchSize は1回のリクエストでタグ付けするフラグメント数
+	taggingBatchSize = 50
+	// maxTagsPerFragment は1件のフラグメントに付けるタグの上限
+	maxTagsPerFragment = 4
+)
+
+// FragmentTagger はフラグメントにタグを自動で付けるサービス
+type FragmentTagger struct {
+	client *genai.Client
+	db     *gorm.DB
+}
+
+// NewFragmentTagger は新しいFragmentTaggerを作成
+func NewFragmentTagger(db *gorm.DB) (*FragmentTagger, error) {
+	client, err := NewGenaiClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &FragmentTagger{
+		client: client,
+		db:     db,
+	}, nil
+}
+
+// FragmentTagResult は1件のフラグメントに付けたタグ
+type FragmentTagResult struct {
+	FragmentID uint     `json:"fragment_id"`
+	Tags       []string `json:"tags"`
+	NewTags    []string `json:"new_tags"` // 既存の語彙になく新しく作成したタグ
+}
+
+type taggingResponse struct {
+	Fragments []struct {
+		FragmentID int      `json:"fragment_id"`
+		Tags       []string `json:"tags"`
+	} `json:"fragments"`
+}
+
+// TagFragments はフラグメントにタグを付ける
+// 既存のタグの語彙を優先して使わせ、当てはまるものがない場合のみ新しいタグを作る
+func (t *FragmentTagger) TagFragments(ctx context.Context, fragments []models.Fragment) ([]FragmentTagResult, error) {
+	if len(fragments) == 0 {
+		return nil, nil
+	}
+
+	tagUsecase := usecase.NewTagUsecase(t.db)
+	fragmentUsecase := usecase.NewFragmentUsecase(t.db)
+
+	var results []FragmentTagResult
+	for start := 0; start < len(fragments); start += taggingBatchSize {
+		end := min(start+taggingBatchSize, len(fragments))
+		batch := fragments[start:end]
+
+		// バッチごとに語彙を取り直し、前のバッチで作ったタグも再利用させる
+		vocabulary, err := tagUsecase.GetTagSummaries()
+		if err != nil {
+			return results, fmt.Errorf("failed to get tags: %w", err)
+		}
+		known := make(map[string]bool, len(vocabulary))
+		for _, tag := range vocabulary {
+			known[tag.Name] = true
+		}
+
+		fmt.Printf("Tagging fragments %d-%d of %d...\n", start+1, end, len(fragments))
+		response, err := t.suggestTags(ctx, batch, vocabulary)
+		if err != nil {
+			return results, err
+		}
+
+		inBatch := make(map[uint]bool, len(batch))
+		for _, fragment := range batch {
+			inBatch[fragment.ID] = true
+		}
+
+		for _, suggestion := range response.Fragments {
+			fragmentID := uint(suggestion.FragmentID)
+			if !inBatch[fragmentID] {
+				continue
+			}
+			tags := normalizeTags(suggestion.Tags)
+			if len(tags) == 0 {
+				continue
+			}
+
+			if _, err := fragmentUsecase.AddFragmentTags(fragmentID, tags); err != nil {
+				fmt.Printf("Failed to tag fragment %d: %v\n", fragmentID, err)
+				continue
+			}
+
+			result := FragmentTagResult{FragmentID: fragmentID, Tags: tags}
+			for _, tag := range tags {
+				if !known[tag] {
+					result.NewTags = append(result.NewTags, tag)
+					known[tag] = true
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+func (t *FragmentTagger) suggestTags(ctx context.Context, fragments []models.Fragment, vocabulary []usecase.TagSummary) (*taggingResponse, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"fragments": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"fragment_id": {
+							Type:        genai.TypeInteger,
+							Description: "フラグメントのID",
+						},
+						"tags": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type: genai.TypeString,
+							},
+							Description: "フラグメントに付けるタグ（1-4個）",
+						},
+					},
+					Required: []string{"fragment_id", "tags"},
+				},
+			},
+		},
+		Required: []string{"fragments"},
+	}
+
+	config := &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr(float32(0.1)),
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	}
+
+	resp, err := t.client.Models.GenerateContent(ctx, "gemini-2.5-flash", genai.Text(buildTaggingPrompt(fragments, vocabulary)), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no response generated")
+	}
+
+	var response taggingResponse
+	if err := json.Unmarshal([]byte(resp.Candidates[0].Content.Parts[0].Text), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+	}
+	return &response, nil
+}
+
+func buildTaggingPrompt(fragments []models.Fragment, vocabulary []usecase.TagSummary) string {
+	fragmentsInfo := ""
+	for _, fragment := range fragments {
+		fragmentsInfo += fmt.Sprintf("Fragment ID: %d\nContent: %s\n\n", fragment.ID, fragment.Content)
+	}
+
+	// よく使われているタグほど先に並べる
+	sorted := append([]usecase.TagSummary(nil), vocabulary...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DocumentCount+sorted[i].FragmentCount > sorted[j].DocumentCount+sorted[j].FragmentCount
+	})
+	vocabularyInfo := "（まだタグはありません）"
+	if len(sorted) > 0 {
+		names := make([]string, len(sorted))
+		for i, tag := range sorted {
+			names[i] = tag.Name
+		}
+		vocabularyInfo = strings.Join(names, ", ")
+	}
+
+	return fmt.Sprintf(`以下のフラグメントそれぞれに、分類用のタグを付けてください。
+
+=== 既存のタグ（よく使われている順） ===
+%s
+
+=== フラグメント一覧 ===
+%s
+=== タグ付与基準 ===
+- まず既存のタグから当てはまるものを選び、表記（大文字小文字・単数複数・言語）も既存のタグに合わせる
+- 既存のタグに当てはまるものがない場合のみ、新しいタグを作る
+- 新しいタグは短く簡潔で検索しやすいものにする
+- 1件のフラグメントにつき1-%d個
+
+=== 出力形式 ===
+JSON形式で、すべてのフラグメントについて以下を含める：
+- fragment_id: フラグメントのID
+- tags: 付けるタグの配列`, vocabularyInfo, fragmentsInfo, maxTagsPerFragment)
+}
+
+// normalizeTags はタグ名の前後の空白を除き、重複を取り除いて上限までに切り詰める
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+		if len(normalized) == maxTagsPerFragment {
+			break
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,286 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"insight/src/models"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// defaultAgentSteps はツール呼び出しループの既定の最大ステップ数
+	defaultAgentSteps = 6
+	// maxAgentSteps はリクエストで指定できる最大ステップ数
+	maxAgentSteps = 10
+	// toolTraceResultRunes はトレースに記録するツール結果の最大文字数
+	toolTraceResultRunes = 300
+)
+
+// AgentQARequest はツール呼び出しによる質問応答リクエスト
+type AgentQARequest struct {
+	Question       string `json:"question" validate:"required"`
+	ConversationID uint   `json:"conversation_id"` // 0の場合は新しい会話スレッドを開始
+	MaxSteps       int    `json:"max_steps"`       // モデル呼び出しの最大回数（既定6、最大10）
+	UserID         *uint  `json:"-"`               // 質問したユーザー（記録用）
+}
+
+// ToolCall は質問応答中に実行したツール呼び出しの記録
+type ToolCall struct {
+	Step   int            `json:"step"`
+	Name   string         `json:"name"`
+	Args   map[string]any `json:"args"`
+	Result string         `json:"result"` // 結果の要約
+	Error  string         `json:"error,omitempty"`
+}
+
+// AskWithTools はモデルにツールを呼び出させながら質問に回答する
+// モデルが必要な情報を自ら検索・取得するため、コンテキストを事前に詰め込まない
+func (s *QAService) AskWithTools(ctx context.Context, req AgentQARequest) (*QAResponse, error) {
+	maxSteps := req.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultAgentSteps
+	}
+	if maxSteps > maxAgentSteps {
+		maxSteps = maxAgentSteps
+	}
+
+	// 会話スレッドを準備（続きの場合は履歴を取得）
+	conversation, history, err := s.prepareConversation(req.ConversationID, req.Question, models.QAScopeAgent, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := newQAToolExecutor(s.db)
+	var response *QAResponse
+	answer, trace, err := s.runToolLoop(ctx, executor, req.Question, history, maxSteps)
+	if err != nil {
+		// AIが利用できない場合は最新のドキュメントとフラグメントから一致する箇所を抜き出す
+		fmt.Printf("Falling back to extractive answer: %v\n", err)
+		passages, passagesErr := s.knowledgeBasePassages()
+		if passagesErr != nil {
+			return nil, passagesErr
+		}
+		response = s.extractiveAnswer(req.Question, passages)
+	} else {
+		response = executor.buildResponse(answer)
+		if len(response.Sources) == 0 {
+			response.Sources = []string{"No documents cited"}
+		}
+	}
+
+	response.ToolTrace = trace
+	if response.ToolTrace == nil {
+		response.ToolTrace = []ToolCall{}
+	}
+	response.Scope = &QAScope{
+		Type:          models.QAScopeAgent,
+		DocumentCount: len(executor.documentTitles),
+		FragmentCount: len(executor.fragmentsViewed) + len(executor.fragmentOwners),
+		Description:   fmt.Sprintf("tool use (%d calls)", len(trace)),
+	}
+
+	s.recordExchange(req.Question, nil, req.UserID, conversation, response)
+	return response, nil
+}
+
+// runToolLoop はモデルがツールを呼ばずに回答するか上限に達するまでツール呼び出しを繰り返す
+func (s *QAService) runToolLoop(ctx context.Context, executor *qaToolExecutor, question, history string, maxSteps int) (*generatedAnswer, []ToolCall, error) {
+	if s.client == nil {
+		return nil, nil, errNoLLM
+	}
+
+	config := &genai.GenerateContentConfig{
+		Temperature:       genai.Ptr(float32(0.3)),
+		MaxOutputTokens:   4000,
+		SystemInstruction: genai.NewContentFromText(agentSystemPrompt(), genai.RoleUser),
+		Tools:             []*genai.Tool{{FunctionDeclarations: qaToolDeclarations()}},
+	}
+	contents := []*genai.Content{
+		genai.NewContentFromText(formatHistorySection(history)+"\n=== 質問 ===\n"+question, genai.RoleUser),
+	}
+
+	var trace []ToolCall
+	var finalText string
+	for step := 1; step <= maxSteps; step++ {
+		resp, err := s.client.Models.GenerateContent(ctx, qaModel, contents, config)
+		if err != nil {
+			return nil, trace, fmt.Errorf("failed to generate response: %w", err)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			return nil, trace, fmt.Errorf("no response generated")
+		}
+
+		calls := resp.FunctionCalls()
+		if len(calls) == 0 {
+			finalText = resp.Text()
+			break
+		}
+
+		// ツールを実行し、結果を会話に追加して次のステップへ
+		contents = append(contents, resp.Candidates[0].Content)
+		parts := make([]*genai.Part, 0, len(calls))
+		for _, call := range calls {
+			record := ToolCall{Step: step, Name: call.Name, Args: call.Args}
+			result, summary, err := executor.execute(call.Name, call.Args)
+			if err != nil {
+				record.Error = err.Error()
+				result = map[string]any{"error": err.Error()}
+			}
+			record.Result = truncateRunes(summary, toolTraceResultRunes)
+			trace = append(trace, record)
+
+			part := genai.NewPartFromFunctionResponse(call.Name, result)
+			part.FunctionResponse.ID = call.ID
+			parts = append(parts, part)
+		}
+		contents = append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+	}
+
+	// ステップ上限に達した場合はツールなしで回答をまとめさせる
+	if finalText == "" {
+		contents = append(contents, genai.NewContentFromText("ツールの呼び出し回数の上限に達しました。これまでに得た情報だけで、指定の形式で回答してください。", genai.RoleUser))
+		config.Tools = nil
+		resp, err := s.client.Models.GenerateContent(ctx, qaModel, contents, config)
+		if err != nil {
+			return nil, trace, fmt.Errorf("failed to generate response: %w", err)
+		}
+		finalText = resp.Text()
+	}
+
+	var answer generatedAnswer
+	if err := parseJSONResponse(finalText, &answer); err != nil || answer.Answer == "" {
+		// JSONとして解釈できない場合は本文をそのまま回答として扱う
+		fmt.Printf("Failed to parse structured answer, falling back to plain text: %v\n", err)
+		answer = generatedAnswer{
+			Answer:     strings.TrimSpace(finalText),
+			Confidence: ConfidenceLow,
+		}
+	}
+	return &answer, trace, nil
+}
+
+// knowledgeBasePassages は最新バージョンのドキュメントと新しいフラグメントを抽出回答の候補にする
+func (s *QAService) knowledgeBasePassages() ([]passage, error) {
+	documents, _, err := s.resolveGlobalScope(GlobalQARequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	var fragments []models.Fragment
+	if err := s.db.Order("created_at DESC").Limit(maxFragmentCandidates).Find(&fragments).Error; err != nil {
+		return nil, fmt.Errorf("failed to find fragments: %w", err)
+	}
+
+	// ドキュメントに含まれるフラグメントは重複させない
+	passages := documentPassages(documents)
+	included := make(map[uint]bool)
+	for _, p := range passages {
+		if p.fragmentID != 0 {
+			included[p.fragmentID] = true
+		}
+	}
+	for _, p := range fragmentPassages(fragments) {
+		if !included[p.fragmentID] {
+			passages = append(passages, p)
+		}
+	}
+	return passages, nil
+}
+
+// buildResponse はAIの回答をレスポンスに変換し、引用をツールで参照したものに限定する
+func (e *qaToolExecutor) buildResponse(answer *generatedAnswer) *QAResponse {
+	response := &QAResponse{
+		Answer:           answer.Answer,
+		Citations:        []Citation{},
+		Confidence:       normalizeConfidence(answer.Confidence),
+		GeneralKnowledge: answer.GeneralKnowledge,
+		Mode:             AnswerModeGenerated,
+		WebSources:       []models.WebSource{},
+		WebSearchQueries: []string{},
+	}
+
+	seenSources := make(map[string]bool)
+	for i, raw := range answer.Citations {
+		marker := raw.Marker
+		if marker <= 0 {
+			marker = i + 1
+		}
+		citation := Citation{
+			Marker:     marker,
+			FragmentID: raw.FragmentID,
+			Quote:      raw.Quote,
+			Statement:  raw.Statement,
+		}
+
+		var source string
+		switch {
+		case raw.FragmentID != 0 && e.fragmentOwners[raw.FragmentID] != 0:
+			documentID := e.fragmentOwners[raw.FragmentID]
+			citation.DocumentID = documentID
+			citation.DocumentTitle = e.documentTitles[documentID]
+			citation.URL = fmt.Sprintf("/documents/%d#fragment-%d", documentID, raw.FragmentID)
+			source = fmt.Sprintf("Document: %s", citation.DocumentTitle)
+		case raw.FragmentID != 0 && e.fragmentsViewed[raw.FragmentID]:
+			citation.URL = fmt.Sprintf("/fragments#fragment-%d", raw.FragmentID)
+			source = fmt.Sprintf("Fragment #%d", raw.FragmentID)
+		case raw.FragmentID == 0 && e.documentTitles[raw.DocumentID] != "":
+			citation.DocumentID = raw.DocumentID
+			citation.DocumentTitle = e.documentTitles[raw.DocumentID]
+			citation.URL = fmt.Sprintf("/documents/%d", raw.DocumentID)
+			source = fmt.Sprintf("Document: %s", citation.DocumentTitle)
+		default:
+			// ツールで参照していないIDは捏造の可能性があるため除外
+			continue
+		}
+
+		response.Citations = append(response.Citations, citation)
+		if !seenSources[source] {
+			seenSources[source] = true
+			response.Sources = append(response.Sources, source)
+		}
+	}
+
+	// 根拠を示せない回答は信頼度を下げる
+	if len(response.Citations) == 0 && response.Confidence == ConfidenceHigh {
+		response.Confidence = ConfidenceMedium
+	}
+
+	return response
+}
+
+// agentSystemPrompt はツール呼び出しによる質問応答のシステムプロンプト
+func agentSystemPrompt() string {
+	return `あなたは技術文書の専門家です。ユーザーのナレッジベース（ドキュメントとフラグメント）をツールで調べ、質問に正確で有用な回答を提供してください。
+
+=== 調べ方 ===
+- まず search_documents や search_fragments で関連する情報を探し、必要に応じて read_document で本文を読んでください
+- 検索で見つからない場合は、別のキーワードや list_tags のタグで絞り込んで再検索してください
+- 特定の時点の情報が必要な場合は list_versions でバージョンを確認してください
+- 十分な情報が集まったら、ツールを呼ばずに回答してください
+
+=== 回答指針 ===
+- ツールで得た内容を第一に参考にし、記載のない情報を一般的な知識で補完した場合はその旨を明記してください
+- 回答は具体的で実用的なものにし、日本語で回答してください
+
+=== 引用のルール ===
+- ドキュメントやフラグメントに基づく記述の直後に [1] のような引用番号を付けてください
+- citationsには各引用番号について、根拠となる document_id・fragment_id（フラグメントを引用する場合のみ）・原文の短い引用（quote）・裏付ける記述（statement）を含めてください
+- IDはツールの結果に含まれていたものだけを使用し、存在しないIDを作らないでください
+- confidence はナレッジベースによる裏付けの度合いを high / medium / low で示してください
+
+=== 出力形式 ===
+最終回答は以下のキーを持つJSONオブジェクトのみを出力してください：
+{"answer": "...", "citations": [{"marker": 1, "document_id": 0, "fragment_id": 0, "quote": "...", "statement": "..."}], "confidence": "high|medium|low", "general_knowledge": false}`
+}
+
+// truncateRunes は文字数で切り詰める
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "..."
+}
@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// historyTokenBudget は会話履歴としてプロンプトに含める最大トークン数の目安
+	historyTokenBudget = 6000
+	// conversationTitleRunes は質問から生成するスレッドタイトルの最大文字数
+	conversationTitleRunes = 50
+)
+
+// ConversationRequest は既存の会話スレッドへの追加質問リクエスト
+type ConversationRequest struct {
+	ConversationID uint   `json:"conversation_id" validate:"required"`
+	Question       string `json:"question" validate:"required"`
+	UseWebSearch   bool   `json:"use_web_search"`
+	UserID         *uint  `json:"-"` // 質問したユーザー（記録用）
+}
+
+// ContinueConversation は既存の会話スレッドの続きとして質問に回答する
+// スレッドの対象（特定ドキュメントか全体か）に応じて適切な質問応答を行う
+func (s *QAService) ContinueConversation(ctx context.Context, req ConversationRequest) (*QAResponse, error) {
+	var conversation models.Conversation
+	if err := s.db.First(&conversation, req.ConversationID).Error; err != nil {
+		return nil, fmt.Errorf("conversation not found: %w", err)
+	}
+
+	// フラグメント対象のスレッドは直前の質問の範囲（期間・タグ）を引き継ぐ
+	if conversation.Scope == models.QAScopeFragments {
+		fragmentReq := FragmentQARequest{
+			Question:       req.Question,
+			UseWebSearch:   req.UseWebSearch,
+			ConversationID: conversation.ID,
+			UserID:         req.UserID,
+		}
+		if last, err := s.lastExchange(conversation.ID); err == nil {
+			fragmentReq.Tags = last.ScopeTags
+			fragmentReq.Since = last.ScopeSince
+			fragmentReq.Until = last.ScopeUntil
+		}
+		return s.AskFragmentQuestion(ctx, fragmentReq)
+	}
+
+	// ツール呼び出しのスレッドは引き続きモデルに調べさせる
+	if conversation.Scope == models.QAScopeAgent {
+		return s.AskWithTools(ctx, AgentQARequest{
+			Question:       req.Question,
+			ConversationID: conversation.ID,
+			UserID:         req.UserID,
+		})
+	}
+
+	if conversation.DocumentID != nil {
+		return s.AskQuestion(ctx, QARequest{
+			DocumentID:     *conversation.DocumentID,
+			Question:       req.Question,
+			UseWebSearch:   req.UseWebSearch,
+			ConversationID: conversation.ID,
+			UserID:         req.UserID,
+		})
+	}
+
+	// スレッド内で対象範囲が変わらないよう直前の質問の範囲を引き継ぐ
+	globalReq := GlobalQARequest{
+		Question:       req.Question,
+		UseWebSearch:   req.UseWebSearch,
+		ConversationID: conversation.ID,
+		UserID:         req.UserID,
+	}
+	if last, err := s.lastExchange(conversation.ID); err == nil {
+		globalReq.Version = last.Version
+		globalReq.Tags = last.ScopeTags
+		globalReq.DocumentIDs = last.ScopeDocumentIDs
+	}
+
+	return s.AskGlobalQuestion(ctx, globalReq)
+}
+
+// lastExchange は会話スレッドの直前の質問応答を取得する
+func (s *QAService) lastExchange(conversationID uint) (*models.QAExchange, error) {
+	var exchange models.QAExchange
+	if err := s.db.Where("conversation_id = ?", conversationID).Order("id DESC").First(&exchange).Error; err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+// prepareConversation は会話スレッドを取得または新規作成し、プロンプト用の履歴を返す
+// conversationIDが0の場合は質問をタイトルとした新しいスレッドを作成する
+func (s *QAService) prepareConversation(conversationID uint, question, scope string, documentID *uint) (*models.Conversation, string, error) {
+	conversationUsecase := usecase.NewConversationUsecase(s.db)
+	if conversationID == 0 {
+		conversation, err := conversationUsecase.CreateConversation(usecase.CreateConversationInput{
+			Title:      conversationTitle(question),
+			Scope:      scope,
+			DocumentID: documentID,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create conversation: %w", err)
+		}
+		return conversation, "", nil
+	}
+
+	conversation, err := conversationUsecase.GetConversation(conversationID)
+	if err != nil {
+		return nil, "", fmt.Errorf("conversation not found: %w", err)
+	}
+
+	// 別のドキュメント（または全体）のスレッドに質問を混在させない
+	if !sameDocument(conversation.DocumentID, documentID) || (conversation.Scope != "" && conversation.Scope != scope) {
+		return nil, "", fmt.Errorf("conversation %d belongs to a different scope", conversationID)
+	}
+
+	return conversation, buildHistory(conversation.Messages, historyTokenBudget), nil
+}
+
+// appendToConversation は質問と回答を会話スレッドに追加し、レスポンスにスレッドIDを設定する
+func (s *QAService) appendToConversation(conversation *models.Conversation, question string, response *QAResponse) {
+	exchangeID := response.ExchangeID
+	messages := []usecase.AddMessageInput{
+		{ConversationID: conversation.ID, Role: models.MessageRoleUser, Content: question, ExchangeID: &exchangeID},
+		{ConversationID: conversation.ID, Role: models.MessageRoleAssistant, Content: response.Answer, ExchangeID: &exchangeID},
+	}
+
+	// 質問と回答は必ず対で残す
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		conversationUsecase := usecase.NewConversationUsecase(tx)
+		for _, message := range messages {
+			if _, err := conversationUsecase.AddMessage(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Failed to append to conversation %d: %v\n", conversation.ID, err)
+		return
+	}
+	response.ConversationID = conversation.ID
+}
+
+// buildHistory はトークン予算内に収まる直近のメッセージを時系列順に整形する
+// トークン数は1文字1トークンとして概算する
+func buildHistory(messages []models.Message, budget int) string {
+	var selected []string
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		label := "ユーザー"
+		if messages[i].Role == models.MessageRoleAssistant {
+			label = "アシスタント"
+		}
+		entry := fmt.Sprintf("%s: %s", label, messages[i].Content)
+
+		cost := len([]rune(entry))
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		selected = append(selected, entry)
+	}
+
+	// 新しい順に集めたので時系列順に戻す
+	for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+		selected[i], selected[j] = selected[j], selected[i]
+	}
+	return strings.Join(selected, "\n\n")
+}
+
+// formatHistorySection は会話履歴をプロンプトのセクションとして整形する
+func formatHistorySection(history string) string {
+	if history == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+=== 会話履歴 ===
+以下はこれまでのやり取りです。質問中の「それ」「さっきの」などの指示語はこの履歴を踏まえて解釈してください。
+
+%s
+`, history)
+}
+
+// conversationTitle は質問からスレッドのタイトルを生成する
+func conversationTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	runes := []rune(title)
+	if len(runes) > conversationTitleRunes {
+		return string(runes[:conversationTitleRunes]) + "…"
+	}
+	return title
+}
+
+func sameDocument(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,385 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"insight/src/models"
+)
+
+// 回答の生成方法
+const (
+	AnswerModeGenerated  = "generated"  // AIが生成した回答
+	AnswerModeExtractive = "extractive" // AIを使わず、一致した箇所を抜き出した回答
+)
+
+const (
+	// extractiveModel は抽出回答を記録する際のモデル名
+	extractiveModel = "offline/bm25"
+	// extractivePassageLimit は抽出回答に含める箇所の最大数
+	extractivePassageLimit = 5
+	// extractiveExcerptRunes は抽出する箇所の最大文字数
+	extractiveExcerptRunes = 400
+	// passageMaxRunes はドキュメントのセクションをさらに分割する目安の文字数
+	passageMaxRunes = 1200
+
+	// BM25のパラメータ
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// errNoLLM はAIクライアントが利用できないことを表す
+var errNoLLM = errors.New("AI client is not available")
+
+// passage は抽出回答の候補となるドキュメントのセクションまたはフラグメント
+type passage struct {
+	documentID    uint
+	documentTitle string
+	fragmentID    uint
+	heading       string
+	text          string
+}
+
+// documentPassages はドキュメントを見出しごとのセクションに分割し、関連フラグメントとともに候補にする
+func documentPassages(documents []models.Document) []passage {
+	var passages []passage
+	for _, document := range documents {
+		for _, section := range splitSections(document.Content) {
+			passages = append(passages, passage{
+				documentID:    document.ID,
+				documentTitle: document.Title,
+				heading:       section.heading,
+				text:          section.text,
+			})
+		}
+		for _, fragment := range document.Fragments {
+			passages = append(passages, passage{
+				documentID:    document.ID,
+				documentTitle: document.Title,
+				fragmentID:    fragment.ID,
+				text:          fragment.Content,
+			})
+		}
+	}
+	return passages
+}
+
+// fragmentPassages はフラグメントを候補にする
+func fragmentPassages(fragments []models.Fragment) []passage {
+	passages := make([]passage, len(fragments))
+	for i, fragment := range fragments {
+		passages[i] = passage{fragmentID: fragment.ID, text: fragment.Content}
+	}
+	return passages
+}
+
+type section struct {
+	heading string
+	text    string
+}
+
+// splitSections はMarkdownを見出しで区切り、長いセクションは段落単位でさらに分割する
+func splitSections(content string) []section {
+	var sections []section
+	current := section{}
+	var body []string
+
+	flush := func() {
+		for _, chunk := range splitParagraphs(strings.Join(body, "\n"), passageMaxRunes) {
+			sections = append(sections, section{heading: current.heading, text: chunk})
+		}
+		body = body[:0]
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "#") {
+			flush()
+			current.heading = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections
+}
+
+// splitParagraphs は空行区切りの段落を目安の文字数までまとめる
+func splitParagraphs(text string, limit int) []string {
+	var chunks []string
+	var builder strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if builder.Len() > 0 && len([]rune(builder.String()))+len([]rune(paragraph)) > limit {
+			chunks = append(chunks, builder.String())
+			builder.Reset()
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString(paragraph)
+	}
+	if builder.Len() > 0 {
+		chunks = append(chunks, builder.String())
+	}
+	return chunks
+}
+
+type scoredPassage struct {
+	passage
+	score float64
+}
+
+// rankPassages はBM25で質問との関連度を計算し、一致のある箇所をスコア順に返す
+// 特徴量は埋め込みと同じく英数字の単語と日本語の文字bi-gramを使用する
+func rankPassages(question string, passages []passage, limit int) []scoredPassage {
+	queryTerms := make(map[string]bool)
+	for _, feature := range queryFeatures(question) {
+		queryTerms[feature] = true
+	}
+	if len(queryTerms) == 0 || len(passages) == 0 {
+		return nil
+	}
+
+	termFrequencies := make([]map[string]int, len(passages))
+	lengths := make([]int, len(passages))
+	documentFrequency := make(map[string]int)
+	totalLength := 0
+	for i, p := range passages {
+		features := textFeatures(p.heading + "\n" + p.text)
+		frequencies := make(map[string]int)
+		for _, feature := range features {
+			if queryTerms[feature] {
+				frequencies[feature]++
+			}
+		}
+		for term := range frequencies {
+			documentFrequency[term]++
+		}
+		termFrequencies[i] = frequencies
+		lengths[i] = len(features)
+		totalLength += len(features)
+	}
+
+	count := float64(len(passages))
+	averageLength := math.Max(float64(totalLength)/count, 1)
+
+	var ranked []scoredPassage
+	for i, p := range passages {
+		var score float64
+		for term, frequency := range termFrequencies[i] {
+			df := float64(documentFrequency[term])
+			idf := math.Log(1 + (count-df+0.5)/(df+0.5))
+			tf := float64(frequency)
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(lengths[i])/averageLength))
+		}
+		if score > 0 {
+			ranked = append(ranked, scoredPassage{passage: p, score: score})
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// extractiveAnswer はAIを使わずに、質問に一致する箇所を抜き出して回答とする
+func (s *QAService) extractiveAnswer(question string, passages []passage) *QAResponse {
+	response := &QAResponse{
+		Citations:        []Citation{},
+		Confidence:       ConfidenceLow,
+		Mode:             AnswerModeExtractive,
+		WebSources:       []models.WebSource{},
+		WebSearchQueries: []string{},
+	}
+
+	ranked := rankPassages(question, passages, extractivePassageLimit)
+
+	var builder strings.Builder
+	builder.WriteString("**抽出回答（AI未使用）**: AIを利用できないため、質問のキーワードに一致した箇所をそのまま示します。\n\n")
+	if len(ranked) == 0 {
+		builder.WriteString("質問に一致する箇所は見つかりませんでした。別のキーワードで質問してください。")
+		response.Answer = builder.String()
+		response.Sources = []string{"No matching passages"}
+		return response
+	}
+
+	terms := highlightTerms(question)
+	seenSources := make(map[string]bool)
+	for i, hit := range ranked {
+		marker := i + 1
+		excerpt := excerptAround(hit.text, terms, extractiveExcerptRunes)
+
+		citation := Citation{
+			Marker:        marker,
+			DocumentID:    hit.documentID,
+			DocumentTitle: hit.documentTitle,
+			FragmentID:    hit.fragmentID,
+			Quote:         excerpt,
+			Statement:     hit.heading,
+		}
+		var label, source string
+		switch {
+		case hit.documentID != 0 && hit.fragmentID != 0:
+			citation.URL = fmt.Sprintf("/documents/%d#fragment-%d", hit.documentID, hit.fragmentID)
+			label = fmt.Sprintf("%s › Fragment #%d", hit.documentTitle, hit.fragmentID)
+			source = fmt.Sprintf("Document: %s", hit.documentTitle)
+		case hit.documentID != 0:
+			citation.URL = fmt.Sprintf("/documents/%d", hit.documentID)
+			label = hit.documentTitle
+			if hit.heading != "" {
+				label += " › " + hit.heading
+			}
+			source = fmt.Sprintf("Document: %s", hit.documentTitle)
+		default:
+			citation.URL = fmt.Sprintf("/fragments#fragment-%d", hit.fragmentID)
+			label = fmt.Sprintf("Fragment #%d", hit.fragmentID)
+			source = label
+		}
+		response.Citations = append(response.Citations, citation)
+		if !seenSources[source] {
+			seenSources[source] = true
+			response.Sources = append(response.Sources, source)
+		}
+
+		builder.WriteString(fmt.Sprintf("### [%d] %s\n%s\n\n", marker, label, highlightExcerpt(excerpt, terms)))
+	}
+
+	response.Answer = strings.TrimSpace(builder.String())
+	return response
+}
+
+// queryFeatures は質問から照合に使う特徴量を取り出す
+// 日本語の1文字単位の一致は雑音が多いため、bi-gramを作れない場合のみ使用する
+func queryFeatures(question string) []string {
+	var words, bigrams, chars []string
+	for _, feature := range textFeatures(question) {
+		switch {
+		case strings.HasPrefix(feature, "w:"):
+			words = append(words, feature)
+		case strings.HasPrefix(feature, "b:"):
+			bigrams = append(bigrams, feature)
+		case strings.HasPrefix(feature, "c:"):
+			chars = append(chars, feature)
+		}
+	}
+	if len(bigrams) == 0 {
+		return append(words, chars...)
+	}
+	return append(words, bigrams...)
+}
+
+// highlightTerms は質問から強調表示する語を取り出す
+func highlightTerms(question string) []string {
+	features := queryFeatures(question)
+	terms := make([]string, len(features))
+	for i, feature := range features {
+		terms[i] = feature[2:]
+	}
+	return terms
+}
+
+// matchMask はテキスト中で強調表示する語に一致する文字位置を返す（大文字・小文字は区別しない）
+func matchMask(runes []rune, terms []string) []bool {
+	lower := []rune(strings.ToLower(string(runes)))
+	mask := make([]bool, len(runes))
+	if len(lower) != len(runes) {
+		// 小文字化で文字数が変わる場合は強調表示しない
+		return mask
+	}
+
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for start := 0; start+len(termRunes) <= len(lower); start++ {
+			if string(lower[start:start+len(termRunes)]) != term {
+				continue
+			}
+			// 英数字の単語は単語の途中に一致させない
+			if isASCIIWord(termRunes) && !wordBoundary(lower, start, start+len(termRunes)) {
+				continue
+			}
+			for i := start; i < start+len(termRunes); i++ {
+				mask[i] = true
+			}
+		}
+	}
+	return mask
+}
+
+func isASCIIWord(runes []rune) bool {
+	for _, r := range runes {
+		if r >= unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+func wordBoundary(runes []rune, start, end int) bool {
+	isWordRune := func(r rune) bool {
+		return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+	}
+	return (start == 0 || !isWordRune(runes[start-1])) && (end == len(runes) || !isWordRune(runes[end]))
+}
+
+// excerptAround は最初に一致した箇所の周辺を抜き出す（改行は空白にまとめる）
+func excerptAround(text string, terms []string, limit int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+
+	start := 0
+	for i, matched := range matchMask(runes, terms) {
+		if matched {
+			start = i - limit/5
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + limit
+	if end > len(runes) {
+		end = len(runes)
+		start = end - limit
+	}
+
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "..." + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+// highlightExcerpt は一致した語をMarkdownの太字で強調する
+func highlightExcerpt(excerpt string, terms []string) string {
+	runes := []rune(excerpt)
+	mask := matchMask(runes, terms)
+
+	var builder strings.Builder
+	for i, r := range runes {
+		if mask[i] && (i == 0 || !mask[i-1]) {
+			builder.WriteString("**")
+		}
+		builder.WriteRune(r)
+		if mask[i] && (i == len(runes)-1 || !mask[i+1]) {
+			builder.WriteString("**")
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,242 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"insight/src/models"
+	"insight/src/usecase"
+)
+
+const (
+	// defaultFragmentQALimit は回答に使用するフラグメント数の既定値
+	defaultFragmentQALimit = 30
+	// maxFragmentCandidates は関連度順に並べ替える候補フラグメントの上限
+	maxFragmentCandidates = 500
+)
+
+// FragmentQARequest はドキュメント化前のフラグメントを対象とした質問応答リクエスト
+type FragmentQARequest struct {
+	Question       string `json:"question" validate:"required"`
+	UseWebSearch   bool   `json:"use_web_search"`
+	ConversationID uint   `json:"conversation_id"` // 0の場合は新しい会話スレッドを開始
+	UserID         *uint  `json:"-"`               // 質問したユーザー（記録用）
+
+	// 対象範囲（いずれも未指定の場合はすべてのフラグメント）
+	Since *time.Time `json:"since"` // この日時以降に作成されたフラグメント
+	Until *time.Time `json:"until"` // この日時より前に作成されたフラグメント
+	Tags  []string   `json:"tags"`  // いずれかのタグを持つフラグメントに絞り込む
+	Limit int        `json:"limit"` // 回答に使用する最大フラグメント数
+}
+
+// AskFragmentQuestion はフラグメントを対象とした質問に回答する
+// 期間とタグで候補を絞り込み、質問と意味的に近いものをコンテキストとして使用する
+func (s *QAService) AskFragmentQuestion(ctx context.Context, req FragmentQARequest) (*QAResponse, error) {
+	if req.Limit <= 0 {
+		req.Limit = defaultFragmentQALimit
+	}
+
+	fragments, err := s.retrieveFragments(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &QAScope{
+		Type:          models.QAScopeFragments,
+		Tags:          req.Tags,
+		Since:         req.Since,
+		Until:         req.Until,
+		FragmentCount: len(fragments),
+	}
+	scope.Description = describeFragmentScope(scope)
+
+	fmt.Printf("Fragment QA: Using %d fragments (%s)\n", len(fragments), scope.Description)
+
+	// 会話スレッドを準備（続きの場合は履歴を取得）
+	conversation, history, err := s.prepareConversation(req.ConversationID, req.Question, models.QAScopeFragments, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 対象がない場合もAIは呼び出さずに、質問したことを履歴とスレッドに残す
+	if len(fragments) == 0 {
+		response := &QAResponse{
+			Answer:           "指定された範囲にフラグメントが存在しません。",
+			Sources:          []string{"No fragments found in " + scope.Description},
+			Citations:        []Citation{},
+			Confidence:       ConfidenceLow,
+			Mode:             AnswerModeExtractive,
+			WebSearch:        req.UseWebSearch,
+			WebSources:       []models.WebSource{},
+			WebSearchQueries: []string{},
+			Scope:            scope,
+		}
+		s.recordExchange(req.Question, nil, req.UserID, conversation, response)
+		return response, nil
+	}
+
+	// AIに質問（利用できない場合は一致する箇所を抜き出す）
+	var response *QAResponse
+	context := s.buildFragmentContext(fragments, scope)
+	answer, err := s.generateAnswer(ctx, req.Question, context, history, req.UseWebSearch)
+	if err != nil {
+		fmt.Printf("Falling back to extractive answer: %v\n", err)
+		response = s.extractiveAnswer(req.Question, fragmentPassages(fragments))
+	} else {
+		response = s.buildFragmentResponse(answer, fragments, req.UseWebSearch)
+		if len(response.Sources) == 0 {
+			response.Sources = []string{fmt.Sprintf("Fragments: %s (%d total)", scope.Description, len(fragments))}
+		}
+	}
+	response.Scope = scope
+
+	s.recordExchange(req.Question, nil, req.UserID, conversation, response)
+	return response, nil
+}
+
+// retrieveFragments は期間とタグで絞り込んだフラグメントを質問との関連度順に取得する
+// セマンティック検索が利用できない場合は新しい順に使用する
+func (s *QAService) retrieveFragments(ctx context.Context, req FragmentQARequest) ([]models.Fragment, error) {
+	query := s.db.Preload("Tags")
+	if req.Since != nil {
+		query = query.Where("created_at >= ?", *req.Since)
+	}
+	if req.Until != nil {
+		query = query.Where("created_at < ?", *req.Until)
+	}
+	if len(req.Tags) > 0 {
+		tags, err := usecase.NewTagUsecase(s.db).ExpandTagNames(req.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve tags: %w", err)
+		}
+		query = query.Where("id IN (?)", s.db.Table("fragment_tags").
+			Select("fragment_tags.fragment_id").
+			Joins("JOIN tags ON tags.id = fragment_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+
+	var candidates []models.Fragment
+	if err := query.Order("created_at DESC").Limit(maxFragmentCandidates).Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to find fragments: %w", err)
+	}
+
+	if len(candidates) <= req.Limit {
+		return candidates, nil
+	}
+
+	ids := make([]uint, len(candidates))
+	byID := make(map[uint]models.Fragment, len(candidates))
+	for i, fragment := range candidates {
+		ids[i] = fragment.ID
+		byID[fragment.ID] = fragment
+	}
+
+	hits, err := NewSemanticIndex(s.db).Search(ctx, req.Question, SemanticSearchOptions{
+		Limit:      req.Limit,
+		OwnerTypes: []string{SemanticOwnerFragment},
+		OwnerIDs:   ids,
+	})
+	if err != nil || len(hits) == 0 {
+		if err != nil {
+			fmt.Printf("Semantic ranking failed, using newest fragments: %v\n", err)
+		}
+		return candidates[:req.Limit], nil
+	}
+
+	fragments := make([]models.Fragment, 0, len(hits))
+	for _, hit := range hits {
+		fragments = append(fragments, byID[hit.ID])
+	}
+	return fragments, nil
+}
+
+// buildFragmentContext はフラグメントからコンテキストを構築
+func (s *QAService) buildFragmentContext(fragments []models.Fragment, scope *QAScope) string {
+	var builder strings.Builder
+	builder.WriteString("=== Fragment Collection ===\n")
+	builder.WriteString("以下はドキュメント化される前のメモ（フラグメント）です。引用には fragment_id を使用し、document_id は0としてください。\n")
+	builder.WriteString(fmt.Sprintf("Scope: %s\nFragments in scope: %d\n\n", scope.Description, len(fragments)))
+
+	for _, fragment := range fragments {
+		builder.WriteString(fmt.Sprintf("--- Fragment ID %d (Created: %s) ---\n", fragment.ID, fragment.CreatedAt.Format("2006-01-02 15:04")))
+		if len(fragment.Tags) > 0 {
+			names := make([]string, len(fragment.Tags))
+			for i, tag := range fragment.Tags {
+				names[i] = tag.Name
+			}
+			builder.WriteString(fmt.Sprintf("Tags: %s\n", strings.Join(names, ", ")))
+		}
+		builder.WriteString(fragment.Content)
+		builder.WriteString("\n\n")
+	}
+
+	return builder.String()
+}
+
+// buildFragmentResponse はAIの回答をレスポンスに変換し、引用をコンテキスト内のフラグメントに限定する
+func (s *QAService) buildFragmentResponse(answer *generatedAnswer, fragments []models.Fragment, useWebSearch bool) *QAResponse {
+	known := make(map[uint]bool, len(fragments))
+	for _, fragment := range fragments {
+		known[fragment.ID] = true
+	}
+
+	response := &QAResponse{
+		Answer:           answer.Answer,
+		Citations:        []Citation{},
+		Confidence:       normalizeConfidence(answer.Confidence),
+		GeneralKnowledge: answer.GeneralKnowledge,
+		Mode:             AnswerModeGenerated,
+		WebSearch:        useWebSearch,
+		WebSources:       answer.WebSources,
+		WebSearchQueries: answer.WebSearchQueries,
+	}
+
+	seenSources := make(map[uint]bool)
+	for i, raw := range answer.Citations {
+		if !known[raw.FragmentID] {
+			continue
+		}
+
+		marker := raw.Marker
+		if marker <= 0 {
+			marker = i + 1
+		}
+
+		response.Citations = append(response.Citations, Citation{
+			Marker:     marker,
+			FragmentID: raw.FragmentID,
+			Quote:      raw.Quote,
+			Statement:  raw.Statement,
+			URL:        fmt.Sprintf("/fragments#fragment-%d", raw.FragmentID),
+		})
+
+		if !seenSources[raw.FragmentID] {
+			seenSources[raw.FragmentID] = true
+			response.Sources = append(response.Sources, fmt.Sprintf("Fragment #%d", raw.FragmentID))
+		}
+	}
+
+	// 根拠を示せない回答は信頼度を下げる
+	if len(response.Citations) == 0 && response.Confidence == ConfidenceHigh {
+		response.Confidence = ConfidenceMedium
+	}
+
+	return response
+}
+
+// describeFragmentScope はフラグメント対象の範囲を人が読める形式で表す
+func describeFragmentScope(scope *QAScope) string {
+	parts := []string{"fragments"}
+	if scope.Since != nil {
+		parts = append(parts, "since "+scope.Since.Format("2006-01-02"))
+	}
+	if scope.Until != nil {
+		parts = append(parts, "before "+scope.Until.Format("2006-01-02"))
+	}
+	if len(scope.Tags) > 0 {
+		parts = append(parts, "tagged "+strings.Join(scope.Tags, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -2,14 +2,20 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"insight/src/models"
+	"insight/src/usecase"
+	"strings"
 	"time"
 
 	"google.golang.org/genai"
 	"gorm.io/gorm"
 )
 
+// qaModel は質問応答に使用するモデル
+const qaModel = "gemini-2.0-flash-exp"
+
 // QAService はドキュメントに対する質問応答機能を提供するサービス
 type QAService struct {
 	client *genai.Client
@@ -17,11 +23,13 @@ type QAService struct {
 }
 
 // NewQAService は新しいQAServiceを作成
+// AIクライアントを作成できない場合（GEMINI_API_KEY 未設定など）は抽出回答のみで動作する
 func NewQAService(db *gorm.DB) (*QAService, error) {
 	ctx := context.Background()
 	client, err := NewGenaiClient(ctx)
 	if err != nil {
-		return nil, err
+		fmt.Printf("Falling back to extractive answers: %v\n", err)
+		client = nil
 	}
 
 	return &QAService{
@@ -32,22 +40,98 @@ func NewQAService(db *gorm.DB) (*QAService, error) {
 
 // QARequest は質問応答リクエストを表す構造体
 type QARequest struct {
-	DocumentID   uint   `json:"document_id" validate:"required"`
-	Question     string `json:"question" validate:"required"`
-	UseWebSearch bool   `json:"use_web_search"`
+	DocumentID     uint   `json:"document_id" validate:"required"`
+	Question       string `json:"question" validate:"required"`
+	UseWebSearch   bool   `json:"use_web_search"`
+	ConversationID uint   `json:"conversation_id"` // 0の場合は新しい会話スレッドを開始
+	UserID         *uint  `json:"-"`               // 質問したユーザー（記録用）
 }
 
 // GlobalQARequest は全ドキュメント対象の質問応答リクエストを表す構造体
 type GlobalQARequest struct {
-	Question     string `json:"question" validate:"required"`
-	UseWebSearch bool   `json:"use_web_search"`
+	Question       string `json:"question" validate:"required"`
+	UseWebSearch   bool   `json:"use_web_search"`
+	ConversationID uint   `json:"conversation_id"` // 0の場合は新しい会話スレッドを開始
+	UserID         *uint  `json:"-"`               // 質問したユーザー（記録用）
+
+	// 対象範囲（いずれも未指定の場合は最新バージョンの全ドキュメント）
+	Version     *time.Time `json:"version"`      // 指定バージョンのドキュメントを対象
+	Tags        []string   `json:"tags"`         // いずれかのタグを持つドキュメントに絞り込む
+	DocumentIDs []uint     `json:"document_ids"` // 指定した場合はバージョンに関わらずこれらのドキュメントのみ
+}
+
+// QAScope は回答の対象となったドキュメントの範囲
+type QAScope struct {
+	Type          string     `json:"type"` // document / global
+	Version       *time.Time `json:"version,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	DocumentIDs   []uint     `json:"document_ids,omitempty"`
+	Since         *time.Time `json:"since,omitempty"` // フラグメント対象の場合の期間
+	Until         *time.Time `json:"until,omitempty"`
+	DocumentCount int        `json:"document_count"`
+	FragmentCount int        `json:"fragment_count,omitempty"`
+	Description   string     `json:"description"`
 }
 
+// 回答の信頼度
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
 // QAResponse は質問応答レスポンスを表す構造体
 type QAResponse struct {
-	Answer    string   `json:"answer"`
-	Sources   []string `json:"sources"`
-	WebSearch bool     `json:"web_search_used"`
+	Answer           string     `json:"answer"`
+	Sources          []string   `json:"sources"`
+	Citations        []Citation `json:"citations"`
+	Confidence       string     `json:"confidence"`        // high / medium / low
+	GeneralKnowledge bool       `json:"general_knowledge"` // ドキュメント外の一般知識で回答した部分を含むか
+	WebSearch        bool       `json:"web_search_used"`
+	Mode             string     `json:"mode"` // generated / extractive
+
+	// Web検索のグラウンディング情報（内部ドキュメントの引用とは区別する）
+	WebSources       []models.WebSource `json:"web_sources"`
+	WebSearchQueries []string           `json:"web_search_queries"`
+
+	// 回答の対象範囲
+	Scope *QAScope `json:"scope,omitempty"`
+
+	// ツール呼び出しによる質問応答で実行したツールの記録
+	ToolTrace []ToolCall `json:"tool_trace,omitempty"`
+
+	// 保存された質問応答の記録IDと会話スレッドID
+	ExchangeID     uint `json:"exchange_id,omitempty"`
+	ConversationID uint `json:"conversation_id,omitempty"`
+}
+
+// Citation は回答中の記述とその根拠となるノートの引用を結びつける構造体
+type Citation struct {
+	Marker        int    `json:"marker"` // 回答本文中の [n] に対応する番号
+	DocumentID    uint   `json:"document_id,omitempty"`
+	DocumentTitle string `json:"document_title,omitempty"`
+	FragmentID    uint   `json:"fragment_id,omitempty"`
+	Quote         string `json:"quote"`     // 根拠として引用した原文
+	Statement     string `json:"statement"` // 引用が裏付ける回答中の記述
+	URL           string `json:"url"`
+}
+
+// generatedAnswer はAIが構造化出力で返す回答
+type generatedAnswer struct {
+	Answer    string `json:"answer"`
+	Citations []struct {
+		Marker     int    `json:"marker"`
+		DocumentID uint   `json:"document_id"`
+		FragmentID uint   `json:"fragment_id"`
+		Quote      string `json:"quote"`
+		Statement  string `json:"statement"`
+	} `json:"citations"`
+	Confidence       string `json:"confidence"`
+	GeneralKnowledge bool   `json:"general_knowledge"`
+
+	// レスポンスのグラウンディングメタデータから取得（AIの出力JSONには含まれない）
+	WebSources       []models.WebSource `json:"-"`
+	WebSearchQueries []string           `json:"-"`
 }
 
 // AskQuestion はドキュメントに対する質問に回答する
@@ -58,31 +142,133 @@ func (s *QAService) AskQuestion(ctx context.Context, req QARequest) (*QAResponse
 		return nil, fmt.Errorf("failed to find document: %w", err)
 	}
 
+	// 会話スレッドを準備（続きの場合は履歴を取得）
+	conversation, history, err := s.prepareConversation(req.ConversationID, req.Question, models.QAScopeDocument, &document.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// コンテキスト構築
 	context := s.buildContext(&document)
 
 	// AIに質問（Web検索は内部で自動的に処理される）
-	response, err := s.generateAnswer(ctx, req.Question, context, "", req.UseWebSearch)
+	// AIが利用できない場合はドキュメントから一致する箇所を抜き出す
+	var response *QAResponse
+	answer, err := s.generateAnswer(ctx, req.Question, context, history, req.UseWebSearch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		fmt.Printf("Falling back to extractive answer: %v\n", err)
+		response = s.extractiveAnswer(req.Question, documentPassages([]models.Document{document}))
+	} else {
+		response = s.buildResponse(answer, []models.Document{document}, req.UseWebSearch)
+		if len(response.Sources) == 0 {
+			response.Sources = []string{fmt.Sprintf("Document: %s", document.Title)}
+		}
 	}
 
-	// 情報源を構築
-	sources := []string{fmt.Sprintf("Document: %s", document.Title)}
-	if req.UseWebSearch {
-		sources = append(sources, "Web search results (when available)")
+	response.Scope = &QAScope{
+		Type:          models.QAScopeDocument,
+		Version:       &document.VersionCreatedAt,
+		DocumentIDs:   []uint{document.ID},
+		DocumentCount: 1,
+		Description:   fmt.Sprintf("document #%d (%s)", document.ID, document.Title),
 	}
 
-	return &QAResponse{
-		Answer:    response,
-		Sources:   sources,
-		WebSearch: req.UseWebSearch,
-	}, nil
+	s.recordExchange(req.Question, &document.ID, req.UserID, conversation, response)
+	return response, nil
+}
+
+// buildResponse はAIの構造化回答を検証し、引用をドキュメント・フラグメントに紐付ける
+// コンテキストに存在しないIDを指す引用は捏造とみなして除外する
+func (s *QAService) buildResponse(answer *generatedAnswer, documents []models.Document, useWebSearch bool) *QAResponse {
+	documentsByID := make(map[uint]*models.Document, len(documents))
+	fragmentOwners := make(map[uint]*models.Document)
+	documentFragments := make(map[uint]map[uint]bool, len(documents))
+	for i := range documents {
+		documentsByID[documents[i].ID] = &documents[i]
+		documentFragments[documents[i].ID] = make(map[uint]bool, len(documents[i].Fragments))
+		for _, fragment := range documents[i].Fragments {
+			fragmentOwners[fragment.ID] = &documents[i]
+			documentFragments[documents[i].ID][fragment.ID] = true
+		}
+	}
+
+	response := &QAResponse{
+		Answer:           answer.Answer,
+		Citations:        []Citation{},
+		Confidence:       normalizeConfidence(answer.Confidence),
+		GeneralKnowledge: answer.GeneralKnowledge,
+		Mode:             AnswerModeGenerated,
+		WebSearch:        useWebSearch,
+		WebSources:       answer.WebSources,
+		WebSearchQueries: answer.WebSearchQueries,
+	}
+
+	seenSources := make(map[uint]bool)
+	for i, raw := range answer.Citations {
+		document, ok := documentsByID[raw.DocumentID]
+		if raw.FragmentID != 0 {
+			owner, fragmentOK := fragmentOwners[raw.FragmentID]
+			if !fragmentOK {
+				continue
+			}
+			// 引用したドキュメントに含まれないフラグメントは、そのフラグメントを含むドキュメントへリンクする
+			if !ok || !documentFragments[document.ID][raw.FragmentID] {
+				document, ok = owner, true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		marker := raw.Marker
+		if marker <= 0 {
+			marker = i + 1
+		}
+
+		citation := Citation{
+			Marker:        marker,
+			DocumentID:    document.ID,
+			DocumentTitle: document.Title,
+			FragmentID:    raw.FragmentID,
+			Quote:         raw.Quote,
+			Statement:     raw.Statement,
+			URL:           fmt.Sprintf("/documents/%d", document.ID),
+		}
+		if raw.FragmentID != 0 {
+			citation.URL = fmt.Sprintf("/documents/%d#fragment-%d", document.ID, raw.FragmentID)
+		}
+		response.Citations = append(response.Citations, citation)
+
+		if !seenSources[document.ID] {
+			seenSources[document.ID] = true
+			response.Sources = append(response.Sources, fmt.Sprintf("Document: %s", document.Title))
+		}
+	}
+
+	// 根拠を示せない回答は信頼度を下げる
+	if len(response.Citations) == 0 && response.Confidence == ConfidenceHigh {
+		response.Confidence = ConfidenceMedium
+	}
+
+	return response
+}
+
+// normalizeConfidence は信頼度を既知の値に正規化する
+func normalizeConfidence(confidence string) string {
+	switch strings.ToLower(strings.TrimSpace(confidence)) {
+	case ConfidenceHigh:
+		return ConfidenceHigh
+	case ConfidenceMedium:
+		return ConfidenceMedium
+	default:
+		return ConfidenceLow
+	}
 }
 
 // buildContext はドキュメントからコンテキストを構築
 func (s *QAService) buildContext(document *models.Document) string {
 	context := fmt.Sprintf(`=== Document Information ===
+Document ID: %d
 Title: %s
 Summary: %s
 
@@ -90,11 +276,11 @@ Summary: %s
 %s
 
 === Related Fragments ===
-`, document.Title, document.Summary, document.Content)
+`, document.ID, document.Title, document.Summary, document.Content)
 
 	// 関連フラグメントを追加
-	for i, fragment := range document.Fragments {
-		context += fmt.Sprintf("Fragment %d: %s\n", i+1, fragment.Content)
+	for _, fragment := range document.Fragments {
+		context += fmt.Sprintf("Fragment ID %d: %s\n", fragment.ID, fragment.Content)
 	}
 
 	// タグ情報を追加
@@ -116,10 +302,14 @@ func min(a, b int) int {
 	return b
 }
 
-// generateAnswer はAIを使用して回答を生成
-func (s *QAService) generateAnswer(ctx context.Context, question, documentContext, webContext string, useWebSearch bool) (string, error) {
+// generateAnswer はAIを使用して引用付きの回答を生成
+func (s *QAService) generateAnswer(ctx context.Context, question, documentContext, history string, useWebSearch bool) (*generatedAnswer, error) {
+	if s.client == nil {
+		return nil, errNoLLM
+	}
+
 	// プロンプト構築
-	prompt := s.buildAnswerPrompt(question, documentContext, webContext, useWebSearch)
+	prompt := s.buildAnswerPrompt(question, documentContext, history, useWebSearch)
 
 	// デバッグ: プロンプトの最初の500文字を表示
 	fmt.Printf("Generated prompt (first 500 chars): %s...\n", prompt[:min(len(prompt), 500)])
@@ -127,42 +317,189 @@ func (s *QAService) generateAnswer(ctx context.Context, question, documentContex
 	// 生成設定
 	config := &genai.GenerateContentConfig{
 		Temperature:     genai.Ptr(float32(0.3)),
-		MaxOutputTokens: 2000,
+		MaxOutputTokens: 4000,
 	}
 
 	// Web検索を有効にする場合はGoogle Search toolを設定
+	// ツール使用時は構造化出力を指定できないため、プロンプトの指示でJSONを出力させる
 	if useWebSearch {
 		config.Tools = []*genai.Tool{{
 			GoogleSearch: &genai.GoogleSearch{},
 		}}
+	} else {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = answerSchema()
 	}
 
 	// AI生成実行
-	resp, err := s.client.Models.GenerateContent(ctx, "gemini-2.0-flash-exp", genai.Text(prompt), config)
+	resp, err := s.client.Models.GenerateContent(ctx, qaModel, genai.Text(prompt), config)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
 	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response generated")
+		return nil, fmt.Errorf("no response generated")
+	}
+
+	responseText := resp.Text()
+
+	var answer generatedAnswer
+	if err := parseJSONResponse(responseText, &answer); err != nil || answer.Answer == "" {
+		// JSONとして解釈できない場合は本文をそのまま回答として扱う
+		fmt.Printf("Failed to parse structured answer, falling back to plain text: %v\n", err)
+		answer = generatedAnswer{
+			Answer:     strings.TrimSpace(responseText),
+			Confidence: ConfidenceLow,
+		}
+	}
+
+	// Web検索のグラウンディング情報を取得
+	answer.WebSources, answer.WebSearchQueries = extractGrounding(resp.Candidates[0].GroundingMetadata)
+
+	return &answer, nil
+}
+
+// extractGrounding はグラウンディングメタデータから参照URLと検索クエリを取り出す
+func extractGrounding(metadata *genai.GroundingMetadata) ([]models.WebSource, []string) {
+	sources := []models.WebSource{}
+	queries := []string{}
+	if metadata == nil {
+		return sources, queries
+	}
+
+	seen := make(map[string]bool)
+	for _, chunk := range metadata.GroundingChunks {
+		if chunk == nil || chunk.Web == nil || chunk.Web.URI == "" || seen[chunk.Web.URI] {
+			continue
+		}
+		seen[chunk.Web.URI] = true
+
+		title := chunk.Web.Title
+		if title == "" {
+			title = chunk.Web.Domain
+		}
+		sources = append(sources, models.WebSource{
+			Title:  title,
+			URL:    chunk.Web.URI,
+			Domain: chunk.Web.Domain,
+		})
+	}
+
+	queries = append(queries, metadata.WebSearchQueries...)
+	return sources, queries
+}
+
+// recordExchange は質問応答の記録を保存し、会話スレッドに質問と回答を追加する
+// 保存に失敗しても回答自体は返せるため、エラーはログ出力のみとする
+func (s *QAService) recordExchange(question string, documentID, userID *uint, conversation *models.Conversation, response *QAResponse) {
+	modelName := qaModel
+	if response.Mode == AnswerModeExtractive {
+		modelName = extractiveModel
+	}
+
+	exchange := models.QAExchange{
+		Question:         question,
+		Answer:           response.Answer,
+		UserID:           userID,
+		Scope:            response.Scope.Type,
+		DocumentID:       documentID,
+		Version:          response.Scope.Version,
+		ScopeTags:        response.Scope.Tags,
+		ScopeDocumentIDs: response.Scope.DocumentIDs,
+		ScopeSince:       response.Scope.Since,
+		ScopeUntil:       response.Scope.Until,
+		ModelName:        modelName,
+		Sources:          response.Sources,
+		ConversationID:   &conversation.ID,
+		WebSearch:        response.WebSearch,
+		WebSources:       response.WebSources,
+		WebSearchQueries: response.WebSearchQueries,
+	}
+	if err := s.db.Create(&exchange).Error; err != nil {
+		fmt.Printf("Failed to record QA exchange: %v\n", err)
+		return
 	}
+	response.ExchangeID = exchange.ID
+
+	s.appendToConversation(conversation, question, response)
+}
+
+// answerSchema は引用付き回答の構造化出力スキーマ
+func answerSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"answer": {
+				Type:        genai.TypeString,
+				Description: "Markdown形式の回答。根拠のある記述の直後に [1] のような引用番号を付ける",
+			},
+			"citations": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"marker": {
+							Type:        genai.TypeInteger,
+							Description: "回答本文中の引用番号",
+						},
+						"document_id": {
+							Type:        genai.TypeInteger,
+							Description: "根拠となるドキュメントのID",
+						},
+						"fragment_id": {
+							Type:        genai.TypeInteger,
+							Description: "根拠となるフラグメントのID（フラグメントを引用しない場合は0）",
+						},
+						"quote": {
+							Type:        genai.TypeString,
+							Description: "根拠となる原文の引用（原文のまま短く）",
+						},
+						"statement": {
+							Type:        genai.TypeString,
+							Description: "引用が裏付ける回答中の記述",
+						},
+					},
+					Required: []string{"marker", "document_id", "quote", "statement"},
+				},
+			},
+			"confidence": {
+				Type:        genai.TypeString,
+				Enum:        []string{ConfidenceHigh, ConfidenceMedium, ConfidenceLow},
+				Description: "回答がドキュメントにどの程度裏付けられているか",
+			},
+			"general_knowledge": {
+				Type:        genai.TypeBoolean,
+				Description: "ドキュメントに記載のない一般知識で回答した部分を含む場合はtrue",
+			},
+		},
+		Required: []string{"answer", "citations", "confidence", "general_knowledge"},
+	}
+}
 
-	return resp.Candidates[0].Content.Parts[0].Text, nil
+// parseJSONResponse はAIの応答テキストからJSONを取り出してデコードする
+// コードフェンスや前後の説明文が付いていても先頭の{から末尾の}までを解釈する
+func parseJSONResponse(text string, v interface{}) error {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON object found in response")
+	}
+	return json.Unmarshal([]byte(text[start:end+1]), v)
 }
 
 // buildAnswerPrompt は回答生成用のプロンプトを構築
-func (s *QAService) buildAnswerPrompt(question, documentContext, webContext string, useWebSearch bool) string {
+func (s *QAService) buildAnswerPrompt(question, documentContext, history string, useWebSearch bool) string {
 	prompt := fmt.Sprintf(`あなたは技術文書の専門家です。提供されたドキュメントの内容に基づいて、ユーザーの質問に正確で有用な回答を提供してください。
 
 === ドキュメント情報 ===
 %s
-
+%s
 === 質問 ===
 %s
 
 === 回答指針 ===
 - ドキュメントの内容を第一に参考にしてください
-- ドキュメントに記載されていない情報については、一般的な知識で補完しても構いませんが、その旨を明記してください`, documentContext, question)
+- ドキュメントに記載されていない情報については、一般的な知識で補完しても構いませんが、その旨を明記してください`, documentContext, formatHistorySection(history), question)
 
 	// Web検索が有効な場合は追加の指針を含める
 	if useWebSearch {
@@ -175,74 +512,164 @@ func (s *QAService) buildAnswerPrompt(question, documentContext, webContext stri
 	prompt += `
 - 回答は具体的で実用的なものにしてください
 - 必要に応じてコード例や手順を含めてください
-- 日本語で回答してください`
+- 日本語で回答してください
 
-	return prompt
-}
+=== 引用のルール ===
+- ドキュメントやフラグメントに基づく記述の直後に [1] のような引用番号を付けてください
+- citationsには各引用番号について、根拠となる document_id・fragment_id（フラグメントを引用する場合のみ）・原文の短い引用（quote）・裏付ける記述（statement）を含めてください
+- IDはコンテキストに記載されたものだけを使用し、存在しないIDを作らないでください
+- ドキュメントに記載のない一般知識で補完した場合は general_knowledge を true にしてください
+- confidence はドキュメントによる裏付けの度合いを high / medium / low で示してください`
 
-// AskGlobalQuestion は最新バージョンのドキュメントを対象とした質問に回答する
-func (s *QAService) AskGlobalQuestion(ctx context.Context, req GlobalQARequest) (*QAResponse, error) {
-	// 最新バージョンを取得
-	var latestVersion time.Time
-	if err := s.db.Model(&models.Document{}).Select("version_created_at").Order("version_created_at DESC").Limit(1).Scan(&latestVersion).Error; err != nil {
-		return nil, fmt.Errorf("failed to get latest version: %w", err)
-	}
+	if useWebSearch {
+		prompt += `
 
-	if latestVersion.IsZero() {
-		return &QAResponse{
-			Answer:    "現在、ドキュメントが存在しません。",
-			Sources:   []string{"No documents found"},
-			WebSearch: req.UseWebSearch,
-		}, nil
+=== 出力形式 ===
+以下のキーを持つJSONオブジェクトのみを出力してください：
+{"answer": "...", "citations": [{"marker": 1, "document_id": 0, "fragment_id": 0, "quote": "...", "statement": "..."}], "confidence": "high|medium|low", "general_knowledge": false}`
 	}
 
-	// 最新バージョンのドキュメントのみを取得
-	var documents []models.Document
-	if err := s.db.Preload("Fragments").Preload("Tags").Where("version_created_at = ?", latestVersion).Find(&documents).Error; err != nil {
-		return nil, fmt.Errorf("failed to find documents: %w", err)
+	return prompt
+}
+
+// AskGlobalQuestion は複数ドキュメントを対象とした質問に回答する
+// 範囲の指定がない場合は最新バージョンの全ドキュメントを対象とする
+func (s *QAService) AskGlobalQuestion(ctx context.Context, req GlobalQARequest) (*QAResponse, error) {
+	documents, scope, err := s.resolveGlobalScope(req)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Global QA: Found %d documents in latest version (%s)\n", len(documents), latestVersion.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Global QA: Found %d documents (%s)\n", len(documents), scope.Description)
 	for i, doc := range documents {
 		fmt.Printf("Document %d: ID=%d, Title=%s, Fragments=%d, Tags=%d\n",
 			i+1, doc.ID, doc.Title, len(doc.Fragments), len(doc.Tags))
 	}
 
+	// 会話スレッドを準備（続きの場合は履歴を取得）
+	conversation, history, err := s.prepareConversation(req.ConversationID, req.Question, models.QAScopeGlobal, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 対象がない場合もAIは呼び出さずに、質問したことを履歴とスレッドに残す
 	if len(documents) == 0 {
-		return &QAResponse{
-			Answer:    "現在、最新バージョンにドキュメントが存在しません。",
-			Sources:   []string{"No documents found in latest version"},
-			WebSearch: req.UseWebSearch,
-		}, nil
+		response := &QAResponse{
+			Answer:           "指定された範囲にドキュメントが存在しません。",
+			Sources:          []string{"No documents found in " + scope.Description},
+			Citations:        []Citation{},
+			Confidence:       ConfidenceLow,
+			Mode:             AnswerModeExtractive,
+			WebSearch:        req.UseWebSearch,
+			WebSources:       []models.WebSource{},
+			WebSearchQueries: []string{},
+			Scope:            scope,
+		}
+		s.recordExchange(req.Question, nil, req.UserID, conversation, response)
+		return response, nil
 	}
 
-	// 全ドキュメントのコンテキストを構築
-	context := s.buildGlobalContext(documents)
+	// 対象ドキュメントのコンテキストを構築
+	context := s.buildGlobalContext(documents, scope)
 	fmt.Printf("Global context length: %d characters\n", len(context))
 
-	// AIに質問
-	response, err := s.generateAnswer(ctx, req.Question, context, "", req.UseWebSearch)
+	// AIに質問（利用できない場合は一致する箇所を抜き出す）
+	var response *QAResponse
+	answer, err := s.generateAnswer(ctx, req.Question, context, history, req.UseWebSearch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate answer: %w", err)
+		fmt.Printf("Falling back to extractive answer: %v\n", err)
+		response = s.extractiveAnswer(req.Question, documentPassages(documents))
+	} else {
+		response = s.buildResponse(answer, documents, req.UseWebSearch)
+		if len(response.Sources) == 0 {
+			response.Sources = []string{fmt.Sprintf("%s (%d total)", scope.Description, len(documents))}
+		}
 	}
+	response.Scope = scope
+
+	s.recordExchange(req.Question, nil, req.UserID, conversation, response)
+	return response, nil
+}
 
-	// 情報源を構築
-	sources := []string{fmt.Sprintf("Latest version documents (%d total)", len(documents))}
-	if req.UseWebSearch {
-		sources = append(sources, "Web search results (when available)")
+// resolveGlobalScope はリクエストの範囲指定に従って対象ドキュメントを取得する
+// ドキュメントIDが指定された場合はバージョンに関わらずそれらを対象とし、
+// それ以外は指定バージョン（未指定なら最新バージョン）のドキュメントを対象とする
+func (s *QAService) resolveGlobalScope(req GlobalQARequest) ([]models.Document, *QAScope, error) {
+	scope := &QAScope{
+		Type:        models.QAScopeGlobal,
+		Tags:        req.Tags,
+		DocumentIDs: req.DocumentIDs,
 	}
 
-	return &QAResponse{
-		Answer:    response,
-		Sources:   sources,
-		WebSearch: req.UseWebSearch,
-	}, nil
+	query := s.db.Preload("Fragments").Preload("Tags")
+	latest := false
+	if len(req.DocumentIDs) > 0 {
+		query = query.Where("id IN ?", req.DocumentIDs)
+	} else {
+		version := req.Version
+		if version == nil {
+			latestVersion, err := usecase.NewDocumentUsecase(s.db).GetLatestVersion()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get latest version: %w", err)
+			}
+			if latestVersion.IsZero() {
+				scope.Description = "all documents"
+				return nil, scope, nil
+			}
+			version = &latestVersion
+			latest = true
+		}
+		scope.Version = version
+		query = query.Where("version_created_at = ?", *version)
+	}
+
+	if len(req.Tags) > 0 {
+		// 親タグを指定した場合は子孫のタグが付いたものも含める
+		tags, err := usecase.NewTagUsecase(s.db).ExpandTagNames(req.Tags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve tags: %w", err)
+		}
+		query = query.Where("id IN (?)", s.db.Table("document_tags").
+			Select("document_tags.document_id").
+			Joins("JOIN tags ON tags.id = document_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+
+	var documents []models.Document
+	if err := query.Order("created_at ASC").Find(&documents).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	scope.DocumentCount = len(documents)
+	scope.Description = describeScope(scope, latest)
+	return documents, scope, nil
+}
+
+// describeScope は回答の対象範囲を人が読める形式で表す
+func describeScope(scope *QAScope, latest bool) string {
+	var parts []string
+	switch {
+	case len(scope.DocumentIDs) > 0:
+		ids := make([]string, len(scope.DocumentIDs))
+		for i, id := range scope.DocumentIDs {
+			ids[i] = fmt.Sprintf("#%d", id)
+		}
+		parts = append(parts, "documents "+strings.Join(ids, ", "))
+	case latest:
+		parts = append(parts, fmt.Sprintf("latest version (%s)", scope.Version.Format("2006-01-02 15:04:05")))
+	case scope.Version != nil:
+		parts = append(parts, fmt.Sprintf("version %s", scope.Version.Format("2006-01-02 15:04:05")))
+	}
+	if len(scope.Tags) > 0 {
+		parts = append(parts, "tagged "+strings.Join(scope.Tags, ", "))
+	}
+	return strings.Join(parts, ", ")
 }
 
-// buildGlobalContext は最新バージョンのドキュメントからコンテキストを構築
-func (s *QAService) buildGlobalContext(documents []models.Document) string {
-	context := fmt.Sprintf("=== Latest Version Document Collection ===\nDocuments in latest version: %d\n\n", len(documents))
-	fmt.Printf("Building global context for %d latest version documents\n", len(documents))
+// buildGlobalContext は対象範囲のドキュメントからコンテキストを構築
+func (s *QAService) buildGlobalContext(documents []models.Document, scope *QAScope) string {
+	context := fmt.Sprintf("=== Document Collection ===\nScope: %s\nDocuments in scope: %d\n\n", scope.Description, len(documents))
+	fmt.Printf("Building global context for %d documents\n", len(documents))
 
 	// 各ドキュメントの情報を追加（最大10ドキュメントまで詳細表示）
 	maxDocs := 10
@@ -252,7 +679,7 @@ func (s *QAService) buildGlobalContext(documents []models.Document) string {
 			break
 		}
 
-		context += fmt.Sprintf("=== Document %d: %s ===\n", i+1, document.Title)
+		context += fmt.Sprintf("=== Document ID %d: %s ===\n", document.ID, document.Title)
 		context += fmt.Sprintf("Summary: %s\n", document.Summary)
 
 		// タグ情報を追加
@@ -0,0 +1,315 @@
+package ai
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+const (
+	// toolSearchLimit は検索ツールが返す件数の既定値
+	toolSearchLimit = 5
+	// toolDocumentRunes はread_documentが返す本文の最大文字数
+	toolDocumentRunes = 8000
+)
+
+// qaToolDeclarations は質問応答中にモデルが呼び出せるツールの定義
+func qaToolDeclarations() []*genai.FunctionDeclaration {
+	return []*genai.FunctionDeclaration{
+		{
+			Name:        "search_documents",
+			Description: "ドキュメントをキーワードで全文検索し、関連度順にID・タイトル・要約・抜粋を返す",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"query":   {Type: genai.TypeString, Description: "検索キーワード（スペース区切りで複数指定可）"},
+					"tags":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}, Description: "いずれかのタグを持つドキュメントに絞り込む"},
+					"version": {Type: genai.TypeString, Description: "list_versionsで取得したバージョン（省略時はすべてのバージョン）"},
+					"limit":   {Type: genai.TypeInteger, Description: "最大件数（既定5）"},
+				},
+				Required: []string{"query"},
+			},
+		},
+		{
+			Name:        "read_document",
+			Description: "IDを指定してドキュメントの本文・タグ・元になったフラグメントを読む",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"id": {Type: genai.TypeInteger, Description: "ドキュメントID"},
+				},
+				Required: []string{"id"},
+			},
+		},
+		{
+			Name:        "list_tags",
+			Description: "すべてのタグとドキュメント・フラグメントでの利用件数を返す",
+			Parameters:  &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}},
+		},
+		{
+			Name:        "search_fragments",
+			Description: "ドキュメント化される前のメモ（フラグメント）をキーワードで検索し、本文を返す",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"query": {Type: genai.TypeString, Description: "検索キーワード"},
+					"tags":  {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}, Description: "いずれかのタグを持つフラグメントに絞り込む"},
+					"since": {Type: genai.TypeString, Description: "この日付以降に作成されたもの（YYYY-MM-DD）"},
+					"until": {Type: genai.TypeString, Description: "この日付以前に作成されたもの（YYYY-MM-DD）"},
+					"limit": {Type: genai.TypeInteger, Description: "最大件数（既定5）"},
+				},
+				Required: []string{"query"},
+			},
+		},
+		{
+			Name:        "list_versions",
+			Description: "ドキュメントのバージョン（生成日時）を新しい順に返す",
+			Parameters:  &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}},
+		},
+	}
+}
+
+// qaToolExecutor はツール呼び出しを実行し、引用の検証に使うため参照したエンティティを記録する
+type qaToolExecutor struct {
+	documentUsecase *usecase.DocumentUsecase
+	fragmentUsecase *usecase.FragmentUsecase
+	searchUsecase   *usecase.SearchUsecase
+	tagUsecase      *usecase.TagUsecase
+
+	documentTitles  map[uint]string // 検索結果や本文で参照したドキュメント
+	fragmentOwners  map[uint]uint   // read_documentで参照したフラグメントと所属ドキュメント
+	fragmentsViewed map[uint]bool   // search_fragmentsで参照したフラグメント
+}
+
+func newQAToolExecutor(db *gorm.DB) *qaToolExecutor {
+	return &qaToolExecutor{
+		documentUsecase: usecase.NewDocumentUsecase(db),
+		fragmentUsecase: usecase.NewFragmentUsecase(db),
+		searchUsecase:   usecase.NewSearchUsecase(db),
+		tagUsecase:      usecase.NewTagUsecase(db),
+		documentTitles:  make(map[uint]string),
+		fragmentOwners:  make(map[uint]uint),
+		fragmentsViewed: make(map[uint]bool),
+	}
+}
+
+// execute はツールを実行し、モデルに返す結果とトレース用の要約を返す
+func (e *qaToolExecutor) execute(name string, args map[string]any) (map[string]any, string, error) {
+	switch name {
+	case "search_documents":
+		return e.searchDocuments(args)
+	case "read_document":
+		return e.readDocument(args)
+	case "list_tags":
+		return e.listTags()
+	case "search_fragments":
+		return e.searchFragments(args)
+	case "list_versions":
+		return e.listVersions()
+	}
+	return nil, "", fmt.Errorf("unknown tool: %s", name)
+}
+
+func (e *qaToolExecutor) searchDocuments(args map[string]any) (map[string]any, string, error) {
+	input := usecase.SearchDocumentsInput{
+		Query:   argString(args, "query"),
+		Tags:    argStrings(args, "tags"),
+		PerPage: argInt(args, "limit", toolSearchLimit),
+	}
+	if value := argString(args, "version"); value != "" {
+		version, err := usecase.ParseVersion(value)
+		if err != nil {
+			return nil, "", err
+		}
+		input.Version = &version
+	}
+
+	result, err := e.searchUsecase.SearchDocuments(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hits := make([]map[string]any, len(result.Hits))
+	titles := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		e.documentTitles[hit.ID] = hit.Title
+		hits[i] = map[string]any{
+			"id":      hit.ID,
+			"title":   hit.Title,
+			"summary": hit.Summary,
+			"snippet": stripHighlight(hit.Snippet),
+			"tags":    hit.Tags,
+			"version": hit.VersionCreatedAt.Format("2006-01-02 15:04:05.999999-07:00"),
+		}
+		titles[i] = fmt.Sprintf("#%d %s", hit.ID, hit.Title)
+	}
+
+	summary := fmt.Sprintf("%d documents", len(hits))
+	if len(titles) > 0 {
+		summary += ": " + strings.Join(titles, ", ")
+	}
+	return map[string]any{"results": hits, "total": result.Total}, summary, nil
+}
+
+func (e *qaToolExecutor) readDocument(args map[string]any) (map[string]any, string, error) {
+	id := argInt(args, "id", 0)
+	if id <= 0 {
+		return nil, "", fmt.Errorf("id is required")
+	}
+
+	document, err := e.documentUsecase.GetDocument(uint(id))
+	if err != nil {
+		return nil, "", fmt.Errorf("document %d not found", id)
+	}
+
+	e.documentTitles[document.ID] = document.Title
+	fragments := make([]map[string]any, len(document.Fragments))
+	for i, fragment := range document.Fragments {
+		e.fragmentOwners[fragment.ID] = document.ID
+		fragments[i] = map[string]any{"id": fragment.ID, "content": fragment.Content}
+	}
+
+	content := document.Content
+	if runes := []rune(content); len(runes) > toolDocumentRunes {
+		content = string(runes[:toolDocumentRunes]) + "..."
+	}
+
+	return map[string]any{
+		"id":        document.ID,
+		"title":     document.Title,
+		"summary":   document.Summary,
+		"content":   content,
+		"tags":      tagNameList(document.Tags),
+		"version":   document.VersionCreatedAt.Format("2006-01-02 15:04:05.999999-07:00"),
+		"fragments": fragments,
+	}, fmt.Sprintf("#%d %s (%d fragments)", document.ID, document.Title, len(document.Fragments)), nil
+}
+
+func (e *qaToolExecutor) listTags() (map[string]any, string, error) {
+	summaries, err := e.tagUsecase.GetTagSummaries()
+	if err != nil {
+		return nil, "", err
+	}
+
+	tags := make([]map[string]any, len(summaries))
+	for i, summary := range summaries {
+		tags[i] = map[string]any{
+			"name":           summary.Name,
+			"document_count": summary.DocumentCount,
+			"fragment_count": summary.FragmentCount,
+		}
+	}
+	return map[string]any{"tags": tags}, fmt.Sprintf("%d tags", len(tags)), nil
+}
+
+func (e *qaToolExecutor) searchFragments(args map[string]any) (map[string]any, string, error) {
+	input := usecase.SearchFragmentsInput{
+		Query:   argString(args, "query"),
+		Tags:    argStrings(args, "tags"),
+		PerPage: argInt(args, "limit", toolSearchLimit),
+	}
+	if value := argString(args, "since"); value != "" {
+		since, err := usecase.ParseDate(value)
+		if err != nil {
+			return nil, "", err
+		}
+		input.Since = &since
+	}
+	if value := argString(args, "until"); value != "" {
+		until, err := usecase.ParseDateUntil(value)
+		if err != nil {
+			return nil, "", err
+		}
+		input.Until = &until
+	}
+
+	result, err := e.searchUsecase.SearchFragments(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 検索結果は抜粋のため、フラグメントは本文全体を返す
+	hits := make([]map[string]any, 0, len(result.Hits))
+	ids := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		fragment, err := e.fragmentUsecase.GetFragment(hit.ID)
+		if err != nil {
+			continue
+		}
+		e.fragmentsViewed[fragment.ID] = true
+		hits = append(hits, map[string]any{
+			"id":         fragment.ID,
+			"content":    fragment.Content,
+			"tags":       hit.Tags,
+			"created_at": fragment.CreatedAt.Format(time.RFC3339),
+		})
+		ids = append(ids, fmt.Sprintf("#%d", fragment.ID))
+	}
+
+	summary := fmt.Sprintf("%d fragments", len(hits))
+	if len(ids) > 0 {
+		summary += ": " + strings.Join(ids, ", ")
+	}
+	return map[string]any{"results": hits, "total": result.Total}, summary, nil
+}
+
+func (e *qaToolExecutor) listVersions() (map[string]any, string, error) {
+	versions, err := e.documentUsecase.GetDistinctVersions()
+	if err != nil {
+		return nil, "", err
+	}
+
+	values := make([]string, len(versions))
+	for i, version := range versions {
+		values[i] = version.Format("2006-01-02 15:04:05.999999-07:00")
+	}
+	return map[string]any{"versions": values}, fmt.Sprintf("%d versions", len(values)), nil
+}
+
+// stripHighlight は検索スニペットのハイライト用HTMLを取り除く
+func stripHighlight(snippet string) string {
+	snippet = strings.NewReplacer("<mark>", "", "</mark>", "").Replace(snippet)
+	return html.UnescapeString(snippet)
+}
+
+func tagNameList(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+func argString(args map[string]any, key string) string {
+	value, _ := args[key].(string)
+	return strings.TrimSpace(value)
+}
+
+// argInt はJSONの数値（float64）を整数として取得する
+func argInt(args map[string]any, key string, fallback int) int {
+	switch value := args[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+	return fallback
+}
+
+func argStrings(args map[string]any, key string) []string {
+	values, _ := args[key].([]any)
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok && strings.TrimSpace(s) != "" {
+			result = append(result, strings.TrimSpace(s))
+		}
+	}
+	return result
+}
@@ -0,0 +1,417 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// SemanticOwnerFragment はFragment由来の埋め込みを表す
+	SemanticOwnerFragment = "fragment"
+	// SemanticOwnerDocument はDocument由来の埋め込みを表す
+	SemanticOwnerDocument = "document"
+
+	// maxChunkRunes は1チャンクあたりの最大文字数
+	maxChunkRunes = 800
+	// embedBatchChunks は1回の埋め込み呼び出しにまとめるチャンク数の目安
+	embedBatchChunks = 100
+)
+
+// SemanticIndex はFragmentとDocumentのベクトルインデックスを管理するサービス
+type SemanticIndex struct {
+	embedder Embedder
+	db       *gorm.DB
+}
+
+// NewSemanticIndex は新しいSemanticIndexを作成
+func NewSemanticIndex(db *gorm.DB) *SemanticIndex {
+	return &SemanticIndex{
+		embedder: NewEmbedder(context.Background()),
+		db:       db,
+	}
+}
+
+// SemanticSearchOptions はセマンティック検索のオプション
+type SemanticSearchOptions struct {
+	Limit      int      `json:"limit"`
+	OwnerTypes []string `json:"owner_types"` // 空の場合はすべて対象
+	OwnerIDs   []uint   `json:"owner_ids"`   // 空の場合はすべて対象
+}
+
+// SemanticHit はセマンティック検索のヒットを表す構造体
+type SemanticHit struct {
+	Type    string  `json:"type"`
+	ID      uint    `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+// indexSource はインデックス対象の1エンティティ
+type indexSource struct {
+	ownerType string
+	ownerID   uint
+	content   string
+	chunks    []string
+}
+
+// Refresh は内容が変わったエンティティのベクトルを再計算し、削除済みのものを取り除く
+// 埋め込みAPIを呼び出すため、検索のたびではなく書き込み後やCLIから呼び出す
+func (i *SemanticIndex) Refresh(ctx context.Context) error {
+	sources, err := i.collectSources()
+	if err != nil {
+		return err
+	}
+
+	// 既存の埋め込みのハッシュを取得（現在のモデルのもののみ最新とみなす）
+	type ownerHash struct {
+		OwnerType   string
+		OwnerID     uint
+		ContentHash string
+		ModelName   string `gorm:"column:model"`
+	}
+	var existing []ownerHash
+	if err := i.db.Model(&models.Embedding{}).
+		Select("DISTINCT owner_type, owner_id, content_hash, model").
+		Scan(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load embeddings: %w", err)
+	}
+
+	indexed := make(map[string]bool, len(existing))
+	currentHashes := make(map[string]string, len(existing))
+	for _, e := range existing {
+		key := ownerKey(e.OwnerType, e.OwnerID)
+		indexed[key] = true
+		if e.ModelName == i.embedder.Name() {
+			currentHashes[key] = e.ContentHash
+		}
+	}
+
+	// 変更されたエンティティを抽出（本文が空のものは索引しない）
+	var stale []indexSource
+	alive := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		if len(source.chunks) == 0 {
+			continue
+		}
+		key := ownerKey(source.ownerType, source.ownerID)
+		alive[key] = true
+		if currentHashes[key] != contentHash(source.content) {
+			stale = append(stale, source)
+		}
+	}
+
+	// 削除されたエンティティや空になったエンティティの埋め込みを、モデルを問わず除去
+	for key := range indexed {
+		if alive[key] {
+			continue
+		}
+		ownerType, ownerID := parseOwnerKey(key)
+		if err := i.db.Unscoped().Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Delete(&models.Embedding{}).Error; err != nil {
+			return fmt.Errorf("failed to delete embeddings: %w", err)
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Embedding %d changed items with %s...\n", len(stale), i.embedder.Name())
+
+	// 複数エンティティのチャンクをまとめて埋め込み、バッチごとに保存する
+	for start := 0; start < len(stale); {
+		end := start
+		var chunks []string
+		for end < len(stale) && (len(chunks) == 0 || len(chunks)+len(stale[end].chunks) <= embedBatchChunks) {
+			chunks = append(chunks, stale[end].chunks...)
+			end++
+		}
+
+		vectors, err := i.embedder.Embed(ctx, chunks)
+		if err != nil {
+			return err
+		}
+		if len(vectors) != len(chunks) {
+			return fmt.Errorf("unexpected embedding count: got %d, want %d", len(vectors), len(chunks))
+		}
+
+		for _, source := range stale[start:end] {
+			if err := i.storeEmbeddings(source, vectors[:len(source.chunks)]); err != nil {
+				return fmt.Errorf("failed to store embeddings: %w", err)
+			}
+			vectors = vectors[len(source.chunks):]
+		}
+		start = end
+	}
+
+	return nil
+}
+
+// storeEmbeddings はエンティティの埋め込みを置き換える
+func (i *SemanticIndex) storeEmbeddings(source indexSource, vectors [][]float32) error {
+	hash := contentHash(source.content)
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		// 古いチャンクは他モデルのものも含めて置き換える
+		if err := tx.Unscoped().Where("owner_type = ? AND owner_id = ?", source.ownerType, source.ownerID).Delete(&models.Embedding{}).Error; err != nil {
+			return err
+		}
+
+		for idx, chunk := range source.chunks {
+			embedding := models.Embedding{
+				OwnerType:   source.ownerType,
+				OwnerID:     source.ownerID,
+				ChunkIndex:  idx,
+				Chunk:       chunk,
+				ContentHash: hash,
+				ModelName:   i.embedder.Name(),
+				Dimensions:  len(vectors[idx]),
+				Vector:      encodeVector(vectors[idx]),
+			}
+			if err := tx.Create(&embedding).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Search はクエリと意味的に近いFragmentやDocumentをスコア順に返す
+func (i *SemanticIndex) Search(ctx context.Context, query string, opts SemanticSearchOptions) ([]SemanticHit, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+
+	// インデックスの更新は書き込み側で行い、ここではクエリだけを埋め込む
+	vectors, err := i.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+
+	dbQuery := i.db.Where("model = ?", i.embedder.Name())
+	if len(opts.OwnerTypes) > 0 {
+		dbQuery = dbQuery.Where("owner_type IN ?", opts.OwnerTypes)
+	}
+	if len(opts.OwnerIDs) > 0 {
+		dbQuery = dbQuery.Where("owner_id IN ?", opts.OwnerIDs)
+	}
+
+	var embeddings []models.Embedding
+	if err := dbQuery.Find(&embeddings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load embeddings: %w", err)
+	}
+
+	// エンティティごとに最もスコアの高いチャンクを採用
+	best := make(map[string]SemanticHit)
+	for _, embedding := range embeddings {
+		score := cosineSimilarity(queryVector, decodeVector(embedding.Vector))
+		if score <= 0 {
+			continue
+		}
+		key := ownerKey(embedding.OwnerType, embedding.OwnerID)
+		if hit, ok := best[key]; ok && hit.Score >= score {
+			continue
+		}
+		best[key] = SemanticHit{
+			Type:    embedding.OwnerType,
+			ID:      embedding.OwnerID,
+			Snippet: embedding.Chunk,
+			Score:   score,
+		}
+	}
+
+	hits := make([]SemanticHit, 0, len(best))
+	for _, hit := range best {
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		return hits[a].ID < hits[b].ID
+	})
+
+	// インデックスの更新前に削除されたものは除き、表示用タイトルを設定する
+	hits, err = i.resolveHits(hits)
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+	return hits, nil
+}
+
+// collectSources はインデックス対象となる全エンティティを取得する
+func (i *SemanticIndex) collectSources() ([]indexSource, error) {
+	var fragments []models.Fragment
+	if err := i.db.Find(&fragments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get fragments: %w", err)
+	}
+
+	var documents []models.Document
+	if err := i.db.Find(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	sources := make([]indexSource, 0, len(fragments)+len(documents))
+	for _, fragment := range fragments {
+		sources = append(sources, indexSource{
+			ownerType: SemanticOwnerFragment,
+			ownerID:   fragment.ID,
+			content:   fragment.Content,
+			chunks:    splitIntoChunks(fragment.Content),
+		})
+	}
+	for _, document := range documents {
+		content := document.Title + "\n" + document.Summary + "\n\n" + document.Content
+		sources = append(sources, indexSource{
+			ownerType: SemanticOwnerDocument,
+			ownerID:   document.ID,
+			content:   content,
+			chunks:    splitIntoChunks(content),
+		})
+	}
+
+	return sources, nil
+}
+
+// resolveHits は存在するFragmentとDocumentのヒットだけを残し、表示用タイトルを設定する
+func (i *SemanticIndex) resolveHits(hits []SemanticHit) ([]SemanticHit, error) {
+	var documentIDs, fragmentIDs []uint
+	for _, hit := range hits {
+		switch hit.Type {
+		case SemanticOwnerDocument:
+			documentIDs = append(documentIDs, hit.ID)
+		case SemanticOwnerFragment:
+			fragmentIDs = append(fragmentIDs, hit.ID)
+		}
+	}
+
+	titles := make(map[uint]string)
+	if len(documentIDs) > 0 {
+		var documents []models.Document
+		if err := i.db.Select("id", "title").Where("id IN ?", documentIDs).Find(&documents).Error; err != nil {
+			return nil, fmt.Errorf("failed to get documents: %w", err)
+		}
+		for _, document := range documents {
+			titles[document.ID] = document.Title
+		}
+	}
+
+	liveFragments := make(map[uint]bool)
+	if len(fragmentIDs) > 0 {
+		var ids []uint
+		if err := i.db.Model(&models.Fragment{}).Where("id IN ?", fragmentIDs).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to get fragments: %w", err)
+		}
+		for _, id := range ids {
+			liveFragments[id] = true
+		}
+	}
+
+	resolved := make([]SemanticHit, 0, len(hits))
+	for _, hit := range hits {
+		switch hit.Type {
+		case SemanticOwnerDocument:
+			title, ok := titles[hit.ID]
+			if !ok {
+				continue
+			}
+			hit.Title = title
+		case SemanticOwnerFragment:
+			if !liveFragments[hit.ID] {
+				continue
+			}
+			hit.Title = fmt.Sprintf("Fragment #%d", hit.ID)
+		default:
+			continue
+		}
+		resolved = append(resolved, hit)
+	}
+	return resolved, nil
+}
+
+// splitIntoChunks はMarkdownテキストを見出しと文字数でチャンクに分割する
+func splitIntoChunks(text string) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// 見出しの手前で区切る
+		if strings.HasPrefix(line, "#") && current.Len() > 0 {
+			flush()
+		}
+
+		// 長すぎる行は文字数で分割
+		runes := []rune(line)
+		for len(runes) > maxChunkRunes {
+			flush()
+			if chunk := strings.TrimSpace(string(runes[:maxChunkRunes])); chunk != "" {
+				chunks = append(chunks, chunk)
+			}
+			runes = runes[maxChunkRunes:]
+		}
+
+		if len([]rune(current.String()))+len(runes) > maxChunkRunes {
+			flush()
+		}
+		current.WriteString(string(runes))
+		current.WriteString("\n")
+	}
+	flush()
+
+	return chunks
+}
+
+// contentHash はコンテンツの変更検知用ハッシュを返す
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func ownerKey(ownerType string, ownerID uint) string {
+	return fmt.Sprintf("%s:%d", ownerType, ownerID)
+}
+
+func parseOwnerKey(key string) (string, uint) {
+	var ownerID uint
+	ownerType, idStr, _ := strings.Cut(key, ":")
+	fmt.Sscanf(idStr, "%d", &ownerID)
+	return ownerType, ownerID
+}
+
+// encodeVector はfloat32スライスをバイト列に変換する
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector はバイト列をfloat32スライスに戻す
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector
+}
@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"insight/src/models"
+	"insight/src/usecase"
+
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+const (
+	// suggestionModel は質問候補の生成に使用するモデル
+	suggestionModel = "gemini-2.5-flash"
+	// minSuggestedQuestions と maxSuggestedQuestions は保存する質問候補の件数
+	minSuggestedQuestions = 3
+	maxSuggestedQuestions = 5
+)
+
+// QuestionSuggester はドキュメントの読者向けに質問の候補を生成するサービス
+type QuestionSuggester struct {
+	client *genai.Client
+	db     *gorm.DB
+}
+
+// NewQuestionSuggester は新しいQuestionSuggesterを作成
+func NewQuestionSuggester(db *gorm.DB) (*QuestionSuggester, error) {
+	client, err := NewGenaiClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuestionSuggester{
+		client: client,
+		db:     db,
+	}, nil
+}
+
+// SuggestedQuestionsFor は現在の本文から生成された質問候補を返す
+// 本文が変わって再生成されていない場合は古い候補を表示しないよう空を返す
+func SuggestedQuestionsFor(document *models.Document) []string {
+	if document.SuggestedQuestionsHash != contentHash(document.Content) {
+		return nil
+	}
+	return document.SuggestedQuestions
+}
+
+// Refresh は本文が変わった（または候補がない）ドキュメントの質問候補を生成する
+func (q *QuestionSuggester) Refresh(ctx context.Context, documents []models.Document) error {
+	documentUsecase := usecase.NewDocumentUsecase(q.db)
+
+	var failed int
+	for _, document := range documents {
+		hash := contentHash(document.Content)
+		if document.SuggestedQuestionsHash == hash {
+			continue
+		}
+
+		questions, err := q.generate(ctx, &document)
+		if err != nil {
+			fmt.Printf("Failed to generate suggested questions for document %d: %v\n", document.ID, err)
+			failed++
+			continue
+		}
+
+		if err := documentUsecase.SetSuggestedQuestions(document.ID, questions, hash); err != nil {
+			return fmt.Errorf("failed to save suggested questions: %w", err)
+		}
+		fmt.Printf("✓ Suggested %d questions for document %d: %s\n", len(questions), document.ID, document.Title)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to generate suggested questions for %d documents", failed)
+	}
+	return nil
+}
+
+// generate はドキュメントの本文から質問候補を生成する
+func (q *QuestionSuggester) generate(ctx context.Context, document *models.Document) ([]string, error) {
+	config := &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr(float32(0.5)),
+		MaxOutputTokens:  1000,
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"questions": {
+					Type:        genai.TypeArray,
+					Items:       &genai.Schema{Type: genai.TypeString},
+					Description: "ドキュメントの読者が尋ねそうな質問",
+				},
+			},
+			Required: []string{"questions"},
+		},
+	}
+
+	prompt := fmt.Sprintf(`以下のドキュメントを読んだ人が次に知りたくなりそうな質問を%d〜%d個作成してください。
+
+=== 作成指針 ===
+- ドキュメントの内容で答えられる、具体的な質問にする
+- 1つの質問は1文で、60文字程度までにする
+- 似た質問を重複させない
+- 日本語で作成する
+
+=== ドキュメント ===
+タイトル: %s
+要約: %s
+
+%s`, minSuggestedQuestions, maxSuggestedQuestions, document.Title, document.Summary, document.Content)
+
+	resp, err := q.client.Models.GenerateContent(ctx, suggestionModel, genai.Text(prompt), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	var result struct {
+		Questions []string `json:"questions"`
+	}
+	if err := parseJSONResponse(resp.Text(), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+	}
+
+	questions := normalizeQuestions(result.Questions)
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("no questions generated")
+	}
+	return questions, nil
+}
+
+// normalizeQuestions は空や重複を除き、質問候補を上限件数に揃える
+func normalizeQuestions(questions []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, question := range questions {
+		question = strings.TrimSpace(question)
+		if question == "" || seen[question] {
+			continue
+		}
+		seen[question] = true
+		normalized = append(normalized, question)
+		if len(normalized) == maxSuggestedQuestions {
+			break
+		}
+	}
+	return normalized
+}
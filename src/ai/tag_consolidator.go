@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"insight/src/usecase"
+
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+// TagConsolidator はタグの語彙を見直し、統合すべきタグの組を提案するサービス
+type TagConsolidator struct {
+	client *genai.Client
+	db     *gorm.DB
+}
+
+// NewTagConsolidator は新しいTagConsolidatorを作成
+func NewTagConsolidator(db *gorm.DB) (*TagConsolidator, error) {
+	client, err := NewGenaiClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TagConsolidator{
+		client: client,
+		db:     db,
+	}, nil
+}
+
+// TagMergeProposal はAIが提案する1組のタグの統合
+// Tags のタグを Canonical のタグにまとめる（Canonical は既存のタグでなくてもよい）
+type TagMergeProposal struct {
+	Canonical string   `json:"canonical"`
+	Tags      []string `json:"tags"`
+	Reason    string   `json:"reason"`
+}
+
+type consolidationResponse struct {
+	Groups []TagMergeProposal `json:"groups"`
+}
+
+// ProposeMerges はすべてのタグを利用件数とともにAIに渡し、統合の提案を取得する
+// 提案は適用せず、存在しないタグや重複した指定を取り除いて返す
+func (t *TagConsolidator) ProposeMerges(ctx context.Context) ([]TagMergeProposal, error) {
+	summaries, err := usecase.NewTagUsecase(t.db).GetTagSummaries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	if len(summaries) < 2 {
+		return nil, nil
+	}
+
+	fmt.Printf("Analyzing %d tags...\n", len(summaries))
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"groups": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"canonical": {
+							Type:        genai.TypeString,
+							Description: "統合後に残すタグ名",
+						},
+						"tags": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type: genai.TypeString,
+							},
+							Description: "統合するタグ名（既存のタグのみ）",
+						},
+						"reason": {
+							Type:        genai.TypeString,
+							Description: "統合する理由",
+						},
+					},
+					Required: []string{"canonical", "tags", "reason"},
+				},
+			},
+		},
+		Required: []string{"groups"},
+	}
+
+	config := &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr(float32(0.1)),
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	}
+
+	resp, err := t.client.Models.GenerateContent(ctx, "gemini-2.5-flash", genai.Text(buildConsolidationPrompt(summaries)), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no response generated")
+	}
+
+	var response consolidationResponse
+	if err := json.Unmarshal([]byte(resp.Candidates[0].Content.Parts[0].Text), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+	}
+
+	return sanitizeMergeProposals(response.Groups, summaries), nil
+}
+
+// sanitizeMergeProposals は提案から存在しないタグ・統合先と同じタグ・他の組と重複するタグを除き、
+// 統合するタグが残らない組を捨てる
+func sanitizeMergeProposals(proposals []TagMergeProposal, summaries []usecase.TagSummary) []TagMergeProposal {
+	known := make(map[string]bool, len(summaries))
+	for _, summary := range summaries {
+		known[summary.Name] = true
+	}
+
+	used := make(map[string]bool)
+	var sanitized []TagMergeProposal
+	for _, proposal := range proposals {
+		proposal.Canonical = strings.TrimSpace(proposal.Canonical)
+		if proposal.Canonical == "" || used[proposal.Canonical] {
+			continue
+		}
+
+		var tags []string
+		for _, tag := range proposal.Tags {
+			tag = strings.TrimSpace(tag)
+			if !known[tag] || used[tag] || tag == proposal.Canonical {
+				continue
+			}
+			tags = append(tags, tag)
+			used[tag] = true
+		}
+		if len(tags) == 0 {
+			continue
+		}
+
+		used[proposal.Canonical] = true
+		proposal.Tags = tags
+		sanitized = append(sanitized, proposal)
+	}
+	return sanitized
+}
+
+func buildConsolidationPrompt(summaries []usecase.TagSummary) string {
+	tagsInfo := ""
+	for _, summary := range summaries {
+		tagsInfo += fmt.Sprintf("- %s (documents: %d, fragments: %d)", summary.Name, summary.DocumentCount, summary.FragmentCount)
+		if len(summary.Synonyms) > 0 {
+			tagsInfo += fmt.Sprintf(" synonyms: %s", strings.Join(summary.Synonyms, ", "))
+		}
+		tagsInfo += "\n"
+	}
+
+	return fmt.Sprintf(`以下はナレッジベースで使われているタグの一覧です。同じ意味のタグを統合して、語彙を整理する案を作成してください。
+
+=== タグ一覧（利用件数・同義語） ===
+%s
+=== 統合の基準 ===
+- 表記揺れ（大文字小文字、単数複数、略語、日本語と英語など）や、同じ概念を指すタグをまとめる
+- 関連はしているが意味の異なるタグ（例: 上位概念と下位概念）はまとめない
+- 統合後に残すタグ名（canonical）は、原則として利用件数の多い既存のタグ名を選ぶ
+- 確信が持てない組は提案しない
+- 1つのタグは1つの組にのみ含める
+
+=== 出力形式 ===
+JSON形式で、統合する組ごとに以下を含める：
+- canonical: 統合後に残すタグ名
+- tags: canonical にまとめる既存のタグ名の配列（canonical 自身は含めない）
+- reason: 統合する理由（1文）`, tagsInfo)
+}
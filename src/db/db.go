@@ -1,6 +1,8 @@
 package db
 
 import (
+	"strings"
+
 	"insight/src/models"
 
 	"gorm.io/driver/sqlite"
@@ -57,6 +59,11 @@ func Migrate(db *gorm.DB) error {
 		return err
 	}
 
+	// 全文検索インデックスを作成（FTS5が使えないビルドではLIKE検索で代替する）
+	if err := SetupFullTextSearch(db); err != nil && !strings.Contains(err.Error(), "no such module") {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ftsTable は全文検索インデックスの定義
+type ftsTable struct {
+	name    string   // FTS5仮想テーブル名
+	source  string   // 同期元のテーブル名
+	columns []string // インデックス対象カラム
+}
+
+// ftsTables は全文検索の対象テーブル一覧
+var ftsTables = []ftsTable{
+	{name: "documents_fts", source: "documents", columns: []string{"title", "summary", "content"}},
+	{name: "fragments_fts", source: "fragments", columns: []string{"content"}},
+}
+
+// SetupFullTextSearch はFTS5仮想テーブルと同期用トリガーを作成する
+// 日本語を分かち書きなしで検索できるようtrigramトークナイザーを使用する
+// FTS5が組み込まれていないビルド（sqlite_fts5タグなし）では同期トリガーを削除してエラーを返す
+func SetupFullTextSearch(db *gorm.DB) error {
+	for _, table := range ftsTables {
+		if err := setupFTSTable(db, table); err != nil {
+			// FTS5を使えない状態でトリガーが残ると元テーブルへの書き込みが失敗するため除去する
+			for _, t := range ftsTables {
+				dropFTSTriggers(db, t)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// FullTextSearchAvailable はFTS5インデックスが利用可能かを返す
+func FullTextSearchAvailable(db *gorm.DB) bool {
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", "documents_fts_ai").Scan(&count).Error; err != nil {
+		return false
+	}
+	if count == 0 {
+		return false
+	}
+
+	// 仮想テーブルの存在だけでなく実際に参照できるか確認
+	return db.Exec("SELECT rowid FROM documents_fts LIMIT 0").Error == nil
+}
+
+func setupFTSTable(db *gorm.DB, table ftsTable) error {
+	columns := strings.Join(table.columns, ", ")
+
+	if err := db.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, tokenize='trigram')", table.name, columns)).Error; err != nil {
+		return fmt.Errorf("failed to create %s: %w", table.name, err)
+	}
+
+	// 既存の仮想テーブルはIF NOT EXISTSで素通りするため、実際に参照できるか確認する
+	if err := db.Exec(fmt.Sprintf("SELECT rowid FROM %s LIMIT 0", table.name)).Error; err != nil {
+		return fmt.Errorf("failed to access %s: %w", table.name, err)
+	}
+
+	// トリガーが無かった場合は同期が途切れていた可能性があるため全件再構築する
+	var triggerCount int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", table.name+"_ai").Scan(&triggerCount).Error; err != nil {
+		return err
+	}
+	rebuild := triggerCount == 0
+
+	newValues := prefixColumns("new.", table.columns)
+	statements := []string{
+		// 作成時（ソフトデリート済みは除外）
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[2]s WHEN new.deleted_at IS NULL BEGIN
+	INSERT INTO %[1]s(rowid, %[3]s) VALUES (new.id, %[4]s);
+END`, table.name, table.source, columns, newValues),
+		// 更新時（GORMのソフトデリートもUPDATEとして届く）
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE ON %[2]s BEGIN
+	DELETE FROM %[1]s WHERE rowid = old.id;
+	INSERT INTO %[1]s(rowid, %[3]s) SELECT new.id, %[4]s WHERE new.deleted_at IS NULL;
+END`, table.name, table.source, columns, newValues),
+		// 物理削除時
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+	DELETE FROM %[1]s WHERE rowid = old.id;
+END`, table.name, table.source),
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create trigger for %s: %w", table.name, err)
+			}
+		}
+
+		if rebuild {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table.name)).Error; err != nil {
+				return err
+			}
+		}
+
+		// 未登録の行を補完し、削除済みの行を取り除く
+		backfill := fmt.Sprintf(`INSERT INTO %[1]s(rowid, %[3]s)
+SELECT id, %[3]s FROM %[2]s
+WHERE deleted_at IS NULL AND id NOT IN (SELECT rowid FROM %[1]s)`, table.name, table.source, columns)
+		if err := tx.Exec(backfill).Error; err != nil {
+			return fmt.Errorf("failed to backfill %s: %w", table.name, err)
+		}
+
+		prune := fmt.Sprintf(`DELETE FROM %[1]s WHERE rowid NOT IN (SELECT id FROM %[2]s WHERE deleted_at IS NULL)`, table.name, table.source)
+		return tx.Exec(prune).Error
+	})
+}
+
+func dropFTSTriggers(db *gorm.DB, table ftsTable) {
+	for _, suffix := range []string{"_ai", "_au", "_ad"} {
+		db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s%s", table.name, suffix))
+	}
+}
+
+func prefixColumns(prefix string, columns []string) string {
+	prefixed := make([]string, len(columns))
+	for i, column := range columns {
+		prefixed[i] = prefix + column
+	}
+	return strings.Join(prefixed, ", ")
+}
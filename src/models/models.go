@@ -14,6 +14,10 @@ type Fragment struct {
 	// 基本情報
 	Content string `gorm:"type:text;not null"`
 
+	// 作成したユーザー（ユーザー導入前に作成されたものはnil）
+	UserID *uint `gorm:"index"`
+	User   *User
+
 	// ドキュメントとの関連
 	Documents []Document `gorm:"many2many:document_fragments;"`
 
@@ -21,6 +25,14 @@ type Fragment struct {
 	Tags []Tag `gorm:"many2many:fragment_tags;"`
 }
 
+// FragmentRevision はFragmentを編集する前の内容の記録
+type FragmentRevision struct {
+	gorm.Model
+
+	FragmentID uint   `gorm:"not null;index"`
+	Content    string `gorm:"type:text;not null"` // 編集前の内容
+}
+
 // Document は複数のFragmentをまとめて要約したドキュメント
 type Document struct {
 	gorm.Model
@@ -33,6 +45,18 @@ type Document struct {
 	// バージョン管理
 	VersionCreatedAt time.Time `gorm:"not null;index"` // 同一バッチで作成されたドキュメント群のバージョンタイムスタンプ
 
+	// 人による編集（再生成時に人の手が入ったドキュメントを識別するため）
+	EditedByHuman bool       `gorm:"not null;default:false;index"`
+	HumanEditedAt *time.Time // 最後に人が作成・編集した日時
+
+	// 固定（再生成時も内容を変えずに新しいバージョンへ引き継ぐ）
+	Locked   bool `gorm:"not null;default:false;index"`
+	LockedAt *time.Time
+
+	// 質問の候補（内容が変わった場合のみ再生成する）
+	SuggestedQuestions     []string `gorm:"serializer:json"`
+	SuggestedQuestionsHash string   `gorm:"size:64"` // 質問を生成した時点の本文のハッシュ
+
 	// 関連フラグメント
 	Fragments []Fragment `gorm:"many2many:document_fragments;"`
 
@@ -40,6 +64,60 @@ type Document struct {
 	Tags []Tag `gorm:"many2many:document_tags;"`
 }
 
+// DocumentRevision は人が作成・編集した時点のDocumentの内容の記録
+type DocumentRevision struct {
+	gorm.Model
+
+	DocumentID uint   `gorm:"not null;index"`
+	Author     string `gorm:"size:100;not null"` // 編集者（AIが生成した元の内容は "AI"）
+	UserID     *uint  `gorm:"index"`             // 編集したユーザー（AIやユーザー導入前の編集はnil）
+	Title      string `gorm:"size:500;not null"`
+	Summary    string `gorm:"type:text;not null"`
+	Content    string `gorm:"type:text;not null"`
+}
+
+// GenerationRun はAIによるドキュメント生成の1回分の記録
+// 対象を絞り込んだ生成（スコープ付き）のバージョンは、全フラグメントからの「最新」バージョンを置き換えない
+type GenerationRun struct {
+	gorm.Model
+
+	// 生成したドキュメント群のバージョン
+	VersionCreatedAt time.Time `gorm:"not null;uniqueIndex"`
+
+	// 対象範囲（スコープなしの場合は全フラグメント）
+	Scoped           bool     `gorm:"not null;default:false;index"`
+	ScopeTags        []string `gorm:"serializer:json"`
+	ScopeSince       *time.Time
+	ScopeUntil       *time.Time
+	ScopeFragmentIDs []uint `gorm:"serializer:json"`
+
+	// 利用者からの生成パラメータ（空の場合は既定の構成でAIに任せる）
+	Instructions    string `gorm:"type:text"`
+	Audience        string `gorm:"size:200"`
+	Style           string `gorm:"size:20"`
+	Granularity     string `gorm:"size:20"`
+	TargetDocuments int    `gorm:"not null;default:0"` // 希望するドキュメント数（0はAIに任せる）
+
+	// 生成結果
+	FragmentCount int `gorm:"not null;default:0"` // 生成に使用したフラグメント数
+	DocumentCount int `gorm:"not null;default:0"` // 作成したドキュメント数（引き継いだ固定ドキュメントを含む）
+}
+
+// ドキュメント生成のスタイル
+const (
+	GenerationStyleHowTo      = "howto"      // 手順を追って説明するハウツー
+	GenerationStyleReference  = "reference"  // 網羅的に調べるためのリファレンス
+	GenerationStyleFAQ        = "faq"        // 質問と回答の形式
+	GenerationStyleADR        = "adr"        // 設計判断の記録（Architecture Decision Record）
+	GenerationStyleOnboarding = "onboarding" // 新しく参加した人向けの入門ガイド
+)
+
+// ドキュメント生成の粒度
+const (
+	GenerationGranularityBroad    = "broad"    // 大きなテーマでまとめて少数のドキュメントにする
+	GenerationGranularityDetailed = "detailed" // 細かいテーマに分けて多数のドキュメントにする
+)
+
 // Tag はドキュメントやフラグメントを分類するためのタグ
 type Tag struct {
 	gorm.Model
@@ -48,17 +126,254 @@ type Tag struct {
 	Name  string `gorm:"size:100;unique;not null"`
 	Color string `gorm:"size:7"` // hex color code (#RRGGBB)
 
+	// 親タグ（"infra > kubernetes > networking" のような階層。nil は最上位）
+	ParentID *uint `gorm:"index"`
+
 	// 関連エンティティ
 	Documents []Document `gorm:"many2many:document_tags;"`
 	Fragments []Fragment `gorm:"many2many:fragment_tags;"`
+
+	// 同義語（タグ作成時にこのタグへ読み替える名前）
+	Synonyms []TagSynonym
+}
+
+// TagSynonym はタグの別名（"golang" → "Go" など）
+// タグを作成・取得する際に、別名で指定されたものは元のタグとして扱う
+type TagSynonym struct {
+	gorm.Model
+
+	Name  string `gorm:"size:100;uniqueIndex;not null"`
+	TagID uint   `gorm:"not null;index"`
+}
+
+// Embedding はFragmentやDocumentのチャンクをベクトル化したもの
+type Embedding struct {
+	gorm.Model
+
+	// 埋め込み元
+	OwnerType  string `gorm:"size:20;not null;index:idx_embedding_owner"` // "fragment" または "document"
+	OwnerID    uint   `gorm:"not null;index:idx_embedding_owner"`
+	ChunkIndex int    `gorm:"not null"`
+	Chunk      string `gorm:"type:text;not null"`
+
+	// 変更検知用のハッシュ（元コンテンツ全体のSHA-256）
+	ContentHash string `gorm:"size:64;not null"`
+
+	// ベクトル情報
+	ModelName  string `gorm:"column:model;size:100;not null;index"` // 埋め込みに使用したモデル名
+	Dimensions int    `gorm:"not null"`
+	Vector     []byte `gorm:"not null"` // float32のリトルエンディアン列
+}
+
+// 質問応答の対象範囲
+const (
+	QAScopeDocument  = "document"  // 特定ドキュメントへの質問
+	QAScopeGlobal    = "global"    // 全ドキュメントへの質問
+	QAScopeFragments = "fragments" // ドキュメント化前のフラグメントへの質問
+	QAScopeAgent     = "agent"     // ツール呼び出しでナレッジベースを調べる質問
+)
+
+// 質問応答へのフィードバック
+const (
+	FeedbackUp   = 1  // 良い回答
+	FeedbackDown = -1 // 悪い回答
+)
+
+// QAExchange は質問応答の1往復（質問と回答）の記録
+type QAExchange struct {
+	gorm.Model
+
+	// 質問と回答
+	Question string `gorm:"type:text;not null"`
+	Answer   string `gorm:"type:text;not null"`
+
+	// 質問したユーザー
+	UserID *uint `gorm:"index"`
+
+	// 対象範囲（document / global）と対象ドキュメント（全ドキュメント対象の場合はnil）
+	Scope      string `gorm:"not null;default:'document';index"`
+	DocumentID *uint  `gorm:"index"`
+
+	// 回答時に参照したドキュメントのバージョンと範囲指定
+	Version          *time.Time
+	ScopeTags        []string `gorm:"serializer:json"`
+	ScopeDocumentIDs []uint   `gorm:"serializer:json"`
+	ScopeSince       *time.Time
+	ScopeUntil       *time.Time
+
+	// 回答に使用したAIモデル
+	ModelName string `gorm:"column:model"`
+
+	// 回答の情報源（ドキュメントタイトルなど）
+	Sources []string `gorm:"serializer:json"`
+
+	// ユーザーの評価（1: 良い, -1: 悪い, 0: 未評価）とコメント
+	Feedback        int    `gorm:"not null;default:0;index"`
+	FeedbackComment string `gorm:"type:text"`
+
+	// 回答を保存したフラグメント
+	FragmentID *uint `gorm:"index"`
+
+	// 所属する会話スレッド
+	ConversationID *uint `gorm:"index"`
+
+	// Web検索のグラウンディング情報
+	WebSearch        bool        `gorm:"not null;default:false"`
+	WebSources       []WebSource `gorm:"serializer:json"`
+	WebSearchQueries []string    `gorm:"serializer:json"`
+}
+
+// Conversation は質問応答の会話スレッド
+type Conversation struct {
+	gorm.Model
+
+	// 基本情報
+	Title string `gorm:"size:500;not null"`
+
+	// 対象範囲（document / global / fragments）と対象ドキュメント（全ドキュメント対象の場合はnil）
+	Scope      string `gorm:"size:20"`
+	DocumentID *uint  `gorm:"index"`
+
+	// 会話内のメッセージ
+	Messages []Message
+}
+
+// 会話メッセージの発言者
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Message は会話スレッド内の1メッセージ
+type Message struct {
+	gorm.Model
+
+	ConversationID uint   `gorm:"not null;index"`
+	Role           string `gorm:"size:20;not null"` // "user" または "assistant"
+	Content        string `gorm:"type:text;not null"`
+
+	// 回答メッセージに対応する質問応答の記録
+	ExchangeID *uint `gorm:"index"`
+}
+
+// WebSource はWeb検索で回答の根拠となった外部ページ
+type WebSource struct {
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// ユーザーの役割
+const (
+	UserRoleViewer = "viewer" // 閲覧・検索のみ
+	UserRoleEditor = "editor" // 作成・編集・AIの利用（フラグメントは自分が作成したもののみ編集・削除できる）
+	UserRoleAdmin  = "admin"  // すべての操作（他のユーザーのフラグメント・タグの管理・フラグメント圧縮を含む）
+)
+
+// User はInsightを利用するユーザー
+type User struct {
+	gorm.Model
+
+	Username string `gorm:"size:50;uniqueIndex;not null"`
+	Role     string `gorm:"size:20;not null;default:'editor'"`
+}
+
+// AllowsScope は役割で利用できる権限かを返す（閲覧者は read のみ）
+func (u *User) AllowsScope(scope string) bool {
+	return u.Role == UserRoleAdmin || u.Role == UserRoleEditor || scope == ScopeRead
+}
+
+// IsAdmin は管理者かを返す
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+// CanModifyFragment はフラグメントを編集・削除できるかを返す
+// 管理者以外は自分が作成したもの（とユーザー導入前に作成された持ち主のいないもの）に限る
+func (u *User) CanModifyFragment(fragment *Fragment) bool {
+	return u.IsAdmin() || fragment.UserID == nil || *fragment.UserID == u.ID
+}
+
+// CompressionAction はフラグメント圧縮で適用した1件の操作（統合・削除）の記録
+type CompressionAction struct {
+	gorm.Model
+
+	Type        string `gorm:"size:20;not null"` // merge / delete
+	FragmentIDs []uint `gorm:"serializer:json"`
+	NewContent  string `gorm:"type:text"` // 統合後の内容（mergeの場合のみ）
+	Reason      string `gorm:"type:text"`
+
+	// 適用を承認した（圧縮を実行した）ユーザー
+	ApprovedByID *uint `gorm:"index"`
+}
+
+// APIトークンの権限
+const (
+	ScopeRead  = "read"  // 閲覧・検索
+	ScopeWrite = "write" // フラグメント・ドキュメント・タグの作成・編集・削除
+	ScopeAI    = "ai"    // AIの呼び出し（ドキュメント生成・質問応答など、料金が発生する操作）
+)
+
+// APIToken はWebサーバーにアクセスするための個人用トークン
+// トークンそのものは作成時に一度だけ表示し、データベースにはハッシュ値のみを保存する
+type APIToken struct {
+	gorm.Model
+
+	// 基本情報
+	Name      string `gorm:"size:100;not null"`
+	TokenHash string `gorm:"size:64;uniqueIndex;not null"` // SHA-256（16進数）
+	Prefix    string `gorm:"size:20;not null"`             // 一覧で見分けるためのトークンの先頭部分
+
+	// トークンの持ち主（権限は持ち主の役割の範囲に制限される）
+	UserID *uint `gorm:"index"`
+	User   *User
+
+	// 権限（read / write / ai）
+	Scopes []string `gorm:"serializer:json"`
+
+	// 有効期限（nilの場合は無期限）と最終利用日時
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// HasScope はトークンが指定された権限を持つかを返す
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Session はブラウザのログインセッション
+// APIトークンでログインし、権限はトークンのものを使う（トークンを削除するとセッションも無効になる）
+type Session struct {
+	gorm.Model
+
+	TokenHash  string    `gorm:"size:64;uniqueIndex;not null"` // Cookieの値のSHA-256（16進数）
+	APITokenID uint      `gorm:"not null;index"`
+	ExpiresAt  time.Time `gorm:"not null"`
 }
 
 // GetAllModels はこのパッケージ内のすべてのGORMモデルを返します
 func GetAllModels() []interface{} {
 	return []interface{}{
 		&Fragment{},
+		&FragmentRevision{},
 		&Document{},
+		&DocumentRevision{},
+		&GenerationRun{},
 		&Tag{},
+		&TagSynonym{},
+		&Embedding{},
+		&QAExchange{},
+		&Conversation{},
+		&Message{},
+		&User{},
+		&CompressionAction{},
+		&APIToken{},
+		&Session{},
 	}
 }
 
@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+// Scopes はAPIトークンに付けられる権限の一覧
+var Scopes = []string{models.ScopeRead, models.ScopeWrite, models.ScopeAI}
+
+// apiTokenPrefix はAPIトークンの先頭に付ける文字列（ログなどに紛れ込んだ際に見分けるため）
+const apiTokenPrefix = "insight_"
+
+// SessionDuration はブラウザのログインセッションの有効期間
+const SessionDuration = 30 * 24 * time.Hour
+
+type AuthUsecase struct {
+	db *gorm.DB
+}
+
+func NewAuthUsecase(db *gorm.DB) *AuthUsecase {
+	return &AuthUsecase{db: db}
+}
+
+// CreateAPITokenInput はAPIToken作成の入力データ
+type CreateAPITokenInput struct {
+	Name      string     `json:"name" validate:"required"`
+	UserID    uint       `json:"user_id" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIToken はAPIトークンを作成し、保存したトークンとトークンそのものを返す
+// トークンそのものは保存しないため、呼び出し側で利用者に一度だけ表示する
+func (u *AuthUsecase) CreateAPIToken(input CreateAPITokenInput) (*models.APIToken, string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	scopes, err := normalizeScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var user models.User
+	if err := u.db.First(&user, input.UserID).Error; err != nil {
+		return nil, "", fmt.Errorf("user %d not found: %w", input.UserID, err)
+	}
+	for _, scope := range scopes {
+		if !user.AllowsScope(scope) {
+			return nil, "", fmt.Errorf("user '%s' (%s) cannot have the '%s' scope", user.Username, user.Role, scope)
+		}
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := apiTokenPrefix + secret
+
+	token := models.APIToken{
+		Name:      name,
+		TokenHash: hashToken(raw),
+		Prefix:    raw[:len(apiTokenPrefix)+6],
+		UserID:    &user.ID,
+		User:      &user,
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+	if err := u.db.Create(&token).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	return &token, raw, nil
+}
+
+// normalizeScopes は権限の指定を検証し、重複を除いて一覧の順に並べる
+func normalizeScopes(scopes []string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" {
+			continue
+		}
+		valid := false
+		for _, s := range Scopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid scope: %s (available: %s)", scope, strings.Join(Scopes, ", "))
+		}
+		requested[scope] = true
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one scope is required (available: %s)", strings.Join(Scopes, ", "))
+	}
+
+	var result []string
+	for _, s := range Scopes {
+		if requested[s] {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// GetAllAPITokens はすべてのAPIトークンを持ち主を含めて作成順に取得する
+func (u *AuthUsecase) GetAllAPITokens() ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	if err := u.db.Preload("User").Order("created_at ASC, id ASC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CountAPITokens はAPIトークンの件数を返す
+func (u *AuthUsecase) CountAPITokens() (int64, error) {
+	var count int64
+	if err := u.db.Model(&models.APIToken{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RevokeAPIToken はAPIトークンを削除し、そのトークンでログインしたセッションも削除する
+func (u *AuthUsecase) RevokeAPIToken(id uint) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := u.db.First(&token, id).Error; err != nil {
+		return nil, err
+	}
+
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("api_token_id = ?", id).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&token).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke token %d: %w", id, err)
+	}
+	return &token, nil
+}
+
+// AuthenticateAPIToken はトークンそのものから有効なAPIトークンを持ち主を含めて取得し、最終利用日時を更新する
+func (u *AuthUsecase) AuthenticateAPIToken(raw string) (*models.APIToken, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	var token models.APIToken
+	if err := u.db.Preload("User").Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	now := time.Now()
+	if err := validateAPIToken(&token, now); err != nil {
+		return nil, err
+	}
+
+	if err := u.db.Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+	return &token, nil
+}
+
+// CreateSession はAPIトークンでログインし、Cookieに入れるセッションの値と有効期限を返す
+func (u *AuthUsecase) CreateSession(rawToken string) (string, time.Time, error) {
+	token, err := u.AuthenticateAPIToken(rawToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(SessionDuration)
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(expiresAt) {
+		expiresAt = *token.ExpiresAt
+	}
+
+	session := models.Session{
+		TokenHash:  hashToken(raw),
+		APITokenID: token.ID,
+		ExpiresAt:  expiresAt,
+	}
+	if err := u.db.Create(&session).Error; err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create session: %w", err)
+	}
+	return raw, expiresAt, nil
+}
+
+// AuthenticateSession はCookieの値から有効なセッションを探し、ログインに使ったAPIトークンを返す
+func (u *AuthUsecase) AuthenticateSession(raw string) (*models.APIToken, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("session is required")
+	}
+
+	var session models.Session
+	if err := u.db.Where("token_hash = ?", hashToken(raw)).First(&session).Error; err != nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("session has expired")
+	}
+
+	var token models.APIToken
+	if err := u.db.Preload("User").First(&token, session.APITokenID).Error; err != nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+	if err := validateAPIToken(&token, time.Now()); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// validateAPIToken はトークンが期限内で、持ち主のユーザーが存在するかを確認する
+// ユーザー導入前に作成したトークンは持ち主がいないため使えない
+func validateAPIToken(token *models.APIToken, now time.Time) error {
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+		return fmt.Errorf("token has expired")
+	}
+	if token.User == nil {
+		return fmt.Errorf("token does not belong to a user; create a new token with --user")
+	}
+	return nil
+}
+
+// DeleteSession はセッションを削除する（ログアウト）
+func (u *AuthUsecase) DeleteSession(raw string) error {
+	return u.db.Unscoped().Where("token_hash = ?", hashToken(raw)).Delete(&models.Session{}).Error
+}
+
+// DeleteExpiredSessions は有効期限の切れたセッションを削除し、削除した件数を返す
+func (u *AuthUsecase) DeleteExpiredSessions() (int64, error) {
+	result := u.db.Unscoped().Where("expires_at <= ?", time.Now()).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// randomToken は推測できない32バイトの乱数を16進数で返す
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken はトークンを保存・照合するためのハッシュ値を返す
+// トークンは十分な長さの乱数なので、ソルトや低速なハッシュは使わない
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+type ConversationUsecase struct {
+	db *gorm.DB
+}
+
+func NewConversationUsecase(db *gorm.DB) *ConversationUsecase {
+	return &ConversationUsecase{db: db}
+}
+
+// CreateConversationInput はConversation作成の入力データ
+type CreateConversationInput struct {
+	Title      string `json:"title" validate:"required"`
+	Scope      string `json:"scope"`
+	DocumentID *uint  `json:"document_id"`
+}
+
+// CreateConversation は新しい会話スレッドを作成する
+func (u *ConversationUsecase) CreateConversation(input CreateConversationInput) (*models.Conversation, error) {
+	conversation := models.Conversation{
+		Title:      input.Title,
+		Scope:      input.Scope,
+		DocumentID: input.DocumentID,
+	}
+
+	if err := u.db.Create(&conversation).Error; err != nil {
+		return nil, err
+	}
+
+	return &conversation, nil
+}
+
+// GetConversation はIDで会話スレッドを取得する（メッセージを時系列順に含む）
+func (u *ConversationUsecase) GetConversation(id uint) (*models.Conversation, error) {
+	var conversation models.Conversation
+	if err := u.db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC, id ASC")
+	}).First(&conversation, id).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// GetAllConversations はすべての会話スレッドを新しく更新された順に取得する（メッセージは含まない）
+func (u *ConversationUsecase) GetAllConversations() ([]models.Conversation, error) {
+	var conversations []models.Conversation
+	if err := u.db.Order("updated_at DESC").Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// AddMessageInput はMessage追加の入力データ
+type AddMessageInput struct {
+	ConversationID uint   `json:"conversation_id" validate:"required"`
+	Role           string `json:"role" validate:"required"`
+	Content        string `json:"content" validate:"required"`
+	ExchangeID     *uint  `json:"exchange_id"`
+}
+
+// AddMessage は会話スレッドにメッセージを追加し、スレッドの更新日時を進める
+func (u *ConversationUsecase) AddMessage(input AddMessageInput) (*models.Message, error) {
+	message := models.Message{
+		ConversationID: input.ConversationID,
+		Role:           input.Role,
+		Content:        input.Content,
+		ExchangeID:     input.ExchangeID,
+	}
+
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		// スレッドの存在確認
+		var conversation models.Conversation
+		if err := tx.First(&conversation, input.ConversationID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+
+		// スレッド一覧の並び順のために更新日時を進める
+		return tx.Model(&conversation).Update("updated_at", message.CreatedAt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// DeleteConversation は会話スレッドとそのメッセージを削除する（ソフトデリート）
+func (u *ConversationUsecase) DeleteConversation(id uint) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Conversation{}, id).Error
+	})
+}
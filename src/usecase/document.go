@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"fmt"
 	"insight/src/models"
 	"time"
 
@@ -23,6 +24,8 @@ type CreateDocumentInput struct {
 	VersionCreatedAt time.Time `json:"version_created_at" validate:"required"`
 	FragmentIDs      []uint    `json:"fragment_ids"`
 	TagIDs           []uint    `json:"tag_ids"`
+	Author           string    `json:"author"`  // 人が作成した場合の作成者（AIが生成した場合は空）
+	UserID           *uint     `json:"user_id"` // 作成したユーザー（リビジョンに記録する）
 }
 
 // CreateDocument は新しいDocumentを作成する
@@ -33,6 +36,11 @@ func (u *DocumentUsecase) CreateDocument(input CreateDocumentInput) (*models.Doc
 		Content:          input.Content,
 		VersionCreatedAt: input.VersionCreatedAt,
 	}
+	if input.Author != "" {
+		now := time.Now()
+		document.EditedByHuman = true
+		document.HumanEditedAt = &now
+	}
 
 	// トランザクション内で実行
 	err := u.db.Transaction(func(tx *gorm.DB) error {
@@ -41,6 +49,13 @@ func (u *DocumentUsecase) CreateDocument(input CreateDocumentInput) (*models.Doc
 			return err
 		}
 
+		// 人が作成した場合は最初のリビジョンを記録
+		if input.Author != "" {
+			if err := createDocumentRevision(tx, &document, input.Author, input.UserID); err != nil {
+				return err
+			}
+		}
+
 		// Fragmentとの関連を設定
 		if len(input.FragmentIDs) > 0 {
 			var fragments []models.Fragment
@@ -104,6 +119,139 @@ func (u *DocumentUsecase) GetDocumentsByVersion(versionCreatedAt time.Time) ([]m
 	return documents, nil
 }
 
+// ListDocumentsInput はDocument一覧の絞り込みとページングの入力データ
+type ListDocumentsInput struct {
+	Tags    []string   `json:"tags"`    // いずれかのタグ（子孫のタグを含む）を持つDocumentに絞り込む
+	Version *time.Time `json:"version"` // 指定バージョンのDocumentに絞り込む
+	Since   *time.Time `json:"since"`   // 作成日時の下限（この時刻を含む）
+	Until   *time.Time `json:"until"`   // 作成日時の上限（この時刻を含まない）
+	Page    int        `json:"page"`
+	PerPage int        `json:"per_page"`
+}
+
+// DocumentList はDocument一覧の1ページ分
+type DocumentList struct {
+	Documents []models.Document
+	Total     int64
+	Page      int
+	PerPage   int
+}
+
+// ListDocuments は条件に合うDocumentを新しいバージョン・作成順にページ単位で取得する
+func (u *DocumentUsecase) ListDocuments(input ListDocumentsInput) (*DocumentList, error) {
+	page, perPage := NormalizePaging(input.Page, input.PerPage)
+
+	query := u.db.Model(&models.Document{})
+	if len(input.Tags) > 0 {
+		documentIDs, err := u.taggedDocumentIDs(input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id IN (?)", documentIDs)
+	}
+	if input.Version != nil {
+		query = query.Where("version_created_at = ?", *input.Version)
+	}
+	if input.Since != nil {
+		query = query.Where("created_at >= ?", *input.Since)
+	}
+	if input.Until != nil {
+		query = query.Where("created_at < ?", *input.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var documents []models.Document
+	if err := query.Preload("Fragments").Preload("Tags").Order("version_created_at DESC, created_at ASC, id ASC").Offset((page - 1) * perPage).Limit(perPage).Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	return &DocumentList{Documents: documents, Total: total, Page: page, PerPage: perPage}, nil
+}
+
+// VersionDocumentCount はバージョンごとのドキュメント数
+type VersionDocumentCount struct {
+	VersionCreatedAt time.Time
+	Count            int64
+}
+
+// CountDocumentsByVersion はバージョンごとのドキュメント数を返す（新しい順）
+func (u *DocumentUsecase) CountDocumentsByVersion() ([]VersionDocumentCount, error) {
+	var counts []VersionDocumentCount
+	if err := u.db.Model(&models.Document{}).
+		Select("version_created_at, COUNT(*) AS count").
+		Group("version_created_at").
+		Order("version_created_at DESC").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// CountDocumentsByVersionWithTags は指定したタグ（子孫のタグを含む）が付いたドキュメント数をバージョンごとに返す（新しい順）
+func (u *DocumentUsecase) CountDocumentsByVersionWithTags(tagNames []string) ([]VersionDocumentCount, error) {
+	documentIDs, err := u.taggedDocumentIDs(tagNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []VersionDocumentCount
+	if err := u.db.Model(&models.Document{}).
+		Select("version_created_at, COUNT(*) AS count").
+		Where("id IN (?)", documentIDs).
+		Group("version_created_at").
+		Order("version_created_at DESC").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetDocumentsByVersionWithTags は指定したバージョンのうち、指定したタグ（子孫のタグを含む）が付いたDocumentを取得する
+func (u *DocumentUsecase) GetDocumentsByVersionWithTags(versionCreatedAt time.Time, tagNames []string) ([]models.Document, error) {
+	documentIDs, err := u.taggedDocumentIDs(tagNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []models.Document
+	if err := u.db.Preload("Tags").Where("version_created_at = ? AND id IN (?)", versionCreatedAt, documentIDs).Order("created_at ASC").Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// taggedDocumentIDs は指定したタグまたはその子孫のタグが付いたドキュメントのIDを返すサブクエリを作る
+func (u *DocumentUsecase) taggedDocumentIDs(tagNames []string) (*gorm.DB, error) {
+	tags, err := NewTagUsecase(u.db).ExpandTagNames(tagNames)
+	if err != nil {
+		return nil, err
+	}
+	return u.db.Table("document_tags").
+		Select("document_tags.document_id").
+		Joins("JOIN tags ON tags.id = document_tags.tag_id").
+		Where("tags.name IN ?", tags), nil
+}
+
+// ParseVersion はバージョン文字列をタイムスタンプに変換する
+// Web UIやCLIで使われる複数の表記を受け付ける
+func ParseVersion(version string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02T15:04:05Z",             // ISO8601形式
+		time.RFC3339Nano,                   // RFC3339形式
+		"2006-01-02 15:04:05.999999-07:00", // データベース形式
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, version); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid version format: %s", version)
+}
+
 // GetDistinctVersions は全ての異なるバージョンタイムスタンプを取得する
 func (u *DocumentUsecase) GetDistinctVersions() ([]time.Time, error) {
 	var versions []time.Time
@@ -113,6 +261,219 @@ func (u *DocumentUsecase) GetDistinctVersions() ([]time.Time, error) {
 	return versions, nil
 }
 
+// GetLatestVersion は全フラグメントから生成された最新バージョンを取得する
+// 対象を絞り込んだ生成（スコープ付き）のバージョンは「最新」として扱わない
+// ドキュメントがない場合はゼロ値を返す
+func (u *DocumentUsecase) GetLatestVersion() (time.Time, error) {
+	var versions []time.Time
+	err := u.db.Model(&models.Document{}).
+		Where("version_created_at NOT IN (?)", u.db.Model(&models.GenerationRun{}).Select("version_created_at").Where("scoped = ?", true)).
+		Order("version_created_at DESC").Limit(1).
+		Pluck("version_created_at", &versions).Error
+	if err != nil || len(versions) == 0 {
+		return time.Time{}, err
+	}
+	return versions[0], nil
+}
+
+// CurrentVersion は人が作成したドキュメントを追加するバージョン（最新バージョン）を返す
+// ドキュメントがまだない場合は現在時刻を新しいバージョンとする
+func (u *DocumentUsecase) CurrentVersion() (time.Time, error) {
+	version, err := u.GetLatestVersion()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if version.IsZero() {
+		return time.Now(), nil
+	}
+	return version, nil
+}
+
+// UpdateDocumentInput はDocument更新の入力データ
+type UpdateDocumentInput struct {
+	ID      uint   `json:"id" validate:"required"`
+	Title   string `json:"title" validate:"required"`
+	Summary string `json:"summary" validate:"required"`
+	Content string `json:"content" validate:"required"`
+	TagIDs  []uint `json:"tag_ids"` // nilの場合はタグを変更しない
+	Author  string `json:"author" validate:"required"`
+	UserID  *uint  `json:"user_id"` // 編集したユーザー（リビジョンに記録する）
+}
+
+// UpdateDocument はDocumentを更新し、編集後の内容を編集者とともにリビジョンとして保存する
+// AIが生成したドキュメントを初めて編集する場合は、生成時の内容も "AI" のリビジョンとして残す
+// 編集ユーザーがなく編集者が "AI"（再生成）の場合は人による編集の印を外す
+func (u *DocumentUsecase) UpdateDocument(input UpdateDocumentInput) (*models.Document, error) {
+	var document models.Document
+
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&document, input.ID).Error; err != nil {
+			return err
+		}
+
+		var revisionCount int64
+		if err := tx.Model(&models.DocumentRevision{}).Where("document_id = ?", document.ID).Count(&revisionCount).Error; err != nil {
+			return err
+		}
+		if revisionCount == 0 {
+			if err := createDocumentRevision(tx, &document, DocumentAuthorAI, nil); err != nil {
+				return err
+			}
+		}
+
+		document.Title = input.Title
+		document.Summary = input.Summary
+		document.Content = input.Content
+		document.EditedByHuman = input.UserID != nil || input.Author != DocumentAuthorAI
+		if document.EditedByHuman {
+			now := time.Now()
+			document.HumanEditedAt = &now
+		}
+		if err := tx.Model(&document).
+			Select("Title", "Summary", "Content", "EditedByHuman", "HumanEditedAt").
+			Updates(&document).Error; err != nil {
+			return err
+		}
+
+		if input.TagIDs != nil {
+			var tags []models.Tag
+			if len(input.TagIDs) > 0 {
+				if err := tx.Find(&tags, input.TagIDs).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&document).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+
+		return createDocumentRevision(tx, &document, input.Author, input.UserID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u.GetDocument(document.ID)
+}
+
+// DocumentAuthorAI はAIが生成した内容のリビジョンの編集者名
+const DocumentAuthorAI = "AI"
+
+// createDocumentRevision はDocumentの現在の内容をリビジョンとして保存する
+func createDocumentRevision(tx *gorm.DB, document *models.Document, author string, userID *uint) error {
+	revision := models.DocumentRevision{
+		DocumentID: document.ID,
+		Author:     author,
+		UserID:     userID,
+		Title:      document.Title,
+		Summary:    document.Summary,
+		Content:    document.Content,
+	}
+	return tx.Create(&revision).Error
+}
+
+// GetDocumentRevisions はDocumentの編集履歴を新しい順に取得する
+func (u *DocumentUsecase) GetDocumentRevisions(documentID uint) ([]models.DocumentRevision, error) {
+	var revisions []models.DocumentRevision
+	if err := u.db.Where("document_id = ?", documentID).Order("created_at DESC, id DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// SetLocked はDocumentの固定状態を切り替える
+// 固定されたDocumentは再生成時に内容を変えずに新しいバージョンへ引き継がれる
+func (u *DocumentUsecase) SetLocked(id uint, locked bool) (*models.Document, error) {
+	var lockedAt *time.Time
+	if locked {
+		now := time.Now()
+		lockedAt = &now
+	}
+
+	result := u.db.Model(&models.Document{}).Where("id = ?", id).
+		Select("Locked", "LockedAt").
+		Updates(models.Document{Locked: locked, LockedAt: lockedAt})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return u.GetDocument(id)
+}
+
+// GetPreservedDocuments は指定されたバージョンの、再生成で作り直さないDocumentを取得する
+// 固定されたものと、人が作成・編集したもの（フラグメントを持たない手書きのドキュメントを含む）が対象
+func (u *DocumentUsecase) GetPreservedDocuments(versionCreatedAt time.Time) ([]models.Document, error) {
+	var documents []models.Document
+	if err := u.db.Preload("Fragments").Preload("Tags").
+		Where("version_created_at = ? AND (locked = ? OR edited_by_human = ?)", versionCreatedAt, true, true).
+		Order("created_at ASC").Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// CarryOverDocument は固定または人が編集したDocumentを内容を変えずに新しいバージョンへ複製する
+// 関連フラグメント・タグ・質問候補・編集履歴も引き継ぐ
+func (u *DocumentUsecase) CarryOverDocument(source *models.Document, versionCreatedAt time.Time) (*models.Document, error) {
+	document := models.Document{
+		Title:                  source.Title,
+		Summary:                source.Summary,
+		Content:                source.Content,
+		VersionCreatedAt:       versionCreatedAt,
+		EditedByHuman:          source.EditedByHuman,
+		HumanEditedAt:          source.HumanEditedAt,
+		Locked:                 source.Locked,
+		LockedAt:               source.LockedAt,
+		SuggestedQuestions:     source.SuggestedQuestions,
+		SuggestedQuestionsHash: source.SuggestedQuestionsHash,
+	}
+
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Fragments", "Tags").Create(&document).Error; err != nil {
+			return err
+		}
+		if len(source.Fragments) > 0 {
+			if err := tx.Model(&document).Association("Fragments").Append(source.Fragments); err != nil {
+				return err
+			}
+		}
+		if len(source.Tags) > 0 {
+			if err := tx.Model(&document).Association("Tags").Append(source.Tags); err != nil {
+				return err
+			}
+		}
+
+		var revisions []models.DocumentRevision
+		if err := tx.Where("document_id = ?", source.ID).Order("id ASC").Find(&revisions).Error; err != nil {
+			return err
+		}
+		for _, revision := range revisions {
+			revision.ID = 0
+			revision.DocumentID = document.ID
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &document, nil
+}
+
+// SetSuggestedQuestions はDocumentの質問候補と、生成元の本文のハッシュを保存する
+func (u *DocumentUsecase) SetSuggestedQuestions(id uint, questions []string, contentHash string) error {
+	return u.db.Model(&models.Document{}).Where("id = ?", id).
+		Select("SuggestedQuestions", "SuggestedQuestionsHash").
+		Updates(models.Document{SuggestedQuestions: questions, SuggestedQuestionsHash: contentHash}).Error
+}
+
 // AddFragmentToDocument は既存のDocumentにFragmentを追加する
 func (u *DocumentUsecase) AddFragmentToDocument(documentID, fragmentID uint) error {
 	var document models.Document
@@ -1,6 +1,9 @@
 package usecase
 
 import (
+	"fmt"
+	"time"
+
 	"insight/src/models"
 
 	"gorm.io/gorm"
@@ -17,12 +20,14 @@ func NewFragmentUsecase(db *gorm.DB) *FragmentUsecase {
 // CreateFragmentInput はFragment作成の入力データ
 type CreateFragmentInput struct {
 	Content string `json:"content" validate:"required"`
+	UserID  *uint  `json:"user_id"` // 作成したユーザー
 }
 
 // CreateFragment は新しいFragmentを作成する
 func (u *FragmentUsecase) CreateFragment(input CreateFragmentInput) (*models.Fragment, error) {
 	fragment := models.Fragment{
 		Content: input.Content,
+		UserID:  input.UserID,
 	}
 
 	if err := u.db.Create(&fragment).Error; err != nil {
@@ -32,10 +37,10 @@ func (u *FragmentUsecase) CreateFragment(input CreateFragmentInput) (*models.Fra
 	return &fragment, nil
 }
 
-// GetFragment はIDでFragmentを取得する
+// GetFragment はIDでFragmentを取得する（Tagと作成したユーザーも含む）
 func (u *FragmentUsecase) GetFragment(id uint) (*models.Fragment, error) {
 	var fragment models.Fragment
-	if err := u.db.First(&fragment, id).Error; err != nil {
+	if err := u.db.Preload("Tags").Preload("User").First(&fragment, id).Error; err != nil {
 		return nil, err
 	}
 	return &fragment, nil
@@ -44,12 +49,295 @@ func (u *FragmentUsecase) GetFragment(id uint) (*models.Fragment, error) {
 // GetAllFragments はすべてのFragmentを取得する
 func (u *FragmentUsecase) GetAllFragments() ([]models.Fragment, error) {
 	var fragments []models.Fragment
-	if err := u.db.Preload("Tags").Order("created_at DESC").Find(&fragments).Error; err != nil {
+	if err := u.db.Preload("Tags").Preload("User").Order("created_at DESC").Find(&fragments).Error; err != nil {
+		return nil, err
+	}
+	return fragments, nil
+}
+
+// GetFragmentsByTags は指定したタグ（子孫のタグを含む）のいずれかが付いたFragmentを新しい順に取得する
+// タグを指定しない場合はすべてのFragmentを、userID が0以外の場合はそのユーザーが作成したものだけを返す
+func (u *FragmentUsecase) GetFragmentsByTags(tagNames []string, userID uint) ([]models.Fragment, error) {
+	if len(tagNames) == 0 && userID == 0 {
+		return u.GetAllFragments()
+	}
+
+	query := u.db.Preload("Tags").Preload("User")
+	if len(tagNames) > 0 {
+		expanded, err := NewTagUsecase(u.db).ExpandTagNames(tagNames)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id IN (?)", u.db.Table("fragment_tags").
+			Select("fragment_tags.fragment_id").
+			Joins("JOIN tags ON tags.id = fragment_tags.tag_id").
+			Where("tags.name IN ?", expanded))
+	}
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var fragments []models.Fragment
+	if err := query.Order("created_at DESC").Find(&fragments).Error; err != nil {
 		return nil, err
 	}
 	return fragments, nil
 }
 
+// ListFragmentsInput はFragment一覧の絞り込みとページングの入力データ
+type ListFragmentsInput struct {
+	Tags    []string   `json:"tags"`    // いずれかのタグ（子孫のタグを含む）を持つFragmentに絞り込む
+	Since   *time.Time `json:"since"`   // 作成日時の下限（この時刻を含む）
+	Until   *time.Time `json:"until"`   // 作成日時の上限（この時刻を含まない）
+	UserID  uint       `json:"user_id"` // 0以外の場合はこのユーザーが作成したFragmentに絞り込む
+	Page    int        `json:"page"`
+	PerPage int        `json:"per_page"`
+}
+
+// FragmentList はFragment一覧の1ページ分
+type FragmentList struct {
+	Fragments []models.Fragment
+	Total     int64
+	Page      int
+	PerPage   int
+}
+
+// ListFragments は条件に合うFragmentを新しい順にページ単位で取得する
+func (u *FragmentUsecase) ListFragments(input ListFragmentsInput) (*FragmentList, error) {
+	page, perPage := NormalizePaging(input.Page, input.PerPage)
+
+	query := u.db.Model(&models.Fragment{})
+	if len(input.Tags) > 0 {
+		tags, err := NewTagUsecase(u.db).ExpandTagNames(input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id IN (?)", u.db.Table("fragment_tags").
+			Select("fragment_tags.fragment_id").
+			Joins("JOIN tags ON tags.id = fragment_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+	if input.Since != nil {
+		query = query.Where("created_at >= ?", *input.Since)
+	}
+	if input.Until != nil {
+		query = query.Where("created_at < ?", *input.Until)
+	}
+	if input.UserID != 0 {
+		query = query.Where("user_id = ?", input.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var fragments []models.Fragment
+	if err := query.Preload("Tags").Preload("User").Order("created_at DESC, id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&fragments).Error; err != nil {
+		return nil, err
+	}
+	return &FragmentList{Fragments: fragments, Total: total, Page: page, PerPage: perPage}, nil
+}
+
+// CountFragmentsByUser はユーザーごとの作成したFragmentの件数を返す（持ち主のいないものは含まない）
+func (u *FragmentUsecase) CountFragmentsByUser() (map[uint]int64, error) {
+	var rows []struct {
+		UserID uint
+		Count  int64
+	}
+	if err := u.db.Model(&models.Fragment{}).
+		Select("user_id, COUNT(*) AS count").
+		Where("user_id IS NOT NULL").
+		Group("user_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetUntaggedFragments はタグが1つも付いていないFragmentをID順に取得する
+func (u *FragmentUsecase) GetUntaggedFragments() ([]models.Fragment, error) {
+	var fragments []models.Fragment
+	err := u.db.Preload("Tags").
+		Where("id NOT IN (?)", u.db.Table("fragment_tags").Select("fragment_id")).
+		Order("id ASC").
+		Find(&fragments).Error
+	if err != nil {
+		return nil, err
+	}
+	return fragments, nil
+}
+
+// AddFragmentTags はFragmentにタグを追加する
+// 存在しないタグは作成し、すでに付いているタグはそのまま維持される
+func (u *FragmentUsecase) AddFragmentTags(fragmentID uint, tagNames []string) (*models.Fragment, error) {
+	var fragment models.Fragment
+	if err := u.db.First(&fragment, fragmentID).Error; err != nil {
+		return nil, err
+	}
+
+	tagIDs, err := NewTagUsecase(u.db).GetOrCreateTags(tagNames)
+	if err != nil {
+		return nil, err
+	}
+	if len(tagIDs) > 0 {
+		var tags []models.Tag
+		if err := u.db.Find(&tags, tagIDs).Error; err != nil {
+			return nil, err
+		}
+		if err := u.db.Model(&fragment).Association("Tags").Append(tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return u.GetFragment(fragmentID)
+}
+
+// RemoveFragmentTags はFragmentから指定した名前のタグを外す
+// タグ自体は削除しない
+func (u *FragmentUsecase) RemoveFragmentTags(fragmentID uint, tagNames []string) (*models.Fragment, error) {
+	var fragment models.Fragment
+	if err := u.db.First(&fragment, fragmentID).Error; err != nil {
+		return nil, err
+	}
+
+	var tags []models.Tag
+	if err := u.db.Where("name IN ?", tagNames).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		if err := u.db.Model(&fragment).Association("Tags").Delete(tags); err != nil {
+			return nil, err
+		}
+	}
+
+	return u.GetFragment(fragmentID)
+}
+
+// SetFragmentTags はFragmentのタグを指定した名前のタグに置き換える
+// 存在しないタグは作成し、空の場合はすべてのタグを外す
+func (u *FragmentUsecase) SetFragmentTags(fragmentID uint, tagNames []string) (*models.Fragment, error) {
+	var fragment models.Fragment
+	if err := u.db.First(&fragment, fragmentID).Error; err != nil {
+		return nil, err
+	}
+
+	tagIDs, err := NewTagUsecase(u.db).GetOrCreateTags(tagNames)
+	if err != nil {
+		return nil, err
+	}
+	var tags []models.Tag
+	if len(tagIDs) > 0 {
+		if err := u.db.Find(&tags, tagIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := u.db.Model(&fragment).Association("Tags").Replace(tags); err != nil {
+		return nil, err
+	}
+
+	return u.GetFragment(fragmentID)
+}
+
+// GetFragmentsInScope はドキュメント生成の対象範囲に含まれるFragmentをID順に取得する
+// 複数の条件を指定した場合はすべてを満たすものを返す
+func (u *FragmentUsecase) GetFragmentsInScope(scope GenerationScope) ([]models.Fragment, error) {
+	query := u.db.Preload("Tags")
+	if len(scope.FragmentIDs) > 0 {
+		query = query.Where("id IN ?", scope.FragmentIDs)
+	}
+	if scope.Since != nil {
+		query = query.Where("created_at >= ?", *scope.Since)
+	}
+	if scope.Until != nil {
+		query = query.Where("created_at < ?", *scope.Until)
+	}
+	if len(scope.Tags) > 0 {
+		tags, err := NewTagUsecase(u.db).ExpandTagNames(scope.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id IN (?)", u.db.Table("fragment_tags").
+			Select("fragment_tags.fragment_id").
+			Joins("JOIN tags ON tags.id = fragment_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+
+	var fragments []models.Fragment
+	if err := query.Order("id ASC").Find(&fragments).Error; err != nil {
+		return nil, err
+	}
+	return fragments, nil
+}
+
+// UpdateFragmentInput はFragment更新の入力データ
+type UpdateFragmentInput struct {
+	ID      uint   `json:"id" validate:"required"`
+	Content string `json:"content" validate:"required"`
+}
+
+// UpdateFragment はFragmentの内容を更新し、編集前の内容をリビジョンとして保存する
+// ドキュメントやタグとの関連はそのまま維持される
+func (u *FragmentUsecase) UpdateFragment(input UpdateFragmentInput) (*models.Fragment, error) {
+	var fragment models.Fragment
+
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&fragment, input.ID).Error; err != nil {
+			return err
+		}
+
+		// 内容が変わらない場合はリビジョンを作らない
+		if fragment.Content == input.Content {
+			return nil
+		}
+
+		revision := models.FragmentRevision{
+			FragmentID: fragment.ID,
+			Content:    fragment.Content,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		fragment.Content = input.Content
+		return tx.Model(&fragment).Update("content", input.Content).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fragment, nil
+}
+
+// GetFragmentRevisions はFragmentの編集履歴を新しい順に取得する
+func (u *FragmentUsecase) GetFragmentRevisions(fragmentID uint) ([]models.FragmentRevision, error) {
+	var revisions []models.FragmentRevision
+	if err := u.db.Where("fragment_id = ?", fragmentID).Order("created_at DESC, id DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// RestoreFragmentRevision はFragmentの内容をリビジョンの内容に戻す
+// 復元前の内容も新しいリビジョンとして保存されるため、復元自体も取り消せる
+func (u *FragmentUsecase) RestoreFragmentRevision(fragmentID, revisionID uint) (*models.Fragment, error) {
+	var revision models.FragmentRevision
+	if err := u.db.Where("fragment_id = ?", fragmentID).First(&revision, revisionID).Error; err != nil {
+		return nil, fmt.Errorf("revision %d not found for fragment %d: %w", revisionID, fragmentID, err)
+	}
+
+	return u.UpdateFragment(UpdateFragmentInput{
+		ID:      fragmentID,
+		Content: revision.Content,
+	})
+}
+
 // DeleteFragment はFragmentを削除する（ソフトデリート）
 func (u *FragmentUsecase) DeleteFragment(id uint) error {
 	return u.db.Delete(&models.Fragment{}, id).Error
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"fmt"
+	"insight/src/models"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GenerationRunUsecase struct {
+	db *gorm.DB
+}
+
+func NewGenerationRunUsecase(db *gorm.DB) *GenerationRunUsecase {
+	return &GenerationRunUsecase{db: db}
+}
+
+// GenerationScope はドキュメント生成の対象とするフラグメントの範囲
+// すべて空の場合は全フラグメントを対象とする
+type GenerationScope struct {
+	Tags        []string   `json:"tags"`
+	Since       *time.Time `json:"since"`
+	Until       *time.Time `json:"until"`
+	FragmentIDs []uint     `json:"fragment_ids"`
+}
+
+// IsScoped は対象範囲が絞り込まれているかを返す
+func (s GenerationScope) IsScoped() bool {
+	return len(s.Tags) > 0 || s.Since != nil || s.Until != nil || len(s.FragmentIDs) > 0
+}
+
+// Describe は対象範囲を表示用の文字列にする
+func (s GenerationScope) Describe() string {
+	if !s.IsScoped() {
+		return "all fragments"
+	}
+
+	var parts []string
+	if len(s.Tags) > 0 {
+		parts = append(parts, "tags: "+strings.Join(s.Tags, ", "))
+	}
+	if s.Since != nil {
+		parts = append(parts, "since "+s.Since.Format("2006-01-02"))
+	}
+	if s.Until != nil {
+		// Until は翌日0時（排他的）で保持しているため、表示は前日にする
+		parts = append(parts, "until "+s.Until.Add(-time.Nanosecond).Format("2006-01-02"))
+	}
+	if len(s.FragmentIDs) > 0 {
+		ids := make([]string, len(s.FragmentIDs))
+		for i, id := range s.FragmentIDs {
+			ids[i] = fmt.Sprintf("%d", id)
+		}
+		parts = append(parts, "fragments: "+strings.Join(ids, ", "))
+	}
+	return strings.Join(parts, " / ")
+}
+
+// GenerationStyles は指定できるドキュメントのスタイル
+var GenerationStyles = []string{
+	models.GenerationStyleHowTo,
+	models.GenerationStyleReference,
+	models.GenerationStyleFAQ,
+	models.GenerationStyleADR,
+	models.GenerationStyleOnboarding,
+}
+
+// GenerationGranularities は指定できるドキュメントの粒度
+var GenerationGranularities = []string{
+	models.GenerationGranularityBroad,
+	models.GenerationGranularityDetailed,
+}
+
+// GenerationOptions は利用者がドキュメント生成に与えるパラメータ
+// すべて空の場合は既定の構成でAIに任せる
+type GenerationOptions struct {
+	Instructions    string `json:"instructions"`
+	Audience        string `json:"audience"`
+	Style           string `json:"style"`
+	Granularity     string `json:"granularity"`
+	TargetDocuments int    `json:"target_documents"` // 希望するドキュメント数（0はAIに任せる）
+}
+
+// Validate はスタイル・粒度・ドキュメント数が指定できる値かを確認する
+func (o GenerationOptions) Validate() error {
+	if o.Style != "" && !slices.Contains(GenerationStyles, o.Style) {
+		return fmt.Errorf("invalid style: %s (available: %s)", o.Style, strings.Join(GenerationStyles, ", "))
+	}
+	if o.Granularity != "" && !slices.Contains(GenerationGranularities, o.Granularity) {
+		return fmt.Errorf("invalid granularity: %s (available: %s)", o.Granularity, strings.Join(GenerationGranularities, ", "))
+	}
+	if o.TargetDocuments < 0 {
+		return fmt.Errorf("invalid number of documents: %d", o.TargetDocuments)
+	}
+	return nil
+}
+
+// Describe はパラメータを表示用の文字列にする
+func (o GenerationOptions) Describe() string {
+	var parts []string
+	if o.Style != "" {
+		parts = append(parts, "style: "+o.Style)
+	}
+	if o.Audience != "" {
+		parts = append(parts, "audience: "+o.Audience)
+	}
+	if o.Granularity != "" {
+		parts = append(parts, "granularity: "+o.Granularity)
+	}
+	if o.TargetDocuments > 0 {
+		parts = append(parts, fmt.Sprintf("documents: %d", o.TargetDocuments))
+	}
+	if o.Instructions != "" {
+		parts = append(parts, "with instructions")
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, " / ")
+}
+
+// ScopeOf は生成の記録から対象範囲を取り出す
+func ScopeOf(run *models.GenerationRun) GenerationScope {
+	return GenerationScope{
+		Tags:        run.ScopeTags,
+		Since:       run.ScopeSince,
+		Until:       run.ScopeUntil,
+		FragmentIDs: run.ScopeFragmentIDs,
+	}
+}
+
+// OptionsOf は生成の記録から生成パラメータを取り出す
+func OptionsOf(run *models.GenerationRun) GenerationOptions {
+	return GenerationOptions{
+		Instructions:    run.Instructions,
+		Audience:        run.Audience,
+		Style:           run.Style,
+		Granularity:     run.Granularity,
+		TargetDocuments: run.TargetDocuments,
+	}
+}
+
+// CreateGenerationRunInput はGenerationRun作成の入力データ
+type CreateGenerationRunInput struct {
+	VersionCreatedAt time.Time         `json:"version_created_at" validate:"required"`
+	Scope            GenerationScope   `json:"scope"`
+	Options          GenerationOptions `json:"options"`
+	FragmentCount    int               `json:"fragment_count"`
+	DocumentCount    int               `json:"document_count"`
+}
+
+// CreateGenerationRun はドキュメント生成の記録を作成する
+func (u *GenerationRunUsecase) CreateGenerationRun(input CreateGenerationRunInput) (*models.GenerationRun, error) {
+	run := models.GenerationRun{
+		VersionCreatedAt: input.VersionCreatedAt,
+		Scoped:           input.Scope.IsScoped(),
+		ScopeTags:        input.Scope.Tags,
+		ScopeSince:       input.Scope.Since,
+		ScopeUntil:       input.Scope.Until,
+		ScopeFragmentIDs: input.Scope.FragmentIDs,
+		Instructions:     input.Options.Instructions,
+		Audience:         input.Options.Audience,
+		Style:            input.Options.Style,
+		Granularity:      input.Options.Granularity,
+		TargetDocuments:  input.Options.TargetDocuments,
+		FragmentCount:    input.FragmentCount,
+		DocumentCount:    input.DocumentCount,
+	}
+
+	if err := u.db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// SetDocumentCount は生成の記録に作成できたドキュメント数を保存する
+func (u *GenerationRunUsecase) SetDocumentCount(id uint, count int) error {
+	return u.db.Model(&models.GenerationRun{}).Where("id = ?", id).Update("document_count", count).Error
+}
+
+// GetGenerationRuns はすべての生成の記録を新しい順に取得する
+func (u *GenerationRunUsecase) GetGenerationRuns() ([]models.GenerationRun, error) {
+	var runs []models.GenerationRun
+	if err := u.db.Order("version_created_at DESC").Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetGenerationRunByVersion はバージョンに対応する生成の記録を取得する
+func (u *GenerationRunUsecase) GetGenerationRunByVersion(versionCreatedAt time.Time) (*models.GenerationRun, error) {
+	var run models.GenerationRun
+	if err := u.db.Where("version_created_at = ?", versionCreatedAt).First(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
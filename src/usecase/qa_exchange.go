@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+type QAExchangeUsecase struct {
+	db *gorm.DB
+}
+
+func NewQAExchangeUsecase(db *gorm.DB) *QAExchangeUsecase {
+	return &QAExchangeUsecase{db: db}
+}
+
+// QAHistoryInput は質問応答履歴の検索条件
+type QAHistoryInput struct {
+	Scope      string `json:"scope"`       // document / global（空の場合はすべて）
+	DocumentID uint   `json:"document_id"` // 0の場合は絞り込まない
+	Feedback   *int   `json:"feedback"`    // 1 / -1 / 0（nilの場合は絞り込まない）
+	Limit      int    `json:"limit"`
+}
+
+// GetHistory は質問応答の履歴を新しい順に取得する
+func (u *QAExchangeUsecase) GetHistory(input QAHistoryInput) ([]models.QAExchange, error) {
+	query := u.db.Order("created_at DESC, id DESC")
+	if input.Scope != "" {
+		query = query.Where("scope = ?", input.Scope)
+	}
+	if input.DocumentID != 0 {
+		query = query.Where("document_id = ?", input.DocumentID)
+	}
+	if input.Feedback != nil {
+		query = query.Where("feedback = ?", *input.Feedback)
+	}
+	if input.Limit > 0 {
+		query = query.Limit(input.Limit)
+	}
+
+	var exchanges []models.QAExchange
+	if err := query.Find(&exchanges).Error; err != nil {
+		return nil, err
+	}
+	return exchanges, nil
+}
+
+// GetExchange はIDで質問応答の記録を取得する
+func (u *QAExchangeUsecase) GetExchange(id uint) (*models.QAExchange, error) {
+	var exchange models.QAExchange
+	if err := u.db.First(&exchange, id).Error; err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+// SetFeedbackInput はフィードバック登録の入力データ
+type SetFeedbackInput struct {
+	ExchangeID uint   `json:"exchange_id" validate:"required"`
+	Rating     int    `json:"rating" validate:"oneof=-1 0 1"` // 1: 良い, -1: 悪い, 0: 取り消し
+	Comment    string `json:"comment"`
+}
+
+// SetFeedback は質問応答の評価とコメントを記録する
+func (u *QAExchangeUsecase) SetFeedback(input SetFeedbackInput) (*models.QAExchange, error) {
+	if input.Rating != models.FeedbackUp && input.Rating != models.FeedbackDown && input.Rating != 0 {
+		return nil, fmt.Errorf("invalid rating: %d", input.Rating)
+	}
+
+	exchange, err := u.GetExchange(input.ExchangeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.db.Model(exchange).Updates(map[string]interface{}{
+		"feedback":         input.Rating,
+		"feedback_comment": input.Comment,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return exchange, nil
+}
+
+// SaveAsFragment は回答を新しいFragmentとして保存し、質問応答の記録と関連付ける
+// 保存済みの場合は既存のFragmentを返す
+func (u *QAExchangeUsecase) SaveAsFragment(id uint, userID *uint) (*models.Fragment, error) {
+	exchange, err := u.GetExchange(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if exchange.FragmentID != nil {
+		var fragment models.Fragment
+		if err := u.db.First(&fragment, *exchange.FragmentID).Error; err == nil {
+			return &fragment, nil
+		}
+	}
+
+	// 次回のドキュメント生成で文脈が伝わるよう質問と回答をまとめて保存
+	fragment := models.Fragment{
+		Content: formatExchangeFragment(exchange),
+		UserID:  userID,
+	}
+
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fragment).Error; err != nil {
+			return err
+		}
+		return tx.Model(exchange).Update("fragment_id", fragment.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &fragment, nil
+}
+
+// formatExchangeFragment は質問応答をFragmentの本文に整形する
+func formatExchangeFragment(exchange *models.QAExchange) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Q: %s\n\n", strings.TrimSpace(exchange.Question)))
+	builder.WriteString(strings.TrimSpace(exchange.Answer))
+	if len(exchange.Sources) > 0 {
+		builder.WriteString("\n\n参照: ")
+		builder.WriteString(strings.Join(exchange.Sources, ", "))
+	}
+	return builder.String()
+}
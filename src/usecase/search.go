@@ -0,0 +1,419 @@
+package usecase
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"insight/src/db"
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSearchPerPage は1ページあたりのデフォルト件数
+	defaultSearchPerPage = 20
+	// maxSearchPerPage は1ページあたりの最大件数
+	maxSearchPerPage = 100
+	// minTrigramRunes はtrigramトークナイザーで検索可能な最小文字数
+	minTrigramRunes = 3
+
+	// スニペットのハイライト位置を示す番兵文字（HTMLエスケープ後に<mark>へ置換する）
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+type SearchUsecase struct {
+	db *gorm.DB
+}
+
+func NewSearchUsecase(db *gorm.DB) *SearchUsecase {
+	return &SearchUsecase{db: db}
+}
+
+// SearchDocumentsInput はDocument検索の入力データ
+type SearchDocumentsInput struct {
+	Query   string     `json:"query" validate:"required"`
+	Tags    []string   `json:"tags"`    // いずれかのタグを持つDocumentに絞り込む
+	Version *time.Time `json:"version"` // 指定バージョンのDocumentに絞り込む
+	Since   *time.Time `json:"since"`   // 作成日時の下限（この時刻を含む）
+	Until   *time.Time `json:"until"`   // 作成日時の上限（この時刻を含まない）
+	Page    int        `json:"page"`
+	PerPage int        `json:"per_page"`
+}
+
+// SearchFragmentsInput はFragment検索の入力データ
+type SearchFragmentsInput struct {
+	Query   string     `json:"query" validate:"required"`
+	Tags    []string   `json:"tags"`
+	Since   *time.Time `json:"since"`
+	Until   *time.Time `json:"until"`
+	Page    int        `json:"page"`
+	PerPage int        `json:"per_page"`
+}
+
+// DocumentSearchHit はDocument検索のヒットを表す構造体
+type DocumentSearchHit struct {
+	ID               uint      `json:"id"`
+	Title            string    `json:"title"`
+	Summary          string    `json:"summary"`
+	Snippet          string    `json:"snippet"` // <mark>でハイライトされたHTML
+	Score            float64   `json:"score"`   // 大きいほど関連度が高い
+	Tags             []string  `json:"tags"`
+	VersionCreatedAt time.Time `json:"version_created_at"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// FragmentSearchHit はFragment検索のヒットを表す構造体
+type FragmentSearchHit struct {
+	ID        uint      `json:"id"`
+	Snippet   string    `json:"snippet"`
+	Score     float64   `json:"score"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DocumentSearchResult はDocument検索結果
+type DocumentSearchResult struct {
+	Hits    []DocumentSearchHit `json:"hits"`
+	Total   int64               `json:"total"`
+	Page    int                 `json:"page"`
+	PerPage int                 `json:"per_page"`
+}
+
+// FragmentSearchResult はFragment検索結果
+type FragmentSearchResult struct {
+	Hits    []FragmentSearchHit `json:"hits"`
+	Total   int64               `json:"total"`
+	Page    int                 `json:"page"`
+	PerPage int                 `json:"per_page"`
+}
+
+// searchRow は検索クエリの結果行
+type searchRow struct {
+	ID      uint
+	Snippet string
+	Score   float64
+}
+
+// SearchDocuments は全文検索インデックスを用いてDocumentを関連度順に検索する
+func (u *SearchUsecase) SearchDocuments(input SearchDocumentsInput) (*DocumentSearchResult, error) {
+	page, perPage := NormalizePaging(input.Page, input.PerPage)
+	terms := splitSearchTerms(input.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	query := u.db.Table("documents").Where("documents.deleted_at IS NULL")
+	if len(input.Tags) > 0 {
+		// 親タグを指定した場合は子孫のタグが付いたものも含める
+		tags, err := NewTagUsecase(u.db).ExpandTagNames(input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("documents.id IN (?)", u.db.Table("document_tags").
+			Select("document_tags.document_id").
+			Joins("JOIN tags ON tags.id = document_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+	if input.Version != nil {
+		query = query.Where("documents.version_created_at = ?", *input.Version)
+	}
+	if input.Since != nil {
+		query = query.Where("documents.created_at >= ?", *input.Since)
+	}
+	if input.Until != nil {
+		query = query.Where("documents.created_at < ?", *input.Until)
+	}
+
+	rows, total, err := u.search(query, "documents", "documents_fts", []string{"title", "summary", "content"}, "10.0, 5.0, 1.0", terms, page, perPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+
+	// ヒットしたDocumentの詳細を取得
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var documents []models.Document
+	if err := u.db.Preload("Tags").Find(&documents, ids).Error; err != nil {
+		return nil, err
+	}
+	documentsByID := make(map[uint]models.Document, len(documents))
+	for _, document := range documents {
+		documentsByID[document.ID] = document
+	}
+
+	hits := make([]DocumentSearchHit, 0, len(rows))
+	for _, row := range rows {
+		document := documentsByID[row.ID]
+		snippet := row.Snippet
+		if snippet == "" {
+			snippet = buildSnippet(document.Title+" "+document.Summary+" "+document.Content, terms)
+		}
+		hits = append(hits, DocumentSearchHit{
+			ID:               document.ID,
+			Title:            document.Title,
+			Summary:          document.Summary,
+			Snippet:          highlightToHTML(snippet),
+			Score:            0 - row.Score,
+			Tags:             tagNames(document.Tags),
+			VersionCreatedAt: document.VersionCreatedAt,
+			CreatedAt:        document.CreatedAt,
+		})
+	}
+
+	return &DocumentSearchResult{Hits: hits, Total: total, Page: page, PerPage: perPage}, nil
+}
+
+// SearchFragments は全文検索インデックスを用いてFragmentを関連度順に検索する
+func (u *SearchUsecase) SearchFragments(input SearchFragmentsInput) (*FragmentSearchResult, error) {
+	page, perPage := NormalizePaging(input.Page, input.PerPage)
+	terms := splitSearchTerms(input.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search query is required")
+	}
+
+	query := u.db.Table("fragments").Where("fragments.deleted_at IS NULL")
+	if len(input.Tags) > 0 {
+		tags, err := NewTagUsecase(u.db).ExpandTagNames(input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("fragments.id IN (?)", u.db.Table("fragment_tags").
+			Select("fragment_tags.fragment_id").
+			Joins("JOIN tags ON tags.id = fragment_tags.tag_id").
+			Where("tags.name IN ?", tags))
+	}
+	if input.Since != nil {
+		query = query.Where("fragments.created_at >= ?", *input.Since)
+	}
+	if input.Until != nil {
+		query = query.Where("fragments.created_at < ?", *input.Until)
+	}
+
+	rows, total, err := u.search(query, "fragments", "fragments_fts", []string{"content"}, "1.0", terms, page, perPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search fragments: %w", err)
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var fragments []models.Fragment
+	if err := u.db.Preload("Tags").Find(&fragments, ids).Error; err != nil {
+		return nil, err
+	}
+	fragmentsByID := make(map[uint]models.Fragment, len(fragments))
+	for _, fragment := range fragments {
+		fragmentsByID[fragment.ID] = fragment
+	}
+
+	hits := make([]FragmentSearchHit, 0, len(rows))
+	for _, row := range rows {
+		fragment := fragmentsByID[row.ID]
+		snippet := row.Snippet
+		if snippet == "" {
+			snippet = buildSnippet(fragment.Content, terms)
+		}
+		hits = append(hits, FragmentSearchHit{
+			ID:        fragment.ID,
+			Snippet:   highlightToHTML(snippet),
+			Score:     0 - row.Score,
+			Tags:      tagNames(fragment.Tags),
+			CreatedAt: fragment.CreatedAt,
+		})
+	}
+
+	return &FragmentSearchResult{Hits: hits, Total: total, Page: page, PerPage: perPage}, nil
+}
+
+// search はフィルタ済みクエリに対して全文検索を行い、IDとスニペットを返す
+// FTS5が利用できない場合や短い語句はLIKE検索で代替する
+func (u *SearchUsecase) search(filtered *gorm.DB, source, ftsTable string, columns []string, weights string, terms []string, page, perPage int) ([]searchRow, int64, error) {
+	var ftsTerms, likeTerms []string
+	useFTS := db.FullTextSearchAvailable(u.db)
+	for _, term := range terms {
+		if useFTS && utf8.RuneCountInString(term) >= minTrigramRunes {
+			ftsTerms = append(ftsTerms, term)
+		} else {
+			likeTerms = append(likeTerms, term)
+		}
+	}
+
+	query := filtered
+	for _, term := range likeTerms {
+		pattern := "%" + escapeLike(term) + "%"
+		conditions := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			conditions[i] = fmt.Sprintf("%s.%s LIKE ? ESCAPE '\\'", source, column)
+			args[i] = pattern
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	var rows []searchRow
+	if len(ftsTerms) > 0 {
+		query = query.Joins(fmt.Sprintf("JOIN %[1]s ON %[1]s.rowid = %[2]s.id", ftsTable, source)).
+			Where(fmt.Sprintf("%s MATCH ?", ftsTable), buildMatchExpression(ftsTerms))
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, 0, err
+		}
+
+		err := query.Select(fmt.Sprintf("%[1]s.id AS id, snippet(%[2]s, -1, '%[3]s', '%[4]s', '…', 48) AS snippet, bm25(%[2]s, %[5]s) AS score",
+			source, ftsTable, highlightStart, highlightEnd, weights)).
+			Order("score").
+			Limit(perPage).
+			Offset((page - 1) * perPage).
+			Scan(&rows).Error
+		return rows, total, err
+	}
+
+	// LIKEのみの検索（新しい順）
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Select(fmt.Sprintf("%s.id AS id", source)).
+		Order(fmt.Sprintf("%s.created_at DESC", source)).
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Scan(&rows).Error
+	return rows, total, err
+}
+
+// ParseDate は日付（YYYY-MM-DD）またはRFC3339形式の文字列を時刻に変換する
+func ParseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", value)
+}
+
+// ParseDateUntil は検索の上限日付を解釈する
+// 日付のみ指定された場合はその日の終わりまでを含むよう翌日0時を返す
+func ParseDateUntil(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return ParseDate(value)
+}
+
+// NormalizePaging はページ番号と1ページあたりの件数を既定値・上限の範囲に収める
+func NormalizePaging(page, perPage int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage <= 0 {
+		perPage = defaultSearchPerPage
+	}
+	if perPage > maxSearchPerPage {
+		perPage = maxSearchPerPage
+	}
+	return page, perPage
+}
+
+// splitSearchTerms は検索クエリを空白（全角含む）で語句に分割する
+func splitSearchTerms(query string) []string {
+	return strings.Fields(strings.ReplaceAll(query, "　", " "))
+}
+
+// buildMatchExpression はFTS5のMATCH式を構築する（各語句をフレーズとしてAND検索）
+func buildMatchExpression(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(term)
+}
+
+// buildSnippet はFTS5を使わない場合のスニペットを生成する
+func buildSnippet(text string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := []rune(strings.ToLower(string(runes)))
+
+	// 最初に一致した語句の周辺を切り出す
+	start := 0
+	for _, term := range terms {
+		if idx := strings.Index(string(lower), strings.ToLower(term)); idx >= 0 {
+			start = utf8.RuneCountInString(string(lower)[:idx])
+			break
+		}
+	}
+
+	const radius = 40
+	from := start - radius
+	if from < 0 {
+		from = 0
+	}
+	to := start + radius*2
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	snippet := string(runes[from:to])
+	for _, term := range terms {
+		snippet = highlightTerm(snippet, term)
+	}
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// highlightTerm は大文字小文字を区別せずに語句を番兵文字で囲む
+func highlightTerm(text, term string) string {
+	if term == "" {
+		return text
+	}
+	lowerText := strings.ToLower(text)
+	lowerTerm := strings.ToLower(term)
+
+	var b strings.Builder
+	for {
+		idx := strings.Index(lowerText, lowerTerm)
+		if idx < 0 || len(lowerText) != len(text) {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:idx])
+		b.WriteString(highlightStart + text[idx:idx+len(term)] + highlightEnd)
+		text = text[idx+len(term):]
+		lowerText = lowerText[idx+len(term):]
+	}
+	return b.String()
+}
+
+// highlightToHTML はスニペットをHTMLエスケープし、番兵文字を<mark>に置換する
+func highlightToHTML(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
+
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
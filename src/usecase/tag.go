@@ -0,0 +1,667 @@
+package usecase
+
+import (
+	"fmt"
+	"insight/src/models"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type TagUsecase struct {
+	db *gorm.DB
+}
+
+func NewTagUsecase(db *gorm.DB) *TagUsecase {
+	return &TagUsecase{db: db}
+}
+
+// TagSummary はタグと利用件数
+type TagSummary struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Color         string `json:"color"`
+	ParentID      *uint  `json:"parent_id"`
+	DocumentCount int64  `json:"document_count"`
+	FragmentCount int64  `json:"fragment_count"`
+
+	Synonyms []string `json:"synonyms" gorm:"-"`
+}
+
+// GetAllTags はすべてのタグを名前順に取得する
+func (u *TagUsecase) GetAllTags() ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := u.db.Order("name ASC").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTagSummaries はすべてのタグをドキュメント・フラグメントでの利用件数とともに取得する
+// 削除済みのドキュメント・フラグメントは件数に含めない
+func (u *TagUsecase) GetTagSummaries() ([]TagSummary, error) {
+	var summaries []TagSummary
+	err := u.db.Model(&models.Tag{}).
+		Select(`tags.id, tags.name, tags.color, tags.parent_id,
+			(SELECT COUNT(*) FROM document_tags JOIN documents ON documents.id = document_tags.document_id
+				WHERE document_tags.tag_id = tags.id AND documents.deleted_at IS NULL) AS document_count,
+			(SELECT COUNT(*) FROM fragment_tags JOIN fragments ON fragments.id = fragment_tags.fragment_id
+				WHERE fragment_tags.tag_id = tags.id AND fragments.deleted_at IS NULL) AS fragment_count`).
+		Order("tags.name ASC").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var synonyms []models.TagSynonym
+	if err := u.db.Order("name ASC").Find(&synonyms).Error; err != nil {
+		return nil, err
+	}
+	synonymsByTag := make(map[uint][]string)
+	for _, synonym := range synonyms {
+		synonymsByTag[synonym.TagID] = append(synonymsByTag[synonym.TagID], synonym.Name)
+	}
+	for i := range summaries {
+		summaries[i].Synonyms = synonymsByTag[summaries[i].ID]
+	}
+	return summaries, nil
+}
+
+// GetTag はIDでタグを取得する
+func (u *TagUsecase) GetTag(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := u.db.First(&tag, id).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTagByName は名前でタグを取得する
+func (u *TagUsecase) GetTagByName(name string) (*models.Tag, error) {
+	var tag models.Tag
+	if err := u.db.Where("name = ?", strings.TrimSpace(name)).First(&tag).Error; err != nil {
+		return nil, fmt.Errorf("tag '%s' not found", name)
+	}
+	return &tag, nil
+}
+
+// GetOrCreateTags は指定された名前のタグを取得し、存在しないものは作成してIDを返す
+func (u *TagUsecase) GetOrCreateTags(names []string) ([]uint, error) {
+	var tagIDs []uint
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		// 既存のタグを検索
+		var tag models.Tag
+		err := u.db.Where("name = ?", name).First(&tag).Error
+		if err == nil {
+			tagIDs = appendTagID(tagIDs, tag.ID)
+			continue
+		}
+
+		// 同義語として登録された名前は元のタグに読み替える
+		var synonym models.TagSynonym
+		err = u.db.Where("LOWER(name) = LOWER(?)", name).First(&synonym).Error
+		if err == nil {
+			tagIDs = appendTagID(tagIDs, synonym.TagID)
+			continue
+		}
+
+		// タグが見つからない場合は新しく作成
+		tag = models.Tag{
+			Name:  name,
+			Color: TagColor(name), // タグ名から色を生成
+		}
+		if err := u.db.Create(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to create tag '%s': %w", name, err)
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	return tagIDs, nil
+}
+
+// CreateTag は新しいタグを作成する
+// 既存のタグや同義語と同じ名前では作成できない
+func (u *TagUsecase) CreateTag(name string) (*models.Tag, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("tag name is required")
+	}
+
+	var count int64
+	if err := u.db.Model(&models.Tag{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("tag '%s' already exists", name)
+	}
+	var synonym models.TagSynonym
+	if err := u.db.Where("LOWER(name) = LOWER(?)", name).First(&synonym).Error; err == nil {
+		return nil, fmt.Errorf("'%s' is a synonym of another tag", name)
+	}
+
+	tag := models.Tag{
+		Name:  name,
+		Color: TagColor(name),
+	}
+	if err := u.db.Create(&tag).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tag '%s': %w", name, err)
+	}
+	return &tag, nil
+}
+
+// appendTagID は同じタグを重複して関連付けないよう、未追加のIDだけを追加する
+func appendTagID(tagIDs []uint, id uint) []uint {
+	if slices.Contains(tagIDs, id) {
+		return tagIDs
+	}
+	return append(tagIDs, id)
+}
+
+// RenameTag はタグの名前を変更する
+// 別のタグや別のタグの同義語と同じ名前にはできない（まとめる場合は MergeTags を使う）
+func (u *TagUsecase) RenameTag(name, newName string) (*models.Tag, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, fmt.Errorf("new tag name is required")
+	}
+
+	tag, err := u.GetTagByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if tag.Name == newName {
+		return tag, nil
+	}
+
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Tag{}).Where("name = ? AND id <> ?", newName, tag.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("tag '%s' already exists; merge the tags instead", newName)
+		}
+
+		// 自分の同義語と同じ名前にする場合は、その同義語は不要になる
+		var synonym models.TagSynonym
+		if err := tx.Where("LOWER(name) = LOWER(?)", newName).First(&synonym).Error; err == nil {
+			if synonym.TagID != tag.ID {
+				return fmt.Errorf("'%s' is a synonym of another tag", newName)
+			}
+			if err := tx.Unscoped().Delete(&synonym).Error; err != nil {
+				return err
+			}
+		}
+
+		tag.Name = newName
+		return tx.Model(tag).Update("name", newName).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// MergeTags は複数のタグを1つのタグにまとめる
+// まとめられたタグのドキュメント・フラグメントとの関連は統合先に付け替え、名前は統合先の同義語として残す
+// 統合先のタグが存在しない場合は作成する
+func (u *TagUsecase) MergeTags(targetName string, sourceNames []string) (*models.Tag, error) {
+	targetName = strings.TrimSpace(targetName)
+	if targetName == "" {
+		return nil, fmt.Errorf("target tag name is required")
+	}
+
+	var target models.Tag
+	err := u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", targetName).First(&target).Error; err != nil {
+			target = models.Tag{Name: targetName, Color: TagColor(targetName)}
+			if err := tx.Create(&target).Error; err != nil {
+				return fmt.Errorf("failed to create tag '%s': %w", targetName, err)
+			}
+		}
+
+		for _, name := range sourceNames {
+			name = strings.TrimSpace(name)
+			if name == "" || name == target.Name {
+				continue
+			}
+
+			var source models.Tag
+			if err := tx.Where("name = ?", name).First(&source).Error; err != nil {
+				return fmt.Errorf("tag '%s' not found", name)
+			}
+
+			// 関連を統合先に付け替える（すでに統合先が付いているものは重複させない）
+			for _, table := range []struct{ name, column string }{
+				{"document_tags", "document_id"},
+				{"fragment_tags", "fragment_id"},
+			} {
+				err := tx.Exec(fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, tag_id)
+					SELECT %[2]s, ? FROM %[1]s WHERE tag_id = ?
+					AND %[2]s NOT IN (SELECT %[2]s FROM %[1]s WHERE tag_id = ?)`, table.name, table.column),
+					target.ID, source.ID, target.ID).Error
+				if err != nil {
+					return err
+				}
+				if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tag_id = ?", table.name), source.ID).Error; err != nil {
+					return err
+				}
+			}
+
+			// 統合先がまとめるタグの子孫だった場合は、循環しないよう先にまとめるタグの親へ付け替える
+			descendants, err := NewTagUsecase(tx).descendantTagIDs([]uint{source.ID})
+			if err != nil {
+				return err
+			}
+			if slices.Contains(descendants, target.ID) {
+				target.ParentID = source.ParentID
+				if err := tx.Model(&target).Update("parent_id", source.ParentID).Error; err != nil {
+					return err
+				}
+			}
+
+			// 子タグは統合先の子にする
+			if err := tx.Model(&models.Tag{}).Where("parent_id = ? AND id <> ?", source.ID, target.ID).Update("parent_id", target.ID).Error; err != nil {
+				return err
+			}
+
+			// 同義語も統合先に付け替え、まとめたタグの名前を同義語として登録
+			if err := tx.Model(&models.TagSynonym{}).Where("tag_id = ?", source.ID).Update("tag_id", target.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&source).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.TagSynonym{Name: source.Name, TagID: target.ID}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 統合先と同じ名前の同義語は不要
+		return tx.Unscoped().Where("tag_id = ? AND name = ?", target.ID, target.Name).Delete(&models.TagSynonym{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// tagColorPattern はタグの色（#RRGGBB）の形式
+var tagColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// SetTagColor はタグの色を変更する
+func (u *TagUsecase) SetTagColor(name, color string) (*models.Tag, error) {
+	if !tagColorPattern.MatchString(color) {
+		return nil, fmt.Errorf("invalid color: %s (expected #RRGGBB)", color)
+	}
+
+	tag, err := u.GetTagByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Color = strings.ToUpper(color)
+	if err := u.db.Model(tag).Update("color", tag.Color).Error; err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag はどのドキュメント・フラグメントにも使われていないタグを削除する
+func (u *TagUsecase) DeleteTag(name string) error {
+	tag, err := u.GetTagByName(name)
+	if err != nil {
+		return err
+	}
+
+	count, err := u.tagUsageCount(tag.ID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("tag '%s' is used by %d documents or fragments", tag.Name, count)
+	}
+
+	return u.deleteTag(u.db, tag)
+}
+
+// DeleteUnusedTags はどのドキュメント・フラグメントにも使われていないタグをすべて削除し、削除したタグ名を返す
+// 削除済みのドキュメント・フラグメントだけに付いているタグも未使用として扱う
+func (u *TagUsecase) DeleteUnusedTags() ([]string, error) {
+	summaries, err := u.GetTagSummaries()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		for _, summary := range summaries {
+			if summary.DocumentCount > 0 || summary.FragmentCount > 0 {
+				continue
+			}
+			if err := u.deleteTag(tx, &models.Tag{Model: gorm.Model{ID: summary.ID}}); err != nil {
+				return err
+			}
+			deleted = append(deleted, summary.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// tagUsageCount は削除されていないドキュメント・フラグメントでのタグの利用件数を返す
+func (u *TagUsecase) tagUsageCount(tagID uint) (int64, error) {
+	var count int64
+	err := u.db.Raw(`SELECT
+		(SELECT COUNT(*) FROM document_tags JOIN documents ON documents.id = document_tags.document_id
+			WHERE document_tags.tag_id = ? AND documents.deleted_at IS NULL) +
+		(SELECT COUNT(*) FROM fragment_tags JOIN fragments ON fragments.id = fragment_tags.fragment_id
+			WHERE fragment_tags.tag_id = ? AND fragments.deleted_at IS NULL)`, tagID, tagID).
+		Scan(&count).Error
+	return count, err
+}
+
+// deleteTag はタグとその同義語、削除済みのエンティティとの関連を削除する
+// 子タグは削除するタグの親に付け替え、同じ名前のタグを作り直せるよう物理削除する
+func (u *TagUsecase) deleteTag(tx *gorm.DB, tag *models.Tag) error {
+	var parentID *uint
+	if err := tx.Model(&models.Tag{}).Where("id = ?", tag.ID).Pluck("parent_id", &parentID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Tag{}).Where("parent_id = ?", tag.ID).Update("parent_id", parentID).Error; err != nil {
+		return err
+	}
+
+	for _, table := range []string{"document_tags", "fragment_tags"} {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE tag_id = ?", table), tag.ID).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().Where("tag_id = ?", tag.ID).Delete(&models.TagSynonym{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.Tag{}, tag.ID).Error
+}
+
+// AddTagSynonym はタグに同義語を追加する
+// 既存のタグと同じ名前は同義語にできない（まとめる場合は MergeTags を使う）
+func (u *TagUsecase) AddTagSynonym(name, synonym string) (*models.TagSynonym, error) {
+	synonym = strings.TrimSpace(synonym)
+	if synonym == "" {
+		return nil, fmt.Errorf("synonym is required")
+	}
+
+	tag, err := u.GetTagByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := u.db.Model(&models.Tag{}).Where("name = ?", synonym).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("tag '%s' already exists; merge the tags instead", synonym)
+	}
+	if err := u.db.Model(&models.TagSynonym{}).Where("LOWER(name) = LOWER(?)", synonym).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("synonym '%s' is already registered", synonym)
+	}
+
+	tagSynonym := models.TagSynonym{Name: synonym, TagID: tag.ID}
+	if err := u.db.Create(&tagSynonym).Error; err != nil {
+		return nil, err
+	}
+	return &tagSynonym, nil
+}
+
+// RemoveTagSynonym は同義語を削除する
+func (u *TagUsecase) RemoveTagSynonym(synonym string) error {
+	result := u.db.Unscoped().Where("name = ?", strings.TrimSpace(synonym)).Delete(&models.TagSynonym{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("synonym '%s' not found", synonym)
+	}
+	return nil
+}
+
+// TagColor はタグ名から一意の色を生成する
+func TagColor(tagName string) string {
+	// 簡単なハッシュベースの色生成
+	hash := 0
+	for _, char := range tagName {
+		hash = int(char) + ((hash << 5) - hash)
+	}
+
+	// HSL色空間で彩度と明度を固定し、色相のみを変更
+	hue := (hash%360 + 360) % 360
+
+	// 色相を6つの主要な色に分類してより見やすい色にする
+	colors := []string{"#3B82F6", "#EF4444", "#10B981", "#F59E0B", "#8B5CF6", "#EC4899"}
+	return colors[hue%len(colors)]
+}
+
+// TagNode はタグの木の1ノード
+type TagNode struct {
+	TagSummary
+	Children []*TagNode `json:"children"`
+
+	// 子孫のタグを含めた利用件数
+	TotalDocumentCount int64 `json:"total_document_count"`
+	TotalFragmentCount int64 `json:"total_fragment_count"`
+}
+
+// GetTagTree はタグを親子関係の木にして返す（各階層は名前順）
+func (u *TagUsecase) GetTagTree() ([]*TagNode, error) {
+	summaries, err := u.GetTagSummaries()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*TagNode, len(summaries))
+	for _, summary := range summaries {
+		nodes[summary.ID] = &TagNode{TagSummary: summary}
+	}
+
+	// GetTagSummaries が名前順なので、子も名前順に並ぶ
+	var roots []*TagNode
+	for _, summary := range summaries {
+		node := nodes[summary.ID]
+		if parent, ok := nodes[parentIDOf(summary.ParentID)]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	for _, root := range roots {
+		sumTagNode(root)
+	}
+	return roots, nil
+}
+
+// sumTagNode は子孫を含めた利用件数を集計する
+// 同じドキュメントに親子のタグが両方付いている場合は重複して数える
+func sumTagNode(node *TagNode) {
+	node.TotalDocumentCount = node.DocumentCount
+	node.TotalFragmentCount = node.FragmentCount
+	for _, child := range node.Children {
+		sumTagNode(child)
+		node.TotalDocumentCount += child.TotalDocumentCount
+		node.TotalFragmentCount += child.TotalFragmentCount
+	}
+}
+
+func parentIDOf(parentID *uint) uint {
+	if parentID == nil {
+		return 0
+	}
+	return *parentID
+}
+
+// SetTagParent はタグの親を設定する（parentName が空の場合は最上位にする）
+// 自分自身や子孫を親にすることはできない
+func (u *TagUsecase) SetTagParent(name, parentName string) (*models.Tag, error) {
+	tag, err := u.GetTagByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var parentID *uint
+	if parentName = strings.TrimSpace(parentName); parentName != "" {
+		parent, err := u.GetTagByName(parentName)
+		if err != nil {
+			return nil, err
+		}
+
+		descendants, err := u.descendantTagIDs([]uint{tag.ID})
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(descendants, parent.ID) {
+			return nil, fmt.Errorf("tag '%s' cannot be a child of itself or its descendants", tag.Name)
+		}
+		parentID = &parent.ID
+	}
+
+	tag.ParentID = parentID
+	if err := u.db.Model(tag).Update("parent_id", parentID).Error; err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// GetTagAncestors はタグの祖先を最上位から順に返す（タグ自身は含まない）
+func (u *TagUsecase) GetTagAncestors(tag *models.Tag) ([]models.Tag, error) {
+	var ancestors []models.Tag
+	seen := map[uint]bool{tag.ID: true}
+	parentID := tag.ParentID
+	for parentID != nil && !seen[*parentID] {
+		var parent models.Tag
+		if err := u.db.First(&parent, *parentID).Error; err != nil {
+			return nil, err
+		}
+		seen[parent.ID] = true
+		ancestors = append([]models.Tag{parent}, ancestors...)
+		parentID = parent.ParentID
+	}
+	return ancestors, nil
+}
+
+// TagLineage はタグの色と、最上位から順の祖先のタグ名
+type TagLineage struct {
+	Color     string   `json:"color"`
+	Ancestors []string `json:"ancestors"`
+}
+
+// GetTagLineages はタグ名からそのタグの色と祖先を引ける対応表を返す
+// 画面側で親タグによる絞り込みを子タグにも適用するために使う
+func (u *TagUsecase) GetTagLineages() (map[string]TagLineage, error) {
+	var tags []models.Tag
+	if err := u.db.Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Tag, len(tags))
+	for _, tag := range tags {
+		byID[tag.ID] = tag
+	}
+
+	lineages := make(map[string]TagLineage, len(tags))
+	for _, tag := range tags {
+		lineage := TagLineage{Color: tag.Color, Ancestors: []string{}}
+		seen := map[uint]bool{tag.ID: true}
+		for parentID := tag.ParentID; parentID != nil && !seen[*parentID]; {
+			parent, ok := byID[*parentID]
+			if !ok {
+				break
+			}
+			seen[parent.ID] = true
+			lineage.Ancestors = append([]string{parent.Name}, lineage.Ancestors...)
+			parentID = parent.ParentID
+		}
+		lineages[tag.Name] = lineage
+	}
+	return lineages, nil
+}
+
+// GetChildTags はタグの直下の子タグを名前順に返す
+func (u *TagUsecase) GetChildTags(tagID uint) ([]models.Tag, error) {
+	var children []models.Tag
+	if err := u.db.Where("parent_id = ?", tagID).Order("name ASC").Find(&children).Error; err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// ExpandTagNames は指定したタグ名に、その子孫のタグ名を加えて返す
+// タグでの絞り込みで、親タグを指定した場合に子タグが付いたものも含めるために使う
+func (u *TagUsecase) ExpandTagNames(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	var rootIDs []uint
+	if err := u.db.Model(&models.Tag{}).Where("name IN ?", names).Pluck("id", &rootIDs).Error; err != nil {
+		return nil, err
+	}
+	ids, err := u.descendantTagIDs(rootIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := append([]string(nil), names...)
+	var descendantNames []string
+	if err := u.db.Model(&models.Tag{}).Where("id IN ?", ids).Pluck("name", &descendantNames).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range descendantNames {
+		if !slices.Contains(expanded, name) {
+			expanded = append(expanded, name)
+		}
+	}
+	return expanded, nil
+}
+
+// descendantTagIDs は指定したタグと、その子孫のタグのIDを返す
+func (u *TagUsecase) descendantTagIDs(rootIDs []uint) ([]uint, error) {
+	var tags []models.Tag
+	if err := u.db.Select("id", "parent_id").Where("parent_id IS NOT NULL").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[uint][]uint)
+	for _, tag := range tags {
+		children[*tag.ParentID] = append(children[*tag.ParentID], tag.ID)
+	}
+
+	ids := append([]uint(nil), rootIDs...)
+	seen := make(map[uint]bool)
+	for i := 0; i < len(ids); i++ {
+		if seen[ids[i]] {
+			continue
+		}
+		seen[ids[i]] = true
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	var result []uint
+	for id := range seen {
+		result = append(result, id)
+	}
+	slices.Sort(result)
+	return result, nil
+}
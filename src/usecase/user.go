@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"insight/src/models"
+
+	"gorm.io/gorm"
+)
+
+// UserRoles はユーザーに設定できる役割の一覧
+var UserRoles = []string{models.UserRoleViewer, models.UserRoleEditor, models.UserRoleAdmin}
+
+// usernamePattern はユーザー名に使える文字（URLのクエリなどでそのまま使えるもの）
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,49}$`)
+
+type UserUsecase struct {
+	db *gorm.DB
+}
+
+func NewUserUsecase(db *gorm.DB) *UserUsecase {
+	return &UserUsecase{db: db}
+}
+
+// CreateUserInput はUser作成の入力データ
+type CreateUserInput struct {
+	Username string `json:"username" validate:"required"`
+	Role     string `json:"role"` // 空の場合は editor
+}
+
+// CreateUser はユーザーを作成する
+func (u *UserUsecase) CreateUser(input CreateUserInput) (*models.User, error) {
+	username := strings.TrimSpace(input.Username)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("invalid username: %q (use letters, digits, '.', '_' or '-', up to 50 characters)", username)
+	}
+	// AIによる生成・再生成の編集者名と区別できなくなるため使わせない
+	if strings.EqualFold(username, DocumentAuthorAI) {
+		return nil, fmt.Errorf("username '%s' is reserved", username)
+	}
+	role := input.Role
+	if role == "" {
+		role = models.UserRoleEditor
+	}
+	if err := validateUserRole(role); err != nil {
+		return nil, err
+	}
+
+	// 削除したユーザーの名前も記録に残るため再利用しない
+	var count int64
+	if err := u.db.Unscoped().Model(&models.User{}).Where("LOWER(username) = LOWER(?)", username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("user '%s' already exists", username)
+	}
+
+	user := models.User{Username: username, Role: role}
+	if err := u.db.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user '%s': %w", username, err)
+	}
+	return &user, nil
+}
+
+func validateUserRole(role string) error {
+	for _, r := range UserRoles {
+		if r == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid role: %s (available: %s)", role, strings.Join(UserRoles, ", "))
+}
+
+// GetAllUsers はすべてのユーザーをユーザー名順に取得する
+func (u *UserUsecase) GetAllUsers() ([]models.User, error) {
+	var users []models.User
+	if err := u.db.Order("username ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUserByUsername はユーザー名でユーザーを取得する（大文字小文字を区別しない）
+func (u *UserUsecase) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := u.db.Where("LOWER(username) = LOWER(?)", strings.TrimSpace(username)).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user '%s' not found: %w", username, err)
+	}
+	return &user, nil
+}
+
+// SetUserRole はユーザーの役割を変更する
+func (u *UserUsecase) SetUserRole(username, role string) (*models.User, error) {
+	if err := validateUserRole(role); err != nil {
+		return nil, err
+	}
+	user, err := u.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.db.Model(user).Update("role", role).Error; err != nil {
+		return nil, fmt.Errorf("failed to update role of '%s': %w", user.Username, err)
+	}
+	return user, nil
+}
+
+// DeleteUser はユーザーを削除し、そのユーザーのAPIトークンとセッションも削除する
+// 作成したフラグメントなどの記録は残す
+func (u *UserUsecase) DeleteUser(username string) (*models.User, error) {
+	user, err := u.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		tokenIDs := tx.Model(&models.APIToken{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Unscoped().Where("api_token_id IN (?)", tokenIDs).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete user '%s': %w", user.Username, err)
+	}
+	return user, nil
+}